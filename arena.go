@@ -0,0 +1,60 @@
+package abnf
+
+// arenaChunk is the number of nodes and children slots allocated by a [nodeArena] at once.
+const arenaChunk = 256
+
+// nodeArena allocates nodes and children slices of a parse from chunks, see [WithArena].
+// A chunk stays alive while any node or slice allocated from it is referenced.
+type nodeArena struct {
+	nodes []Node
+	chns  []*Node
+}
+
+func (a *nodeArena) node() *Node {
+	if len(a.nodes) == 0 {
+		a.nodes = make([]Node, arenaChunk)
+	}
+	n := &a.nodes[0]
+	a.nodes = a.nodes[1:]
+	return n
+}
+
+func (a *nodeArena) children(l int) Nodes {
+	if l > arenaChunk/4 {
+		return make(Nodes, l)
+	}
+	if len(a.chns) < l {
+		a.chns = make([]*Node, arenaChunk)
+	}
+	chns := a.chns[:l:l]
+	a.chns = a.chns[l:]
+	return chns
+}
+
+// WithArena allocates nodes created during the parse from chunks owned by the parse instead of one by one,
+// which saves allocations of parses that create many nodes, see [ParseTree].
+// A chunk is kept alive while any of its nodes is referenced,
+// so it suits trees that are used as a whole, e.g. converted to a [Tree], rather than nodes kept selectively.
+func WithArena() ParseOption {
+	return func(ctx *Context) {
+		ctx.arena = &nodeArena{}
+	}
+}
+
+// newNode returns a new node of the parse allocated from the arena if it's enabled.
+func (ctx *Context) newNode(key string, pos uint, val []byte) *Node {
+	if ctx == nil || ctx.arena == nil {
+		return &Node{Key: key, Pos: pos, Value: val}
+	}
+	n := ctx.arena.node()
+	n.Key, n.Pos, n.Value = key, pos, val
+	return n
+}
+
+// newChildren returns a new children slice of length l allocated from the arena if it's enabled.
+func (ctx *Context) newChildren(l int) Nodes {
+	if ctx == nil || ctx.arena == nil {
+		return make(Nodes, l)
+	}
+	return ctx.arena.children(l)
+}
@@ -0,0 +1,59 @@
+package abnf
+
+import (
+	"math/bits"
+)
+
+// ByteSet is a set of bytes represented as a 256-bit bitset.
+type ByteSet [4]uint64
+
+// NewByteSet returns a set of the given bytes.
+func NewByteSet(bs ...byte) ByteSet {
+	var s ByteSet
+	for _, b := range bs {
+		s.Add(b)
+	}
+	return s
+}
+
+// Add adds b to the set.
+func (s *ByteSet) Add(b byte) {
+	s[b>>6] |= 1 << (b & 63)
+}
+
+// AddRange adds all bytes from low to high inclusive to the set.
+func (s *ByteSet) AddRange(low, high byte) {
+	for b := int(low); b <= int(high); b++ {
+		s.Add(byte(b))
+	}
+}
+
+// Has reports whether b is in the set.
+func (s *ByteSet) Has(b byte) bool {
+	return s[b>>6]&(1<<(b&63)) != 0
+}
+
+// Union returns a union of the set and o.
+func (s ByteSet) Union(o ByteSet) ByteSet {
+	for i := range s {
+		s[i] |= o[i]
+	}
+	return s
+}
+
+// Complement returns a set of all bytes that are not in the set.
+func (s ByteSet) Complement() ByteSet {
+	for i := range s {
+		s[i] = ^s[i]
+	}
+	return s
+}
+
+// Len returns the number of bytes in the set.
+func (s *ByteSet) Len() int {
+	var n int
+	for _, w := range s {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package abnf
+
+import "bytes"
+
+// CanonicalPolicy returns the canonical form of the node value.
+type CanonicalPolicy func(n *Node) []byte
+
+// FoldCase is a [CanonicalPolicy] that lowercases the node value.
+func FoldCase(n *Node) []byte {
+	return bytes.ToLower(n.Value)
+}
+
+// Drop is a [CanonicalPolicy] that removes the node value, e.g. of comments or optional parts.
+func Drop(*Node) []byte {
+	return nil
+}
+
+// Collapse returns a [CanonicalPolicy] that replaces a non-empty node value with val,
+// e.g. collapses "*WSP" nodes into a single space. Empty values are kept empty.
+func Collapse(val []byte) CanonicalPolicy {
+	return func(n *Node) []byte {
+		if n.IsEmpty() {
+			return nil
+		}
+		return val
+	}
+}
+
+// Canonicalizer outputs canonical forms of parsed inputs, so inputs that differ only in ways
+// the grammar considers insignificant, like case of case-insensitive literals or amount of whitespace,
+// have the same canonical form, which can be compared or hashed.
+//
+// Policies are applied to nodes by key, see [Canonicalizer.Rule]. The outermost node with a policy wins,
+// its descendants aren't visited. Octets of nodes without a policy are kept as is.
+//
+// Canonicalizer is safe for concurrent use once configured.
+type Canonicalizer struct {
+	rules    map[string]CanonicalPolicy
+	literals map[string]bool
+}
+
+// NewCanonicalizer returns a canonicalizer without policies.
+func NewCanonicalizer() *Canonicalizer {
+	return &Canonicalizer{rules: make(map[string]CanonicalPolicy), literals: make(map[string]bool)}
+}
+
+// Rule sets the policy of nodes with the given key, usually a rule name.
+// It must be called before the canonicalizer is used.
+func (c *Canonicalizer) Rule(key string, p CanonicalPolicy) {
+	c.rules[key] = p
+}
+
+// FoldLiterals enables [FoldCase] of nodes of case-insensitive literals with the given keys,
+// e.g. keys returned by [github.com/ghettovoice/abnf/pkg/abnf_gen.ParserGenerator.LiteralKeys].
+// Policies set with [Canonicalizer.Rule] take precedence.
+// It must be called before the canonicalizer is used.
+func (c *Canonicalizer) FoldLiterals(keys ...string) {
+	for _, k := range keys {
+		c.literals[k] = true
+	}
+}
+
+// Canonical returns the canonical form of the node value.
+func (c *Canonicalizer) Canonical(n *Node) []byte {
+	return n.Rewrite(func(n *Node) ([]byte, bool) {
+		if p, ok := c.rules[n.Key]; ok {
+			return p(n), true
+		}
+		if c.literals[n.Key] {
+			return FoldCase(n), true
+		}
+		return nil, false
+	})
+}
+
+// Equal reports whether nodes have equal canonical forms.
+func (c *Canonicalizer) Equal(a, b *Node) bool {
+	return bytes.Equal(c.Canonical(a), c.Canonical(b))
+}
@@ -0,0 +1,70 @@
+package abnf_test
+
+import (
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// viaOp returns the operator of the rule:
+//
+//	via = "via" ":" *WSP word *(1*WSP word) [comment]
+//	word = 1*ALPHA
+//	comment = "(" *ALPHA ")"
+func viaOp() abnf.Operator {
+	core := abnf_core.Operators()
+	word := abnf.Repeat1Inf("word", core.ALPHA)
+	return abnf.Concat("via",
+		abnf.Literal(`"via"`, []byte("via")),
+		abnf.Literal(`":"`, []byte(":")),
+		abnf.Repeat0Inf("*WSP", core.WSP),
+		word,
+		abnf.Repeat0Inf("*(1*WSP word)", abnf.Concat("1*WSP word", abnf.Repeat1Inf("1*WSP", core.WSP), word)),
+		abnf.Optional("[comment]", abnf.Concat("comment",
+			abnf.Literal(`"("`, []byte("(")),
+			abnf.Repeat0Inf("*ALPHA", core.ALPHA),
+			abnf.Literal(`")"`, []byte(")")),
+		)),
+	)
+}
+
+func TestCanonicalizer(t *testing.T) {
+	cn := abnf.NewCanonicalizer()
+	cn.FoldLiterals(`"via"`)
+	cn.Rule("*WSP", abnf.Collapse([]byte(" ")))
+	cn.Rule("1*WSP", abnf.Collapse([]byte(" ")))
+	cn.Rule("comment", abnf.Drop)
+
+	parse := func(in string) *abnf.Node {
+		t.Helper()
+		ns := abnf.NewNodes()
+		defer ns.Free()
+		if err := abnf.Parse(viaOp(), []byte(in), ns); err != nil {
+			t.Fatalf("abnf.Parse(op, %q, ns) error = %v, want nil", in, err)
+		}
+		return ns.Best()
+	}
+
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"via: a b", "via: a b"},
+		{"VIA:\t a  \tb(note)", "via: a b"},
+		{"Via:a b", "via:a b"},
+	} {
+		if got := string(cn.Canonical(parse(c.in))); got != c.want {
+			t.Errorf("cn.Canonical(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+
+	if !cn.Equal(parse("via: a b"), parse("VIA:  a\tb()")) {
+		t.Errorf("cn.Equal(a, b) = false, want true")
+	}
+	if cn.Equal(parse("via: a b"), parse("via: a c")) {
+		t.Errorf("cn.Equal(a, b) = true, want false")
+	}
+	if got, want := string(abnf.NewCanonicalizer().Canonical(parse("VIA: a"))), "VIA: a"; got != want {
+		t.Errorf("empty canonicalizer: Canonical(in) = %q, want %q", got, want)
+	}
+}
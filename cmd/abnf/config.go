@@ -10,6 +10,10 @@ type config struct {
 	Inputs   []string `yaml:"inputs"`
 	Package  string   `yaml:"package"`
 	Output   string   `yaml:"output"`
+	Engine   string   `yaml:"engine"`
+	PEG      bool     `yaml:"peg"`
+	Prune    bool     `yaml:"prune"`
+	Predict  bool     `yaml:"predict"`
 	External []struct {
 		Path  string   `yaml:"path"`
 		Name  string   `yaml:"name"`
@@ -30,5 +34,11 @@ func parseConfig(raw []byte) (*config, error) {
 		return nil, fmt.Errorf("config's 'inputs' field is empty")
 	}
 
+	switch cfg.Engine {
+	case "", "closure", "vm":
+	default:
+		return nil, fmt.Errorf("config's 'engine' field is invalid: %q, expected 'closure' or 'vm'", cfg.Engine)
+	}
+
 	return &cfg, nil
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+	"github.com/ghettovoice/abnf/pkg/abnf_gen"
+)
+
+var defaultCollapsedRules = []string{"LWSP", "WSP"}
+
+func diffAction(_ context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return cli.Exit(fmt.Errorf("expected 2 input files, got %d", cmd.Args().Len()), 2)
+	}
+
+	// setup ParserGenerator
+	g := abnf_gen.ParserGenerator{External: make(map[string]abnf_gen.ExternalRule)}
+	for name, op := range abnf_core.OperatorsMap() {
+		g.External[name] = abnf_gen.ExternalRule{Operator: op}
+	}
+
+	// read, parse grammar ABNF files
+	var errs []error
+	for _, in := range cmd.StringSlice("grammar") {
+		fd, err := os.Open(in)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("open ABNF file: %w", err))
+			continue
+		}
+
+		if _, err = g.ReadFrom(fd); err != nil {
+			fd.Close() //nolint:errcheck
+			errs = append(errs, fmt.Errorf("parse ABNF file %s: %w", in, err))
+			continue
+		}
+
+		fd.Close() //nolint:errcheck
+
+		if cmd.Bool("verbose") {
+			fmt.Printf("ABNF file %s parsed\n", in)
+		}
+	}
+	if len(errs) > 0 {
+		return cli.Exit(errors.Join(errs...), 2)
+	}
+
+	rule := cmd.String("rule")
+	op, ok := g.Operators()[rule]
+	if !ok {
+		return cli.Exit(fmt.Errorf("rule '%s' not found", rule), 2)
+	}
+
+	// parse input files
+	var nodes [2]*abnf.Node
+	for i, in := range cmd.Args().Slice() {
+		n, err := parseFile(op, in)
+		if err != nil {
+			return cli.Exit(err, 2)
+		}
+		nodes[i] = n
+	}
+
+	// compare rule-level nodes of parsed inputs
+	var keys []string
+	for _, name := range g.RuleNames() {
+		if _, ok := g.External[name]; !ok {
+			keys = append(keys, name)
+		}
+	}
+
+	c := abnf.NewCanonicalizer()
+	if cmd.Bool("fold-literals") {
+		c.FoldLiterals(g.LiteralKeys()...)
+	}
+	for _, name := range cmd.StringSlice("collapse") {
+		c.Rule(name, abnf.Collapse([]byte(" ")))
+	}
+	for _, name := range cmd.StringSlice("ignore") {
+		c.Rule(name, abnf.Drop)
+	}
+
+	diffs := abnf.Diff(nodes[0], nodes[1], abnf.KeepKeys(keys...), c)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+func parseFile(op abnf.Operator, path string) (*abnf.Node, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read input file: %w", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(op, buf, ns); err != nil {
+		return nil, fmt.Errorf("parse input file %s: %w", path, err)
+	}
+	i := slices.IndexFunc(ns.All(), func(n *abnf.Node) bool { return n.Len() == len(buf) })
+	if i < 0 {
+		return nil, fmt.Errorf("parse input file %s: only %d of %d bytes matched", path, ns.Best().Len(), len(buf))
+	}
+	return ns.All()[i], nil
+}
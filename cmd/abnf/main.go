@@ -17,6 +17,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
 	"github.com/ghettovoice/abnf/pkg/abnf_gen"
 )
 
@@ -71,6 +72,40 @@ func main() {
 				Usage:   "generates Go sources from ABNF rules without yaml config",
 				Action:  generateAction2,
 			},
+			{
+				Name:  "diff",
+				Usage: "compares two inputs parsed with an ABNF rule",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "grammar",
+						Aliases:  []string{"g"},
+						Usage:    "path to the ABNF file with grammar rules, may be repeated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "rule",
+						Aliases:  []string{"r"},
+						Usage:    "name of the rule to parse inputs with",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:  "ignore",
+						Usage: "name of the rule whose values are ignored, may be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "collapse",
+						Usage: "name of the rule whose non-empty values are compared as a single space, may be repeated",
+						Value: defaultCollapsedRules,
+					},
+					&cli.BoolFlag{
+						Name:  "fold-literals",
+						Usage: "compares case-insensitive literals case-insensitively, disable with --fold-literals=false",
+						Value: true,
+					},
+				},
+				ArgsUsage: "<old> <new>",
+				Action:    diffAction,
+			},
 		},
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
@@ -191,6 +226,12 @@ func generateAction(_ context.Context, cmd *cli.Command) error {
 	var errs []error
 	g := abnf_gen.CodeGenerator{
 		PackageName: cfg.Package,
+		PEG:         cfg.PEG,
+		Prune:       cfg.Prune,
+		Predict:     cfg.Predict,
+	}
+	if cfg.Engine == "vm" {
+		g.Engine = abnf_gen.EngineVM
 	}
 	if len(cfg.External) > 0 {
 		g.External = make(map[string]abnf_gen.ExternalRule)
@@ -204,6 +245,7 @@ func generateAction(_ context.Context, cmd *cli.Command) error {
 				g.External[rule] = abnf_gen.ExternalRule{
 					PackagePath: entry.Path,
 					PackageName: entry.Name,
+					First:       externalFirst(entry.Path, rule),
 				}
 
 				if cmd.Bool("verbose") {
@@ -281,6 +323,20 @@ func generateAction(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+const corePkgPath = "github.com/ghettovoice/abnf/pkg/abnf_core"
+
+// externalFirst returns the FIRST set of the external rule if it's known, i.e. for rules of abnf_core.
+// Generated packages publish FIRST sets of their rules, but they can't be loaded by the CLI.
+func externalFirst(path, rule string) *abnf.ByteSet {
+	if path != corePkgPath {
+		return nil
+	}
+	if set, ok := abnf_core.FirstMap()[rule]; ok {
+		return &set
+	}
+	return nil
+}
+
 var externalCore = []string{
 	"ALPHA", "BIT", "CHAR", "CR",
 	"CRLF", "CTL", "DIGIT", "DQUOTE",
@@ -311,8 +367,9 @@ func generateAction2(_ context.Context, cmd *cli.Command) error {
 	g.External = make(map[string]abnf_gen.ExternalRule)
 	for _, rule := range externalCore {
 		g.External[rule] = abnf_gen.ExternalRule{
-			PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
+			PackagePath: corePkgPath,
 			PackageName: "abnf_core",
+			First:       externalFirst(corePkgPath, rule),
 		}
 	}
 
@@ -345,6 +402,7 @@ func generateAction2(_ context.Context, cmd *cli.Command) error {
 				g.External[rule] = abnf_gen.ExternalRule{
 					PackagePath: moreExt.Path,
 					PackageName: moreExt.Name,
+					First:       externalFirst(moreExt.Path, rule),
 				}
 			}
 		}
@@ -0,0 +1,207 @@
+package abnf
+
+import "fmt"
+
+// DiffKind is a kind of [Difference].
+type DiffKind uint8
+
+const (
+	// DiffAdded means the node is present only in the new tree.
+	DiffAdded DiffKind = iota + 1
+	// DiffRemoved means the node is present only in the old tree.
+	DiffRemoved
+	// DiffChanged means the node is present in both trees with different values.
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", k)
+	}
+}
+
+// Difference describes a difference of two trees found by [Diff].
+type Difference struct {
+	Kind DiffKind
+	// Path is the slash-separated path of the node from the root,
+	// each element is a node key with its index among siblings with the same key, e.g. "message/header[2]".
+	// Indexes of added nodes are indexes in the new tree, otherwise in the old tree.
+	Path string
+	// Old is the node of the old tree, nil for added nodes.
+	Old *Node
+	// New is the node of the new tree, nil for removed nodes.
+	New *Node
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("%s %s: %q", d.Kind, d.Path, d.New.Value)
+	case DiffRemoved:
+		return fmt.Sprintf("%s %s: %q", d.Kind, d.Path, d.Old.Value)
+	default:
+		return fmt.Sprintf("%s %s: %q -> %q", d.Kind, d.Path, d.Old.Value, d.New.Value)
+	}
+}
+
+// Diff compares trees a and b parsed with the same rule and returns their differences.
+//
+// Only nodes accepted by keep are compared, usually rule-level nodes, see [KeepKeys].
+// Other nodes are transparent, their kept descendants are compared as children of the closest kept ancestor.
+// If keep is nil, all nodes are compared.
+//
+// Nodes are compared by canonical forms of their values, see [Canonicalizer],
+// so differences insignificant for the grammar, like whitespace or case of case-insensitive literals, are ignored.
+// If c is nil, values are compared as is.
+//
+// Children of differing nodes are aligned by the longest common subsequence of their keys and values,
+// unaligned children with the same key are compared recursively, the rest are reported as added or removed.
+// A differing node is reported as changed only if no difference of its children is found.
+func Diff(a, b *Node, keep func(n *Node) bool, c *Canonicalizer) []Difference {
+	if keep == nil {
+		keep = func(*Node) bool { return true }
+	}
+	if c == nil {
+		c = NewCanonicalizer()
+	}
+
+	d := &differ{keep: keep, c: c}
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		d.add(DiffAdded, b.Key, nil, b)
+	case b == nil:
+		d.add(DiffRemoved, a.Key, a, nil)
+	default:
+		d.diff(a.Key, a, b, string(c.Canonical(a)), string(c.Canonical(b)))
+	}
+	return d.res
+}
+
+type differ struct {
+	keep func(n *Node) bool
+	c    *Canonicalizer
+	res  []Difference
+}
+
+func (d *differ) add(kind DiffKind, path string, a, b *Node) {
+	d.res = append(d.res, Difference{Kind: kind, Path: path, Old: a, New: b})
+}
+
+func (d *differ) diff(path string, a, b *Node, ca, cb string) {
+	if a.Key == b.Key && ca == cb {
+		return
+	}
+	if a.Key != b.Key {
+		d.add(DiffChanged, path, a, b)
+		return
+	}
+
+	n := len(d.res)
+	d.diffChildren(path, d.children(a, nil), d.children(b, nil))
+	if len(d.res) == n {
+		d.add(DiffChanged, path, a, b)
+	}
+}
+
+// children returns the closest kept descendants of n.
+func (d *differ) children(n *Node, res Nodes) Nodes {
+	for _, chn := range n.Children {
+		if d.keep(chn) {
+			res = append(res, chn)
+		} else {
+			res = d.children(chn, res)
+		}
+	}
+	return res
+}
+
+type diffNode struct {
+	n     *Node
+	path  string
+	canon string
+}
+
+func (d *differ) diffNodes(path string, ns Nodes) []diffNode {
+	idxs := make(map[string]int)
+	res := make([]diffNode, len(ns))
+	for i, n := range ns {
+		res[i] = diffNode{
+			n:     n,
+			path:  fmt.Sprintf("%s/%s[%d]", path, n.Key, idxs[n.Key]),
+			canon: string(d.c.Canonical(n)),
+		}
+		idxs[n.Key]++
+	}
+	return res
+}
+
+func (d *differ) diffChildren(path string, as, bs Nodes) {
+	das, dbs := d.diffNodes(path, as), d.diffNodes(path, bs)
+	eq := func(i, j int) bool {
+		return das[i].n.Key == dbs[j].n.Key && das[i].canon == dbs[j].canon
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of das[i:] and dbs[j:]
+	lcs := make([][]int, len(das)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(dbs)+1)
+	}
+	for i := len(das) - 1; i >= 0; i-- {
+		for j := len(dbs) - 1; j >= 0; j-- {
+			if eq(i, j) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var i, j, i0, j0 int
+	for i < len(das) && j < len(dbs) {
+		switch {
+		case eq(i, j):
+			d.diffGap(das[i0:i], dbs[j0:j])
+			i++
+			j++
+			i0, j0 = i, j
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	d.diffGap(das[i0:], dbs[j0:])
+}
+
+// diffGap compares unaligned nodes, nodes with the same key are paired in order.
+func (d *differ) diffGap(das, dbs []diffNode) {
+	paired := make([]bool, len(dbs))
+	for _, da := range das {
+		j := -1
+		for k, db := range dbs {
+			if !paired[k] && db.n.Key == da.n.Key {
+				j = k
+				break
+			}
+		}
+		if j < 0 {
+			d.add(DiffRemoved, da.path, da.n, nil)
+			continue
+		}
+		paired[j] = true
+		d.diff(da.path, da.n, dbs[j].n, da.canon, dbs[j].canon)
+	}
+	for k, db := range dbs {
+		if !paired[k] {
+			d.add(DiffAdded, db.path, nil, db.n)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package abnf_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// pairsOp returns the operator of the rule:
+//
+//	list = pair *("," *WSP pair)
+//	pair = name "=" value
+//	name = 1*ALPHA
+//	value = 1*ALPHA
+func pairsOp() abnf.Operator {
+	core := abnf_core.Operators()
+	pair := abnf.Concat("pair",
+		abnf.Repeat1Inf("name", core.ALPHA),
+		abnf.Literal(`"="`, []byte("=")),
+		abnf.Repeat1Inf("value", core.ALPHA),
+	)
+	return abnf.Concat("list",
+		pair,
+		abnf.Repeat0Inf(`*("," *WSP pair)`, abnf.Concat(`"," *WSP pair`,
+			abnf.Literal(`","`, []byte(",")),
+			abnf.Repeat0Inf("*WSP", core.WSP),
+			pair,
+		)),
+	)
+}
+
+func TestDiff(t *testing.T) {
+	cn := abnf.NewCanonicalizer()
+	cn.Rule("*WSP", abnf.Drop)
+	keep := abnf.KeepKeys("pair", "name", "value")
+
+	parse := func(in string) *abnf.Node {
+		t.Helper()
+		ns := abnf.NewNodes()
+		defer ns.Free()
+		if err := abnf.Parse(pairsOp(), []byte(in), ns); err != nil {
+			t.Fatalf("abnf.Parse(op, %q, ns) error = %v, want nil", in, err)
+		}
+		return ns.Best()
+	}
+
+	for _, c := range []struct {
+		name string
+		a, b string
+		keep func(n *abnf.Node) bool
+		want []string
+	}{
+		{name: "equal", a: "a=x, b=y", b: "a=x,\tb=y", keep: keep},
+		{
+			name: "changed",
+			a:    "a=x, b=y",
+			b:    "a=x, b=z",
+			keep: keep,
+			want: []string{`changed list/pair[1]/value[0]: "y" -> "z"`},
+		},
+		{
+			name: "added",
+			a:    "a=x, c=z",
+			b:    "a=x, b=y, c=z, d=w",
+			keep: keep,
+			want: []string{`added list/pair[1]: "b=y"`, `added list/pair[3]: "d=w"`},
+		},
+		{
+			name: "removed",
+			a:    "a=x, b=y, c=z",
+			b:    "a=x, c=z",
+			keep: keep,
+			want: []string{`removed list/pair[1]: "b=y"`},
+		},
+		{
+			name: "changed children",
+			a:    "a=x",
+			b:    "b=y",
+			keep: keep,
+			want: []string{
+				`changed list/pair[0]/name[0]: "a" -> "b"`,
+				`changed list/pair[0]/value[0]: "x" -> "y"`,
+			},
+		},
+		{
+			name: "not kept",
+			a:    "a=x",
+			b:    "b=y",
+			keep: abnf.KeepKeys("list"),
+			want: []string{`changed list: "a=x" -> "b=y"`},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, d := range abnf.Diff(parse(c.a), parse(c.b), c.keep, cn) {
+				got = append(got, d.String())
+			}
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("abnf.Diff(a, b, keep, cn) mismatch (-got +want):\n%s", cmp.Diff(got, c.want))
+			}
+		})
+	}
+
+	if got := abnf.Diff(parse("a=x, b=y"), parse("a=x,b=y"), nil, nil); len(got) == 0 {
+		t.Fatalf("abnf.Diff(a, b, nil, nil) = %v, want whitespace differences", got)
+	}
+}
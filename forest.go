@@ -0,0 +1,409 @@
+package abnf
+
+import (
+	"cmp"
+	"encoding/binary"
+	"iter"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// Forest is a shared packed parse forest: a compact representation of many parse trees of the same input.
+// Equal subtrees are stored once and alternative derivations of the same match are packed
+// into a single forest node, so the forest size stays polynomial even if the number of trees is exponential.
+//
+// Forest nodes are either keyed nodes that become [Node] values of parse trees,
+// intermediate nodes whose children are spliced into the parent, or leaves that keep the given node as is.
+//
+// Forests are built by parsers while they parse, e.g. from the chart of the Earley parser of the abnf_earley package,
+// with [ForestBuilder], so parse trees are never materialized before they are packed.
+//
+// Forest is read-only, it is safe to use it from multiple goroutines.
+type Forest struct {
+	in    []byte
+	nodes []forestNode
+	roots []ForestID
+}
+
+// ForestID identifies a node of a forest.
+type ForestID int32
+
+type forestNode struct {
+	key      string
+	pos, end uint
+	// keyed is false for intermediate nodes.
+	keyed bool
+	leaf  *Node
+	// packs are alternative lists of children.
+	packs [][]ForestID
+}
+
+type forestKey struct {
+	key      string
+	pos, end uint
+}
+
+// ForestBuilder builds a forest of the input.
+type ForestBuilder struct {
+	f      *Forest
+	keyed  map[forestKey]ForestID
+	leaves map[*Node]ForestID
+	packs  map[ForestID]map[string]bool
+}
+
+// NewForestBuilder returns a builder of a forest of in.
+func NewForestBuilder(in []byte) *ForestBuilder {
+	return &ForestBuilder{
+		f:      &Forest{in: in},
+		keyed:  make(map[forestKey]ForestID),
+		leaves: make(map[*Node]ForestID),
+		packs:  make(map[ForestID]map[string]bool),
+	}
+}
+
+func (b *ForestBuilder) add(n forestNode) ForestID {
+	b.f.nodes = append(b.f.nodes, n)
+	return ForestID(len(b.f.nodes) - 1)
+}
+
+// Node returns the keyed node matching input from pos to end, the node is created once per key and bounds.
+func (b *ForestBuilder) Node(key string, pos, end uint) ForestID {
+	k := forestKey{key, pos, end}
+	if id, ok := b.keyed[k]; ok {
+		return id
+	}
+	id := b.add(forestNode{key: key, pos: pos, end: end, keyed: true})
+	b.keyed[k] = id
+	return id
+}
+
+// Intermediate returns a new intermediate node matching input from pos to end.
+// Children of intermediate nodes are spliced into their parents in parse trees.
+func (b *ForestBuilder) Intermediate(pos, end uint) ForestID {
+	return b.add(forestNode{pos: pos, end: end})
+}
+
+// Leaf returns the node that represents n in parse trees as is.
+func (b *ForestBuilder) Leaf(n *Node) ForestID {
+	if id, ok := b.leaves[n]; ok {
+		return id
+	}
+	id := b.add(forestNode{key: n.Key, pos: n.Pos, end: n.Pos + uint(n.Len()), keyed: true, leaf: n})
+	b.leaves[n] = id
+	return id
+}
+
+// Pack adds the children list to the node id as an alternative derivation.
+// Duplicate lists are ignored, leaves can't have children.
+func (b *ForestBuilder) Pack(id ForestID, children ...ForestID) {
+	if b.f.nodes[id].leaf != nil {
+		return
+	}
+
+	buf := make([]byte, 0, 4*len(children))
+	for _, c := range children {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(c))
+	}
+	seen := b.packs[id]
+	if seen == nil {
+		seen = make(map[string]bool)
+		b.packs[id] = seen
+	}
+	if seen[string(buf)] {
+		return
+	}
+	seen[string(buf)] = true
+	b.f.nodes[id].packs = append(b.f.nodes[id].packs, slices.Clone(children))
+}
+
+// Build returns the forest with roots.
+// Roots should be keyed nodes or leaves, the builder must not be used after Build.
+func (b *ForestBuilder) Build(roots ...ForestID) *Forest {
+	f := b.f
+	for _, id := range roots {
+		if !slices.Contains(f.roots, id) {
+			f.roots = append(f.roots, id)
+		}
+	}
+	b.f = nil
+	return f
+}
+
+// Input returns the parsed input.
+func (f *Forest) Input() []byte {
+	if f == nil {
+		return nil
+	}
+	return f.in
+}
+
+// Len returns the number of forest nodes.
+func (f *Forest) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.nodes)
+}
+
+// inProgress marks counts being computed, reaching it again means a cycle.
+const inProgress = math.MaxUint64 - 1
+
+// Count returns the number of parse trees.
+// It saturates at [math.MaxUint64], which is also returned if the forest has cycles
+// that allow infinitely many trees.
+func (f *Forest) Count() uint64 {
+	if f == nil {
+		return 0
+	}
+
+	memo := make(map[ForestID]uint64)
+	var n uint64
+	for _, id := range f.roots {
+		n = addSat(n, f.count(memo, false, id, true))
+	}
+	return n
+}
+
+// count counts derivations of the node id.
+// If local is true, derivations of keyed nodes other than the top one count as one.
+func (f *Forest) count(memo map[ForestID]uint64, local bool, id ForestID, top bool) uint64 {
+	fn := &f.nodes[id]
+	if fn.leaf != nil || local && !top && fn.keyed {
+		return 1
+	}
+
+	if n, ok := memo[id]; ok {
+		if n == inProgress {
+			return math.MaxUint64
+		}
+		return n
+	}
+	memo[id] = inProgress
+
+	var n uint64
+	for _, pack := range fn.packs {
+		c := uint64(1)
+		for _, ch := range pack {
+			if c = mulSat(c, f.count(memo, local, ch, false)); c == 0 {
+				break
+			}
+		}
+		n = addSat(n, c)
+	}
+	memo[id] = n
+	return n
+}
+
+func addSat(a, b uint64) uint64 {
+	s, c := bits.Add64(a, b, 0)
+	if c != 0 {
+		return math.MaxUint64
+	}
+	return s
+}
+
+func mulSat(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	if hi != 0 {
+		return math.MaxUint64
+	}
+	return lo
+}
+
+// Trees returns an iterator over all parse trees.
+// Trees are built lazily, derivations through cycles are skipped, so the iteration is always finite.
+func (f *Forest) Trees() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		if f == nil {
+			return
+		}
+
+		active := make(map[ForestID]bool)
+		for _, id := range f.roots {
+			ok := f.each(active, id, func(ns Nodes) bool {
+				for _, n := range ns {
+					if !yield(n) {
+						return false
+					}
+				}
+				return true
+			})
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// each calls yield with nodes of every derivation of the node id.
+// Keyed nodes and leaves produce a single node, intermediate nodes produce their children.
+func (f *Forest) each(active map[ForestID]bool, id ForestID, yield func(Nodes) bool) bool {
+	fn := &f.nodes[id]
+	if fn.leaf != nil {
+		return yield(Nodes{fn.leaf})
+	}
+	if active[id] {
+		return true
+	}
+	active[id] = true
+	defer delete(active, id)
+
+	for _, pack := range fn.packs {
+		ok := f.eachSeq(active, pack, nil, func(ns Nodes) bool {
+			if !fn.keyed {
+				return yield(ns)
+			}
+			return yield(Nodes{f.newNode(fn, slices.Clone(ns))})
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// eachSeq calls yield with pre followed by nodes of every derivation of the nodes sequence ids.
+func (f *Forest) eachSeq(active map[ForestID]bool, ids []ForestID, pre Nodes, yield func(Nodes) bool) bool {
+	if len(ids) == 0 {
+		return yield(pre)
+	}
+	pre = slices.Clip(pre)
+	return f.each(active, ids[0], func(ns Nodes) bool {
+		return f.eachSeq(active, ids[1:], append(pre, ns...), yield)
+	})
+}
+
+func (f *Forest) newNode(fn *forestNode, children Nodes) *Node {
+	return &Node{
+		Key:      fn.key,
+		Pos:      fn.pos,
+		Value:    f.in[fn.pos:fn.end],
+		Children: children,
+	}
+}
+
+// Best returns the most preferred tree according to [PolicyLongest] or nil if the forest is empty.
+func (f *Forest) Best() *Node {
+	return f.BestBy(PolicyLongest)
+}
+
+// BestBy returns the most preferred tree according to the policy p or nil if the forest is empty.
+// Alternatives are picked bottom-up: every packed node keeps its most preferred derivation,
+// so only a single candidate per alternative is built.
+func (f *Forest) BestBy(p Policy) *Node {
+	if f == nil {
+		return nil
+	}
+
+	var (
+		memo   = make(map[ForestID]Nodes)
+		active = make(map[ForestID]bool)
+		cands  Nodes
+	)
+	for _, id := range f.roots {
+		if ns, ok := f.best(memo, active, p, id); ok {
+			cands = append(cands, ns...)
+		}
+	}
+	return cands.BestBy(p)
+}
+
+// best returns nodes of the most preferred derivation of the node id.
+func (f *Forest) best(memo map[ForestID]Nodes, active map[ForestID]bool, p Policy, id ForestID) (Nodes, bool) {
+	fn := &f.nodes[id]
+	if fn.leaf != nil {
+		return Nodes{fn.leaf}, true
+	}
+	if ns, ok := memo[id]; ok {
+		return ns, true
+	}
+	if active[id] {
+		return nil, false
+	}
+	active[id] = true
+	defer delete(active, id)
+
+	var cands Nodes
+	for _, pack := range fn.packs {
+		var children Nodes
+		ok := true
+		for _, ch := range pack {
+			var ns Nodes
+			if ns, ok = f.best(memo, active, p, ch); !ok {
+				break
+			}
+			children = append(children, ns...)
+		}
+		if ok {
+			// intermediate candidates are compared as nodes too, their children are spliced below
+			cands = append(cands, f.newNode(fn, children))
+		}
+	}
+	if len(cands) == 0 {
+		return nil, false
+	}
+
+	n := cands.BestBy(p)
+	res := Nodes{n}
+	if !fn.keyed {
+		res = n.Children
+	}
+	memo[id] = res
+	return res, true
+}
+
+// Ambiguity is a match with more than one derivation.
+type Ambiguity struct {
+	// Key is the key of the ambiguous node.
+	Key string
+	// Pos and End are bounds of the match in the input.
+	Pos, End uint
+	// Count is the number of derivations with derivations of nested keyed nodes fixed.
+	Count uint64
+}
+
+// Ambiguities returns all ambiguous keyed nodes reachable from roots in order of their positions.
+// Ambiguities of nested nodes are reported separately and don't multiply counts of enclosing nodes.
+func (f *Forest) Ambiguities() []Ambiguity {
+	if f == nil {
+		return nil
+	}
+
+	var (
+		res  []Ambiguity
+		memo = make(map[ForestID]uint64)
+		seen = make(map[ForestID]bool)
+		walk func(id ForestID)
+	)
+	walk = func(id ForestID) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+
+		fn := &f.nodes[id]
+		if fn.keyed && fn.leaf == nil {
+			// nested keyed nodes count as one before the memo lookup, so the memo is shared
+			if n := f.count(memo, true, id, true); n > 1 {
+				res = append(res, Ambiguity{fn.key, fn.pos, fn.end, n})
+			}
+		}
+		for _, pack := range fn.packs {
+			for _, ch := range pack {
+				walk(ch)
+			}
+		}
+	}
+	for _, id := range f.roots {
+		walk(id)
+	}
+
+	slices.SortStableFunc(res, func(a, b Ambiguity) int {
+		if c := cmp.Compare(a.Pos, b.Pos); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.End, a.End)
+	})
+	return res
+}
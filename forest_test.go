@@ -0,0 +1,109 @@
+package abnf_test
+
+import (
+	"math"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+)
+
+func TestForest(t *testing.T) {
+	in := []byte("aaa")
+	leaf := func(pos uint) *abnf.Node {
+		return &abnf.Node{Key: "a", Pos: pos, Value: in[pos : pos+1]}
+	}
+	pair := func(pos uint) *abnf.Node {
+		return &abnf.Node{Key: "p", Pos: pos, Value: in[pos : pos+2], Children: abnf.Nodes{leaf(pos), leaf(pos + 1)}}
+	}
+	single := func(pos uint) *abnf.Node {
+		return &abnf.Node{Key: "p", Pos: pos, Value: in[pos : pos+1], Children: abnf.Nodes{leaf(pos)}}
+	}
+	ns := abnf.Nodes{
+		{Key: "s", Value: in, Children: abnf.Nodes{single(0), pair(1)}},
+		{Key: "s", Value: in, Children: abnf.Nodes{pair(0), single(2)}},
+	}
+
+	// s = p p, p = 1*2a, a = "a" as packed by a parser
+	b := abnf.NewForestBuilder(in)
+	a := func(pos uint) abnf.ForestID {
+		id := b.Node("a", pos, pos+1)
+		b.Pack(id)
+		return id
+	}
+	p := func(pos, end uint) abnf.ForestID {
+		id := b.Node("p", pos, end)
+		var children []abnf.ForestID
+		for i := pos; i < end; i++ {
+			children = append(children, a(i))
+		}
+		b.Pack(id, children...)
+		return id
+	}
+	s := b.Node("s", 0, 3)
+	b.Pack(s, p(0, 1), p(1, 3))
+	b.Pack(s, p(0, 2), p(2, 3))
+
+	f := b.Build(s)
+	if got, want := f.Count(), uint64(2); got != want {
+		t.Fatalf("f.Count() = %d, want %d", got, want)
+	}
+	// s, 4 p nodes and 3 a nodes
+	if got, want := f.Len(), 8; got != want {
+		t.Errorf("f.Len() = %d, want %d", got, want)
+	}
+
+	var got abnf.Nodes
+	for n := range f.Trees() {
+		got = append(got, n)
+	}
+	if !gocmp.Equal(got, ns) {
+		t.Errorf("f.Trees() mismatch (-got +want):\n%s", gocmp.Diff(got, ns))
+	}
+
+	if got, want := f.BestBy(abnf.PolicyFirst), ns[0]; !gocmp.Equal(got, want) {
+		t.Errorf("f.BestBy(abnf.PolicyFirst) = %+v, want %+v", got, want)
+	}
+
+	if got, want := f.Ambiguities(), []abnf.Ambiguity{{Key: "s", Pos: 0, End: 3, Count: 2}}; !gocmp.Equal(got, want) {
+		t.Errorf("f.Ambiguities() = %+v, want %+v", got, want)
+	}
+}
+
+func TestForestBuilder(t *testing.T) {
+	in := []byte("ab")
+	b := abnf.NewForestBuilder(in)
+
+	// x = x / "a" "b" with "a" "b" packed into an intermediate node
+	x := b.Node("x", 0, 2)
+	seq := b.Intermediate(0, 2)
+	b.Pack(seq, b.Leaf(&abnf.Node{Key: `"a"`, Value: in[:1]}), b.Leaf(&abnf.Node{Key: `"b"`, Pos: 1, Value: in[1:]}))
+	b.Pack(x, x)
+	b.Pack(x, seq)
+	b.Pack(x, seq)
+
+	f := b.Build(x)
+	if got := f.Count(); got != math.MaxUint64 {
+		t.Fatalf("f.Count() = %d, want %d", got, uint64(math.MaxUint64))
+	}
+
+	want := &abnf.Node{
+		Key:   "x",
+		Value: in,
+		Children: abnf.Nodes{
+			{Key: `"a"`, Value: in[:1]},
+			{Key: `"b"`, Pos: 1, Value: in[1:]},
+		},
+	}
+	var got abnf.Nodes
+	for n := range f.Trees() {
+		got = append(got, n)
+	}
+	if !gocmp.Equal(got, abnf.Nodes{want}) {
+		t.Errorf("f.Trees() mismatch (-got +want):\n%s", gocmp.Diff(got, abnf.Nodes{want}))
+	}
+	if got := f.Best(); !gocmp.Equal(got, want) {
+		t.Errorf("f.Best() mismatch (-got +want):\n%s", gocmp.Diff(got, want))
+	}
+}
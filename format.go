@@ -0,0 +1,200 @@
+package abnf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ErrFormatMismatch is returned by [Formatter.FormatCheck] when the formatted output isn't matched by the grammar.
+const ErrFormatMismatch sentinelError = "formatted output doesn't match"
+
+// Layout is a layout rule of nodes formatted by [Formatter].
+type Layout struct {
+	// Value, if not nil, replaces the node value, e.g. [Collapse] of whitespace or [Drop] of comments,
+	// descendants of the node aren't formatted then.
+	Value CanonicalPolicy
+	// Before and After are emitted before and after the node.
+	Before, After string
+	// LineBefore and LineAfter start a new line before and after the node, unless the line is just started.
+	LineBefore, LineAfter bool
+	// Indent is appended to the indentation of lines started inside the node.
+	Indent string
+	// Break allows to start a new line before the node if the line exceeds the width, see [Formatter.Width].
+	Break bool
+}
+
+// Formatter re-emits parsed documents with layout rules configured per node key, usually per rule name.
+// Octets of nodes without layout rules are kept as is.
+//
+// Line breaks and indentation are inserted only where layout rules say so,
+// so rules must be configured for places where the grammar allows line breaks,
+// e.g. before folding whitespace of RFC 5322 headers. Trailing spaces and tabs are trimmed before inserted line breaks.
+// Formatter doesn't check that the output is still matched by the grammar, use [Formatter.FormatCheck] for it.
+//
+// Line breaks of the input are kept as is and aren't followed by [Layout.Indent],
+// indentation is emitted only after inserted line breaks. Set a [Layout.Value] of rules that match line breaks,
+// e.g. [Drop] or [Collapse], to replace them with inserted ones.
+//
+// Formatter is safe for concurrent use once configured.
+type Formatter struct {
+	layouts map[string]Layout
+	width   int
+	newline string
+}
+
+// NewFormatter returns a formatter with the given layout rules of node keys.
+func NewFormatter(layouts map[string]Layout) *Formatter {
+	return &Formatter{layouts: layouts, newline: "\n"}
+}
+
+// Width sets the maximum line width in octets, lines are broken before nodes with [Layout.Break] to fit it.
+// Zero disables wrapping, it's the default.
+// It must be called before the formatter is used.
+func (f *Formatter) Width(n int) {
+	f.width = n
+}
+
+// Newline sets the line break, "\n" by default, e.g. "\r\n" for RFC 5322 messages.
+// It must be called before the formatter is used.
+func (f *Formatter) Newline(s string) {
+	f.newline = s
+}
+
+type segmentKind uint8
+
+const (
+	segText segmentKind = iota
+	segLine
+	segBreak
+)
+
+type segment struct {
+	kind segmentKind
+	// text is the text of segText or the indentation of segLine and segBreak.
+	text []byte
+}
+
+// Format returns the formatted node value.
+func (f *Formatter) Format(n *Node) []byte {
+	if n == nil {
+		return nil
+	}
+	return f.render(f.segments(n, nil, nil))
+}
+
+// FormatCheck returns the formatted node value like [Formatter.Format] does
+// and checks that the output is entirely matched by op, which should be the operator n was parsed with.
+// Options apply to the parse of the output, see [Parse].
+// It returns an error wrapping [ErrFormatMismatch] if layout rules produced the output the grammar doesn't allow.
+func (f *Formatter) FormatCheck(op Operator, n *Node, opts ...ParseOption) ([]byte, error) {
+	out := f.Format(n)
+
+	ns := NewNodes()
+	defer ns.Free()
+
+	if err := Parse(op, out, ns, opts...); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFormatMismatch, err)
+	}
+	for _, m := range ns.All() {
+		if m.Len() == len(out) {
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: only %d of %d octets matched", ErrFormatMismatch, ns.Best().Len(), len(out))
+}
+
+func (f *Formatter) segments(n *Node, indent []byte, segs []segment) []segment {
+	l, ok := f.layouts[n.Key]
+	if !ok {
+		return f.children(n, indent, segs)
+	}
+
+	if l.LineBefore {
+		segs = append(segs, segment{segLine, indent})
+	}
+	if l.Break {
+		segs = append(segs, segment{segBreak, indent})
+	}
+	segs = appendText(segs, []byte(l.Before))
+	if l.Value != nil {
+		segs = appendText(segs, l.Value(n))
+	} else {
+		segs = f.children(n, append(indent[:len(indent):len(indent)], l.Indent...), segs)
+	}
+	segs = appendText(segs, []byte(l.After))
+	if l.LineAfter {
+		segs = append(segs, segment{segLine, indent})
+	}
+	return segs
+}
+
+func (f *Formatter) children(n *Node, indent []byte, segs []segment) []segment {
+	pos := n.Pos
+	for _, chn := range n.Children {
+		if chn.Pos < pos {
+			// malformed node out of the parent span
+			continue
+		}
+		segs = appendText(segs, n.Value[pos-n.Pos:chn.Pos-n.Pos])
+		segs = f.segments(chn, indent, segs)
+		pos = chn.Pos + uint(chn.Len())
+	}
+	return appendText(segs, n.Value[pos-n.Pos:])
+}
+
+func appendText(segs []segment, text []byte) []segment {
+	if len(text) == 0 {
+		return segs
+	}
+	return append(segs, segment{segText, text})
+}
+
+func (f *Formatter) render(segs []segment) []byte {
+	var out []byte
+	// col is the current column, start is true right after a started line
+	col, start := 0, true
+
+	newline := func(indent []byte) {
+		out = bytes.TrimRight(out, " \t")
+		out = append(out, f.newline...)
+		out = append(out, indent...)
+		col, start = len(indent), true
+	}
+
+	for i, seg := range segs {
+		switch seg.kind {
+		case segText:
+			out = append(out, seg.text...)
+			if j := bytes.LastIndexByte(seg.text, '\n'); j >= 0 {
+				col = len(seg.text) - j - 1
+			} else {
+				col += len(seg.text)
+			}
+			start = col == 0
+		case segLine:
+			if !start {
+				newline(seg.text)
+			}
+		case segBreak:
+			if !start && f.width > 0 && col+f.wordLen(segs[i+1:]) > f.width {
+				newline(seg.text)
+			}
+		}
+	}
+	return out
+}
+
+// wordLen returns the length of text up to the next line start or break opportunity.
+func (f *Formatter) wordLen(segs []segment) int {
+	var n int
+	for _, seg := range segs {
+		if seg.kind != segText {
+			break
+		}
+		if j := bytes.IndexByte(seg.text, '\n'); j >= 0 {
+			return n + len(bytes.TrimSuffix(seg.text[:j], []byte("\r")))
+		}
+		n += len(seg.text)
+	}
+	return n
+}
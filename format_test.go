@@ -0,0 +1,179 @@
+package abnf_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+func TestFormatter(t *testing.T) {
+	parse := func(op abnf.Operator, in string) *abnf.Node {
+		t.Helper()
+		ns := abnf.NewNodes()
+		defer ns.Free()
+		if err := abnf.Parse(op, []byte(in), ns); err != nil {
+			t.Fatalf("abnf.Parse(op, %q, ns) error = %v, want nil", in, err)
+		}
+		return ns.Best()
+	}
+
+	for _, c := range []struct {
+		name    string
+		layouts map[string]abnf.Layout
+		width   int
+		in      string
+		want    string
+	}{
+		{
+			name: "as is",
+			in:   "a=x,b=y,  c=z",
+			want: "a=x,b=y,  c=z",
+		},
+		{
+			name: "lines",
+			layouts: map[string]abnf.Layout{
+				"list": {Before: "{", After: "\n}", Indent: "  "},
+				"pair": {LineBefore: true},
+				"*WSP": {Value: abnf.Drop},
+			},
+			in:   "a=x,b=y,  c=z",
+			want: "{\n  a=x,\n  b=y,\n  c=z\n}",
+		},
+		{
+			name: "wrapping",
+			layouts: map[string]abnf.Layout{
+				"list": {Indent: "    "},
+				"pair": {Break: true},
+				"*WSP": {Value: abnf.Collapse([]byte(" "))},
+			},
+			width: 12,
+			in:    "a=x,b=y,  c=z,\td=w",
+			want:  "a=x,b=y,\n    c=z, d=w",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			f := abnf.NewFormatter(c.layouts)
+			f.Width(c.width)
+			if got := string(f.Format(parse(pairsOp(), c.in))); got != c.want {
+				t.Fatalf("f.Format(n) = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatter_Fold(t *testing.T) {
+	// field = name ":" *(WSP / VCHAR) CRLF
+	// name = 1*ALPHA
+	wsp := abnf.Alt("WSP", abnf.Literal("SP", []byte(" ")), abnf.Literal("HTAB", []byte("\t")))
+	op := abnf.Concat("field",
+		abnf.Repeat1Inf("name", abnf_core.Operators().ALPHA),
+		abnf.Literal(`":"`, []byte(":")),
+		abnf.Repeat0Inf("*(WSP / VCHAR)", abnf.Alt("WSP / VCHAR", wsp, abnf.Range("VCHAR", []byte("!"), []byte("~")))),
+		abnf.Literal("CRLF", []byte("\r\n")),
+	)
+
+	in := []byte("Subject: the quick brown fox jumps over the lazy dog\r\n")
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := abnf.Parse(op, in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+
+	f := abnf.NewFormatter(map[string]abnf.Layout{"WSP": {Break: true}})
+	f.Width(20)
+	f.Newline("\r\n")
+	want := "Subject: the quick\r\n brown fox jumps\r\n over the lazy dog\r\n"
+	if got := string(f.Format(ns.Best())); got != want {
+		t.Fatalf("f.Format(n) = %q, want %q", got, want)
+	}
+}
+
+func TestFormatter_FormatCheck(t *testing.T) {
+	in := []byte("a=x,b=y,  c=z")
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := abnf.Parse(pairsOp(), in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+
+	for _, c := range []struct {
+		name    string
+		layouts map[string]abnf.Layout
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "collapse",
+			layouts: map[string]abnf.Layout{"*WSP": {Value: abnf.Collapse([]byte(" "))}},
+			want:    "a=x,b=y, c=z",
+		},
+		{
+			name:    "line breaks",
+			layouts: map[string]abnf.Layout{"pair": {LineBefore: true}},
+			wantErr: abnf.ErrFormatMismatch,
+		},
+		{
+			name:    "brackets",
+			layouts: map[string]abnf.Layout{"list": {Before: "{", After: "}"}},
+			wantErr: abnf.ErrFormatMismatch,
+		},
+		{
+			name:    "trailing text",
+			layouts: map[string]abnf.Layout{"list": {After: ";"}},
+			wantErr: abnf.ErrFormatMismatch,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := abnf.NewFormatter(c.layouts).FormatCheck(pairsOp(), ns.Best())
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("f.FormatCheck(op, n) error = %v, want %v", err, c.wantErr)
+			}
+			if string(got) != c.want {
+				t.Fatalf("f.FormatCheck(op, n) = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatter_InputLines(t *testing.T) {
+	// list = "(" *(item / LF) ")"
+	op := abnf.Concat("list",
+		abnf.Literal(`"("`, []byte("(")),
+		abnf.Repeat0Inf("*(item / LF)", abnf.Alt("item / LF",
+			abnf.Repeat1Inf("item", abnf_core.Operators().ALPHA),
+			abnf.Literal("LF", []byte("\n")),
+		)),
+		abnf.Literal(`")"`, []byte(")")),
+	)
+	in := []byte("(a\nb\n)")
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := abnf.Parse(op, in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+
+	for _, c := range []struct {
+		name    string
+		layouts map[string]abnf.Layout
+		want    string
+	}{
+		{
+			name:    "kept",
+			layouts: map[string]abnf.Layout{"list": {Indent: "  "}},
+			want:    "(a\nb\n)",
+		},
+		{
+			name:    "replaced",
+			layouts: map[string]abnf.Layout{"list": {Indent: "  "}, "LF": {Value: abnf.Drop}, "item": {LineBefore: true}},
+			want:    "(\n  a\n  b)",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := string(abnf.NewFormatter(c.layouts).Format(ns.Best())); got != c.want {
+				t.Fatalf("f.Format(n) = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
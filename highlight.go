@@ -0,0 +1,79 @@
+package abnf
+
+// Token is a highlighted span of the input, see [Highlighter].
+type Token struct {
+	// Class is the highlight class of the span, empty for plain text.
+	Class string
+	// Pos and End are the start and the end of the span in the input.
+	Pos, End uint
+}
+
+// Highlighter splits the input into highlight tokens by matches of the operator,
+// e.g. for syntax highlighting of grammar-defined languages in UIs and terminals.
+//
+// Nodes are mapped to highlight classes by key, usually rule names to classes like "keyword", "string" or "comment".
+// The class of a node applies to its span except spans of descendants with their own classes, so the innermost class wins.
+// Matches are searched from left to right like [Searcher] does,
+// octets outside matches are the unparsed regions, they get the fallback class, see [Highlighter.Fallback].
+//
+// Highlighter is safe for concurrent use once configured.
+type Highlighter struct {
+	s        *Searcher
+	classes  map[string]string
+	fallback string
+}
+
+// NewHighlighter returns a highlighter of matches of op with the given classes of node keys.
+// Options apply to every search, see [Parse].
+func NewHighlighter(op Operator, classes map[string]string, opts ...ParseOption) *Highlighter {
+	return &Highlighter{s: NewSearcher(op, nil, opts...), classes: classes}
+}
+
+// Fallback sets the class of unparsed regions, empty by default.
+// It must be called before the highlighter is used.
+func (h *Highlighter) Fallback(class string) {
+	h.fallback = class
+}
+
+// Tokens returns the flat list of non-overlapping tokens that covers the whole input in order.
+// Adjacent spans of the same class are merged into one token.
+func (h *Highlighter) Tokens(in []byte) []Token {
+	var toks []Token
+	var pos uint
+	for n := range h.s.All(in) {
+		toks = appendToken(toks, h.fallback, pos, n.Pos)
+		toks = h.walk(n, "", toks)
+		pos = n.Pos + uint(n.Len())
+	}
+	return appendToken(toks, h.fallback, pos, uint(len(in)))
+}
+
+func (h *Highlighter) walk(n *Node, class string, toks []Token) []Token {
+	if c, ok := h.classes[n.Key]; ok {
+		class = c
+	}
+
+	pos := n.Pos
+	for _, chn := range n.Children {
+		if chn.IsEmpty() || chn.Pos < pos {
+			// empty or malformed node out of the parent span
+			continue
+		}
+		toks = appendToken(toks, class, pos, chn.Pos)
+		toks = h.walk(chn, class, toks)
+		pos = chn.Pos + uint(chn.Len())
+	}
+	return appendToken(toks, class, pos, n.Pos+uint(n.Len()))
+}
+
+// appendToken appends the span to toks merging it with the last token of the same class.
+func appendToken(toks []Token, class string, pos, end uint) []Token {
+	if pos >= end {
+		return toks
+	}
+	if l := len(toks) - 1; l >= 0 && toks[l].Class == class && toks[l].End == pos {
+		toks[l].End = end
+		return toks
+	}
+	return append(toks, Token{Class: class, Pos: pos, End: end})
+}
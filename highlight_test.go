@@ -0,0 +1,77 @@
+package abnf_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// settingOp returns the operator of the rule:
+//
+//	setting = name "=" value [comment]
+//	name = 1*ALPHA
+//	value = number / "on" / "off"
+//	number = 1*DIGIT
+//	comment = ";" *ALPHA
+func settingOp() abnf.Operator {
+	core := abnf_core.Operators()
+	return abnf.Concat("setting",
+		abnf.Repeat1Inf("name", core.ALPHA),
+		abnf.Literal(`"="`, []byte("=")),
+		abnf.Alt("value",
+			abnf.Repeat1Inf("number", core.DIGIT),
+			abnf.Literal(`"on"`, []byte("on")),
+			abnf.Literal(`"off"`, []byte("off")),
+		),
+		abnf.Optional("[comment]", abnf.Concat("comment",
+			abnf.Literal(`";"`, []byte(";")),
+			abnf.Repeat0Inf("*ALPHA", core.ALPHA),
+		)),
+	)
+}
+
+func TestHighlighter(t *testing.T) {
+	h := abnf.NewHighlighter(settingOp(), map[string]string{
+		"name":    "keyword",
+		`"="`:     "operator",
+		"number":  "number",
+		`"on"`:    "string",
+		`"off"`:   "string",
+		"comment": "comment",
+		`";"`:     "operator",
+	})
+	h.Fallback("error")
+
+	in := []byte("timeout=30;slow\n??\ntitle=on")
+	want := []abnf.Token{
+		{Class: "keyword", Pos: 0, End: 7},
+		{Class: "operator", Pos: 7, End: 8},
+		{Class: "number", Pos: 8, End: 10},
+		{Class: "operator", Pos: 10, End: 11},
+		{Class: "comment", Pos: 11, End: 15},
+		{Class: "error", Pos: 15, End: 19},
+		{Class: "keyword", Pos: 19, End: 24},
+		{Class: "operator", Pos: 24, End: 25},
+		{Class: "string", Pos: 25, End: 27},
+	}
+	if got := h.Tokens(in); !cmp.Equal(got, want) {
+		t.Errorf("h.Tokens(in) mismatch (-got +want):\n%s", cmp.Diff(got, want))
+	}
+
+	h = abnf.NewHighlighter(settingOp(), map[string]string{"setting": "line", "number": "number"})
+	want = []abnf.Token{
+		{Pos: 0, End: 1},
+		{Class: "line", Pos: 1, End: 3},
+		{Class: "number", Pos: 3, End: 5},
+		{Class: "line", Pos: 5, End: 8},
+	}
+	if got := h.Tokens([]byte(" a=12;xy")); !cmp.Equal(got, want) {
+		t.Errorf("h.Tokens(in) mismatch (-got +want):\n%s", cmp.Diff(got, want))
+	}
+	if got := h.Tokens(nil); got != nil {
+		t.Errorf("h.Tokens(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,157 @@
+package abnf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Edit describes a change of an input: Deleted octets starting at Offset are replaced with Inserted octets.
+type Edit struct {
+	Offset   uint
+	Deleted  uint
+	Inserted []byte
+}
+
+// Apply returns a new input with the edit applied to in, in is not modified.
+// It panics if the edit is out of the input bounds.
+func (e Edit) Apply(in []byte) []byte {
+	out := make([]byte, 0, len(in)-int(e.Deleted)+len(e.Inserted))
+	out = append(out, in[:e.Offset]...)
+	out = append(out, e.Inserted...)
+	return append(out, in[e.Offset+e.Deleted:]...)
+}
+
+// Reparse parses the input in changed with the edit e reusing the tree prev previously parsed from in.
+// It returns the new tree and the new input. Options apply to all parses of nodes, as [Parse] options do.
+//
+// ops maps node keys to operators that produced them, usually rule names to rule operators.
+// Only the smallest node with an operator in ops that encloses the edit is parsed again.
+// If its new match ends where the old one did, shifted by the edit, the match replaces the old node,
+// otherwise enclosing nodes are tried up to the root, which is parsed again with ops[prev.Key].
+// The new match of the root must end where the old one did too, otherwise the edited input doesn't match.
+//
+// Only ancestors of the replaced node are copied. Nodes before the edit are reused as is,
+// so they keep referencing in and in must not be modified while the new tree is used, see [Node.Detach].
+// Nodes after the edit are reused as well if the edit keeps the input length, otherwise they are copied
+// with shifted positions and values referencing the new input.
+//
+// A node encloses the edit if the edit lies within the node span including its bounds,
+// so insertions at either end of a node reparse the node. Enclosing nodes aren't parsed again,
+// so the result may differ from a full parse if the edit makes another alternative of an enclosing rule preferable.
+func Reparse(ops map[string]Operator, prev *Node, in []byte, e Edit, opts ...ParseOption) (*Node, []byte, error) {
+	if e.Offset+e.Deleted > uint(len(in)) {
+		return nil, nil, fmt.Errorf("edit [%d:%d] is out of input bounds [0:%d]", e.Offset, e.Offset+e.Deleted, len(in))
+	}
+
+	newIn := e.Apply(in)
+	delta := len(e.Inserted) - int(e.Deleted)
+
+	encloses := func(n *Node) bool {
+		return n.Pos <= e.Offset && e.Offset+e.Deleted <= n.Pos+uint(n.Len())
+	}
+
+	// child indexes of the path from the root to the deepest node with an operator that encloses the edit,
+	// at the bounds of nodes the edit may be enclosed by several siblings
+	var idxs []int
+	var walk func(n *Node, path []int)
+	walk = func(n *Node, path []int) {
+		if _, ok := ops[n.Key]; ok && len(path) > len(idxs) {
+			idxs = slices.Clone(path)
+		}
+		for i, chn := range n.Children {
+			if encloses(chn) {
+				walk(chn, append(path, i))
+			}
+		}
+	}
+	walk(prev, nil)
+
+	path := make([]*Node, len(idxs)+1)
+	path[0] = prev
+	for k, i := range idxs {
+		path[k+1] = path[k].Children[i]
+	}
+
+	ctx := NewContext(opts...)
+	ns := NewNodes()
+	defer ns.Free()
+
+	// match returns the match of the node operator that ends where the node did, shifted by the edit
+	match := func(n *Node, op Operator) (*Node, error) {
+		ns.Clear()
+		if err := op(ctx, newIn, n.Pos, ns); err != nil {
+			return nil, err
+		}
+		want := n.Len() + delta
+		var matched Nodes
+		for _, nn := range ns.All() {
+			if nn.Len() == want {
+				matched = append(matched, nn)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("%w: node '%s' doesn't match the edited input [%d:%d]",
+				ErrNotMatched, n.Key, n.Pos, int(n.Pos)+want)
+		}
+		return matched.BestBy(ctx.Policy()), nil
+	}
+
+	for k := len(path) - 1; k > 0; k-- {
+		n := path[k]
+		op, ok := ops[n.Key]
+		if !ok {
+			continue
+		}
+		if nn, err := match(n, op); err == nil {
+			return splice(path[:k], idxs[:k], nn, newIn, delta), newIn, nil
+		}
+	}
+
+	op, ok := ops[prev.Key]
+	if !ok {
+		return nil, nil, fmt.Errorf("operator of the root node '%s' not found", prev.Key)
+	}
+	nn, err := match(prev, op)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nn, newIn, nil
+}
+
+// splice replaces the last node of the path with n, copying ancestors and shifting nodes after n.
+func splice(path []*Node, idxs []int, n *Node, in []byte, delta int) *Node {
+	for j := len(path) - 1; j >= 0; j-- {
+		p := path[j]
+		np := &Node{
+			Key:      p.Key,
+			Pos:      p.Pos,
+			Value:    in[p.Pos : int(p.Pos)+p.Len()+delta],
+			Children: make(Nodes, len(p.Children)),
+		}
+		for i, chn := range p.Children {
+			switch {
+			case i < idxs[j] || i > idxs[j] && delta == 0:
+				np.Children[i] = chn
+			case i == idxs[j]:
+				np.Children[i] = n
+			default:
+				np.Children[i] = chn.shift(in, delta)
+			}
+		}
+		n = np
+	}
+	return n
+}
+
+// shift returns a deep copy of the subtree with positions shifted by delta and values referencing in.
+func (n *Node) shift(in []byte, delta int) *Node {
+	pos := uint(int(n.Pos) + delta)
+	sn := &Node{Key: n.Key, Pos: pos, Value: in[pos : pos+uint(len(n.Value))]}
+	if len(n.Children) > 0 {
+		sn.Children = make(Nodes, len(n.Children))
+		for i, chn := range n.Children {
+			sn.Children[i] = chn.shift(in, delta)
+		}
+	}
+	return sn
+}
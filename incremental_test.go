@@ -0,0 +1,169 @@
+package abnf_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// listOps returns operators of the grammar:
+//
+//	list = item *("," item)
+//	item = 1*ALPHA
+func listOps(calls map[string]int) map[string]abnf.Operator {
+	ops := make(map[string]abnf.Operator)
+	counted := func(key string, op abnf.Operator) abnf.Operator {
+		return func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+			calls[key]++
+			return op(ctx, in, pos, ns)
+		}
+	}
+	ops["item"] = counted("item", abnf.Repeat1Inf("item", abnf_core.Operators().ALPHA))
+	ops["list"] = counted("list", abnf.Concat("list",
+		ops["item"],
+		abnf.Repeat0Inf(`*("," item)`, abnf.Concat(`"," item`,
+			abnf.Literal(`","`, []byte(",")),
+			ops["item"],
+		)),
+	))
+	return ops
+}
+
+func TestReparse(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		edit      abnf.Edit
+		want      string
+		wantCalls map[string]int
+		// the first item is before the edit and isn't reparsed
+		wantReused bool
+	}{
+		{
+			name:       "inside item",
+			edit:       abnf.Edit{Offset: 4, Inserted: []byte("zz")},
+			want:       "ab,czzd,ef",
+			wantCalls:  map[string]int{"item": 1},
+			wantReused: true,
+		},
+		{
+			name:      "append to item",
+			edit:      abnf.Edit{Offset: 2, Inserted: []byte("x")},
+			want:      "abx,cd,ef",
+			wantCalls: map[string]int{"item": 1},
+		},
+		{
+			name:       "prepend to item",
+			edit:       abnf.Edit{Offset: 3, Inserted: []byte("x")},
+			want:       "ab,xcd,ef",
+			wantCalls:  map[string]int{"item": 1},
+			wantReused: true,
+		},
+		{
+			name:      "across items",
+			edit:      abnf.Edit{Offset: 1, Deleted: 2, Inserted: []byte("xyz,")},
+			want:      "axyz,cd,ef",
+			wantCalls: map[string]int{"list": 1, "item": 3},
+		},
+		{
+			name:      "split item",
+			edit:      abnf.Edit{Offset: 4, Inserted: []byte(",")},
+			want:      "ab,c,d,ef",
+			wantCalls: map[string]int{"list": 1, "item": 5},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			in := []byte("ab,cd,ef")
+			calls := make(map[string]int)
+			ops := listOps(calls)
+
+			ns := abnf.NewNodes()
+			defer ns.Free()
+			if err := ops["list"](nil, in, 0, ns); err != nil {
+				t.Fatalf("list(in) error = %v, want nil", err)
+			}
+			prev := ns.Best()
+			clear(calls)
+
+			n, newIn, err := abnf.Reparse(ops, prev, in, c.edit)
+			if err != nil {
+				t.Fatalf("abnf.Reparse(ops, prev, in, edit) error = %v, want nil", err)
+			}
+			if got := string(newIn); got != c.want {
+				t.Fatalf("abnf.Reparse(ops, prev, in, edit) input = %q, want %q", got, c.want)
+			}
+			if !cmp.Equal(calls, c.wantCalls) {
+				t.Errorf("operator calls = %v, want %v", calls, c.wantCalls)
+			}
+			// only ancestors of the reparsed node are copied
+			if c.wantReused && n.Children[0] != prev.Children[0] {
+				t.Errorf("abnf.Reparse(ops, prev, in, edit) copied the node before the edit")
+			}
+
+			ns.Clear()
+			if err := ops["list"](nil, newIn, 0, ns); err != nil {
+				t.Fatalf("list(newIn) error = %v, want nil", err)
+			}
+			if want := ns.Best(); !cmp.Equal(n, want) {
+				t.Errorf("abnf.Reparse(ops, prev, in, edit) mismatch (-got +want):\n%s", cmp.Diff(n, want))
+			}
+		})
+	}
+}
+
+func TestReparse_Errors(t *testing.T) {
+	ops := listOps(make(map[string]int))
+	in := []byte("ab,cd")
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := ops["list"](nil, in, 0, ns); err != nil {
+		t.Fatalf("list(in) error = %v, want nil", err)
+	}
+	prev := ns.Best()
+
+	if _, _, err := abnf.Reparse(ops, prev, in, abnf.Edit{Offset: 4, Deleted: 2}); err == nil {
+		t.Error("abnf.Reparse(ops, prev, in, edit) error = nil, want out of bounds error")
+	}
+	if _, _, err := abnf.Reparse(ops, prev, in, abnf.Edit{Offset: 0, Deleted: 2, Inserted: []byte(",")}); err == nil {
+		t.Error("abnf.Reparse(ops, prev, in, edit) error = nil, want not matched error")
+	}
+	// the root matches only "ab" of "ab,,cd"
+	if _, _, err := abnf.Reparse(ops, prev, in, abnf.Edit{Offset: 2, Inserted: []byte(",")}); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Errorf("abnf.Reparse(ops, prev, in, edit) error = %v, want %v", err, abnf.ErrNotMatched)
+	}
+	if _, _, err := abnf.Reparse(map[string]abnf.Operator{}, prev, in, abnf.Edit{Offset: 1}); err == nil {
+		t.Error("abnf.Reparse(ops, prev, in, edit) error = nil, want unknown root error")
+	}
+}
+
+func TestReparse_Options(t *testing.T) {
+	ops := listOps(make(map[string]int))
+	in := []byte("ab,cd")
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := ops["list"](nil, in, 0, ns); err != nil {
+		t.Fatalf("list(in) error = %v, want nil", err)
+	}
+	prev := ns.Best()
+
+	n, _, err := abnf.Reparse(ops, prev, in, abnf.Edit{Offset: 4, Inserted: []byte("x")},
+		abnf.WithPrune(abnf.KeepKeys("list", "item")),
+	)
+	if err != nil {
+		t.Fatalf("abnf.Reparse(ops, prev, in, edit) error = %v, want nil", err)
+	}
+	// the reparsed item is pruned, the reused one isn't
+	want := &abnf.Node{Key: "item", Pos: 3, Value: []byte("cxd")}
+	if got := n.Children[1].Children[0].Children[1]; !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+		t.Errorf("reparsed item = %+v, want %+v", got, want)
+	}
+	if got := n.Children[0]; len(got.Children) != 2 {
+		t.Errorf("reused item = %+v, want 2 children", got)
+	}
+}
@@ -0,0 +1,161 @@
+package abnf
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+)
+
+// LiteralSetItem defines a literal of [LiteralSet].
+type LiteralSetItem struct {
+	Key           string
+	Value         []byte
+	CaseSensitive bool
+}
+
+// LiteralSet defines an alternation of literals.
+// It is a faster equivalent of [Alt] of [Literal] and [LiteralCS] operators:
+// input is matched against all literals at once with a trie
+// and created nodes have the same shape as nodes of the alternation.
+// Created operator will return all matched literals ordered by the parse [Policy].
+// It returns ErrNotMatched if no literal matched.
+func LiteralSet(key string, lits ...LiteralSetItem) Operator {
+	t := newLiteralTrie(lits)
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		var (
+			buf [8]int
+			idx = buf[:0]
+		)
+		idx = t.match(in[pos:], idx)
+		for _, i := range t.fallback {
+			if matchLiteral(in[pos:], lits[i]) {
+				idx = append(idx, i)
+			}
+		}
+		if ctx.tracksPartial() {
+			for _, lit := range lits {
+				if len(lit.Value) > len(in[pos:]) && hasPrefixFold(lit.Value, in[pos:], !lit.CaseSensitive) {
+					ctx.NeedMore(uint(len(lit.Value) - len(in[pos:])))
+				}
+			}
+		}
+		if len(idx) == 0 {
+			return wrapNotMatched(key, pos)
+		}
+		// keep the declaration order like Alt does
+		slices.Sort(idx)
+
+		resns := NewNodes()
+		defer resns.Free()
+
+		for _, i := range idx {
+			lit := lits[i]
+			l := uint(len(lit.Value))
+			sn := loadOrStoreNode(
+				newNodeCacheKey(lit.Key, pos, l, in),
+				func() *Node { return ctx.newNode(lit.Key, pos, in[pos:pos+l]) },
+			)
+			resns.Append(newAltNode(ctx, key, pos, sn, in))
+		}
+
+		resns.SortBy(ctx.Policy())
+		ns.Append(resns.All()...)
+		return nil
+	}
+}
+
+func matchLiteral(in []byte, lit LiteralSetItem) bool {
+	if len(in) < len(lit.Value) {
+		return false
+	}
+	got := in[:len(lit.Value)]
+	if bytes.Equal(got, lit.Value) {
+		return true
+	}
+	return !lit.CaseSensitive && EqualFold(lit.Value, got)
+}
+
+// literalTrie is a trie of ASCII lower-cased literals.
+// Case-insensitive literals with non-ASCII characters are matched one by one.
+type literalTrie struct {
+	nodes    []trieNode
+	lits     []LiteralSetItem
+	fallback []int
+}
+
+type trieNode struct {
+	// edges are sorted by label.
+	edges []trieEdge
+	// ends are indexes of literals ending at the node in declaration order.
+	ends []int
+}
+
+type trieEdge struct {
+	label byte
+	next  int
+}
+
+func newLiteralTrie(lits []LiteralSetItem) *literalTrie {
+	t := &literalTrie{
+		nodes: make([]trieNode, 1),
+		lits:  lits,
+	}
+	for i, lit := range lits {
+		if !lit.CaseSensitive && hasNonASCII(lit.Value) {
+			t.fallback = append(t.fallback, i)
+			continue
+		}
+
+		n := 0
+		for _, c := range lit.Value {
+			c = lowerASCII(c)
+			edges := t.nodes[n].edges
+			j := sort.Search(len(edges), func(j int) bool { return edges[j].label >= c })
+			if j < len(edges) && edges[j].label == c {
+				n = edges[j].next
+				continue
+			}
+			t.nodes = append(t.nodes, trieNode{})
+			t.nodes[n].edges = slices.Insert(edges, j, trieEdge{c, len(t.nodes) - 1})
+			n = len(t.nodes) - 1
+		}
+		t.nodes[n].ends = append(t.nodes[n].ends, i)
+	}
+	return t
+}
+
+// match appends indexes of literals matching the prefix of in to idx.
+// Indexes are appended in ascending order of literal length.
+func (t *literalTrie) match(in []byte, idx []int) []int {
+	n := 0
+	for k := 0; ; k++ {
+		for _, i := range t.nodes[n].ends {
+			lit := t.lits[i]
+			if !lit.CaseSensitive || bytes.Equal(in[:k], lit.Value) {
+				idx = append(idx, i)
+			}
+		}
+
+		if k == len(in) {
+			break
+		}
+
+		c := lowerASCII(in[k])
+		edges := t.nodes[n].edges
+		j := sort.Search(len(edges), func(j int) bool { return edges[j].label >= c })
+		if j == len(edges) || edges[j].label != c {
+			break
+		}
+		n = edges[j].next
+	}
+	return idx
+}
+
+func hasNonASCII(s []byte) bool {
+	for _, c := range s {
+		if c >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
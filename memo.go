@@ -0,0 +1,56 @@
+package abnf
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+type memoKey struct {
+	id  uint64
+	pos uint
+}
+
+type memoEntry struct {
+	ns  Nodes
+	err error
+}
+
+// memoTable keeps results of memoized operators of a parse, see [WithMemo].
+// It belongs to the parse [Context], so it's accessed without locking.
+type memoTable struct {
+	entries map[memoKey]memoEntry
+}
+
+var memoIDs atomic.Uint64
+
+// Memo wraps op so that its results are memoized per input position during parses started with [WithMemo].
+// Results are kept in the parse [Context], so they are never shared by different parses.
+// Outside of such parses the created operator is equivalent to op.
+//
+// Combined with ordered choices ([AltFirst]) and possessive repetitions ([RepeatPossessive])
+// memoization of rules gives a packrat parser that runs in linear time.
+// Left-recursive rules aren't supported.
+func Memo(op Operator) Operator {
+	id := memoIDs.Add(1)
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		if ctx == nil || ctx.memo == nil {
+			return op(ctx, in, pos, ns)
+		}
+
+		k := memoKey{id, pos}
+		e, ok := ctx.memo.entries[k]
+		if !ok {
+			subns := NewNodes()
+			e.err = op(ctx, in, pos, subns)
+			e.ns = slices.Clone(subns.All())
+			subns.Free()
+			ctx.memo.entries[k] = e
+		}
+
+		if e.err != nil {
+			return e.err
+		}
+		ns.Append(e.ns...)
+		return nil
+	}
+}
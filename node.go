@@ -78,6 +78,94 @@ func (n *Node) GetNodes(key string) Nodes {
 	return ns
 }
 
+// Clone returns a deep copy of the subtree.
+// Values of the copied nodes still reference the original input, use [Node.Detach]
+// to copy them out of the input.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+
+	cn := &Node{Key: n.Key, Pos: n.Pos, Value: n.Value}
+	if len(n.Children) > 0 {
+		cn.Children = make(Nodes, len(n.Children))
+		for i, chn := range n.Children {
+			cn.Children[i] = chn.Clone()
+		}
+	}
+	return cn
+}
+
+// Detach returns a deep copy of the subtree that doesn't reference the original input.
+// The node value is copied into a new buffer that is shared by all copied descendants,
+// so the detached tree is safe to store and share even if the input buffer is reused.
+func (n *Node) Detach() *Node {
+	if n == nil {
+		return nil
+	}
+	return n.detach(bytes.Clone(n.Value), n.Pos)
+}
+
+func (n *Node) detach(buf []byte, start uint) *Node {
+	dn := &Node{Key: n.Key, Pos: n.Pos}
+	if n.Pos >= start && n.Pos-start+uint(len(n.Value)) <= uint(len(buf)) {
+		off := n.Pos - start
+		dn.Value = buf[off : off+uint(len(n.Value)) : off+uint(len(n.Value))]
+	} else {
+		// malformed tree, child is out of the parent span
+		dn.Value = bytes.Clone(n.Value)
+	}
+
+	if len(n.Children) > 0 {
+		dn.Children = make(Nodes, len(n.Children))
+		for i, chn := range n.Children {
+			dn.Children[i] = chn.detach(buf, start)
+		}
+	}
+	return dn
+}
+
+// rebind returns a deep copy of the subtree with values referencing in.
+func (n *Node) rebind(in []byte) *Node {
+	rn := &Node{Key: n.Key, Pos: n.Pos, Value: in[n.Pos : n.Pos+uint(len(n.Value))]}
+	if len(n.Children) > 0 {
+		rn.Children = make(Nodes, len(n.Children))
+		for i, chn := range n.Children {
+			rn.Children[i] = chn.rebind(in)
+		}
+	}
+	return rn
+}
+
+// Prune returns a copy of the subtree that keeps only nodes accepted by keep.
+// Children of rejected nodes are spliced into the closest kept ancestor,
+// so the result contains the kept nodes in the input order.
+// If the node itself is rejected, its pruned children are returned.
+// The original tree is not modified.
+func (n *Node) Prune(keep func(n *Node) bool) Nodes {
+	if n == nil {
+		return nil
+	}
+
+	chns := n.Children.Prune(keep)
+	if !keep(n) {
+		return chns
+	}
+	return Nodes{{Key: n.Key, Pos: n.Pos, Value: n.Value, Children: chns}}
+}
+
+// KeepKeys returns a predicate for [Node.Prune] that accepts nodes with one of the given keys.
+func KeepKeys(keys ...string) func(n *Node) bool {
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[k] = struct{}{}
+	}
+	return func(n *Node) bool {
+		_, ok := set[n.Key]
+		return ok
+	}
+}
+
 // Compare compares node values via [bytes.Compare].
 // The result is 0 if n.Value == other.Value, -1 if n.Value < other.Value, and +1 if n.Value > other.Value.
 func (n *Node) Compare(other *Node) int {
@@ -95,6 +183,7 @@ var (
 	nodeCache atomic.Pointer[lru.Cache[uint64, *Node]]
 	cacheHit,
 	cacheMiss atomic.Uint64
+	cacheIsol atomic.Bool
 )
 
 // EnableNodeCache initializes the node cache.
@@ -102,6 +191,7 @@ var (
 // By default, the cache is disabled.
 // It does nothing if the cache is already enabled.
 // Call this function before using any [Operator], usually in the [init].
+// Cached nodes are shared between callers, see [EnableNodeCacheIsolation].
 func EnableNodeCache(size uint) {
 	if nodeCache.Load() != nil {
 		return
@@ -140,6 +230,22 @@ func DisableNodeCache() {
 	}
 }
 
+// EnableNodeCacheIsolation enables isolation of cached nodes.
+//
+// Without isolation the same [Node] instances are returned to different callers
+// and their values reference the input of the parse that created them,
+// so cached trees must be treated as immutable and the input buffers must not be reused.
+// With isolation every node stored to the cache is a private copy,
+// and every cache hit returns a fresh copy with values referencing the caller's input,
+// so returned trees can be freely modified and stored.
+// Isolation costs a copy of the subtree on every cache store and hit.
+// By default, isolation is disabled.
+func EnableNodeCacheIsolation() { cacheIsol.Store(true) }
+
+// DisableNodeCacheIsolation disables isolation of cached nodes.
+// By default, isolation is disabled.
+func DisableNodeCacheIsolation() { cacheIsol.Store(false) }
+
 // NodeCacheStats reports cache hit and miss counts along with the number of cached nodes.
 func NodeCacheStats() struct{ hit, miss, size uint64 } {
 	var size uint64
@@ -152,14 +258,16 @@ func NodeCacheStats() struct{ hit, miss, size uint64 } {
 type nodeCacheKey struct {
 	hash.Hash64
 	buf [8]byte
+	in  []byte
 }
 
 var nodeCacheKeyPool = sync.Pool{
-	New: func() any { return &nodeCacheKey{fnv.New64a(), [8]byte{}} },
+	New: func() any { return &nodeCacheKey{Hash64: fnv.New64a()} },
 }
 
 func newNodeCacheKey(key string, pos uint, len uint, input []byte, ns ...*Node) *nodeCacheKey {
 	ck := nodeCacheKeyPool.Get().(*nodeCacheKey)
+	ck.in = input
 	ck.writeBase(key, pos, len, input)
 	ck.writeChildKeys(0, ns...)
 	return ck
@@ -171,6 +279,7 @@ func (ck *nodeCacheKey) free() {
 	}
 
 	ck.Reset()
+	ck.in = nil
 	nodeCacheKeyPool.Put(ck)
 }
 
@@ -247,12 +356,20 @@ func loadOrStoreNode(k *nodeCacheKey, newNode func() *Node) *Node {
 		return newNode()
 	}
 
+	isol := cacheIsol.Load()
 	if n, ok := loadNode(k); ok {
+		if isol {
+			return n.rebind(k.in)
+		}
 		return n
 	}
 
 	n := newNode()
-	storeNode(k, n)
+	if isol {
+		storeNode(k, n.Clone())
+	} else {
+		storeNode(k, n)
+	}
 	return n
 }
 
@@ -261,6 +378,7 @@ type Nodes []*Node
 
 // Len returns the number of nodes in the list.
 func (ns *Nodes) Len() int {
+	debugNodesCheck(ns)
 	if ns == nil {
 		return 0
 	}
@@ -269,6 +387,7 @@ func (ns *Nodes) Len() int {
 
 // Contains reports whether the subtree contains the given key.
 func (ns *Nodes) Contains(key string) bool {
+	debugNodesCheck(ns)
 	if ns == nil {
 		return false
 	}
@@ -283,6 +402,7 @@ func (ns *Nodes) Contains(key string) bool {
 
 // Get recursively searches for the first node with the given key.
 func (ns *Nodes) Get(key string) (*Node, bool) {
+	debugNodesCheck(ns)
 	if ns == nil {
 		return nil, false
 	}
@@ -300,6 +420,7 @@ func (ns *Nodes) Get(key string) (*Node, bool) {
 
 // All returns all nodes in the list.
 func (ns *Nodes) All() Nodes {
+	debugNodesCheck(ns)
 	if ns == nil {
 		return nil
 	}
@@ -308,6 +429,7 @@ func (ns *Nodes) All() Nodes {
 
 // AllByKey recursively searches all nodes with the given key.
 func (ns *Nodes) AllByKey(key string) Nodes {
+	debugNodesCheck(ns)
 	if ns == nil {
 		return nil
 	}
@@ -322,19 +444,52 @@ func (ns *Nodes) AllByKey(key string) Nodes {
 	return nodes
 }
 
-// Best returns a node with the longest value or nil if the list is empty.
-func (ns *Nodes) Best() *Node {
+// Clone returns a list of deep copies of all nodes, see [Node.Clone].
+func (ns *Nodes) Clone() Nodes {
+	debugNodesCheck(ns)
 	if ns == nil || len(*ns) == 0 {
 		return nil
 	}
 
-	best := (*ns)[0]
-	for _, n := range (*ns)[1:] {
-		if n.Len() > best.Len() {
-			best = n
-		}
+	nodes := make(Nodes, len(*ns))
+	for i, n := range *ns {
+		nodes[i] = n.Clone()
+	}
+	return nodes
+}
+
+// Detach returns a list of detached copies of all nodes, see [Node.Detach].
+func (ns *Nodes) Detach() Nodes {
+	debugNodesCheck(ns)
+	if ns == nil || len(*ns) == 0 {
+		return nil
+	}
+
+	nodes := make(Nodes, len(*ns))
+	for i, n := range *ns {
+		nodes[i] = n.Detach()
 	}
-	return best
+	return nodes
+}
+
+// Prune prunes every node in the list with [Node.Prune] and returns the joined result.
+func (ns *Nodes) Prune(keep func(n *Node) bool) Nodes {
+	debugNodesCheck(ns)
+	if ns == nil || len(*ns) == 0 {
+		return nil
+	}
+
+	var nodes Nodes
+	for _, n := range *ns {
+		nodes = append(nodes, n.Prune(keep)...)
+	}
+	return nodes
+}
+
+// Best returns the most preferred node according to [PolicyLongest] or nil if the list is empty.
+// If several nodes rank equally, the first one is returned.
+func (ns *Nodes) Best() *Node {
+	return ns.BestBy(PolicyLongest)
 }
 
 // Compare compares two best nodes.
@@ -348,6 +503,7 @@ func (ns *Nodes) Compare(other *Nodes) int {
 
 // Append adds nodes to the list.
 func (ns *Nodes) Append(n ...*Node) {
+	debugNodesCheck(ns)
 	*ns = append(*ns, n...)
 }
 
@@ -363,11 +519,14 @@ var nodesPool = &sync.Pool{
 
 // NewNodes returns a new nodes list from the pool.
 func NewNodes() *Nodes {
-	return nodesPool.Get().(*Nodes)
+	ns := nodesPool.Get().(*Nodes)
+	debugNodesAlloc(ns)
+	return ns
 }
 
 // Clear clears the nodes list.
 func (ns *Nodes) Clear() {
+	debugNodesCheck(ns)
 	if ns == nil {
 		return
 	}
@@ -377,7 +536,12 @@ func (ns *Nodes) Clear() {
 }
 
 // Free returns the nodes list to the pool.
+// The list must not be used after Free, see [NodesDebug].
 func (ns *Nodes) Free() {
+	if debugNodesFree(ns) {
+		return
+	}
+
 	ns.Clear()
 
 	if ns == nil || cap(*ns) == 0 || cap(*ns) > 10*NodesCap {
@@ -386,16 +550,3 @@ func (ns *Nodes) Free() {
 
 	nodesPool.Put(ns)
 }
-
-type nodesSorter Nodes
-
-func (ns *nodesSorter) Len() int { return len(*ns) }
-
-func (ns *nodesSorter) Less(i, j int) bool {
-	return len((*ns)[i].Value) > len((*ns)[j].Value) ||
-		len((*ns)[i].Children) > len((*ns)[j].Children) ||
-		(*ns)[i].Pos < (*ns)[j].Pos ||
-		(*ns)[i].Key < (*ns)[j].Key
-}
-
-func (ns *nodesSorter) Swap(i, j int) { (*ns)[i], (*ns)[j] = (*ns)[j], (*ns)[i] }
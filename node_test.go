@@ -91,3 +91,128 @@ func TestNodes_Best(t *testing.T) {
 		)
 	}
 }
+
+func TestNode_Prune(t *testing.T) {
+	n := &abnf.Node{
+		Key:   "r1",
+		Value: []byte("abc"),
+		Children: abnf.Nodes{
+			{
+				Key:   `"a" r2`,
+				Value: []byte("ab"),
+				Children: abnf.Nodes{
+					{Key: `"a"`, Value: []byte("a")},
+					{
+						Key:   "r2",
+						Pos:   1,
+						Value: []byte("b"),
+						Children: abnf.Nodes{
+							{Key: `"b"`, Pos: 1, Value: []byte("b")},
+						},
+					},
+				},
+			},
+			{Key: "r2", Pos: 2, Value: []byte("c")},
+		},
+	}
+	want := abnf.Nodes{
+		{
+			Key:   "r1",
+			Value: []byte("abc"),
+			Children: abnf.Nodes{
+				{Key: "r2", Pos: 1, Value: []byte("b")},
+				{Key: "r2", Pos: 2, Value: []byte("c")},
+			},
+		},
+	}
+
+	got := n.Prune(abnf.KeepKeys("r1", "r2"))
+	if !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("n.Prune(keep) = %+v, want %+v\ndiff (-got +want):\n%v",
+			got, want,
+			cmp.Diff(got, want, cmpopts.EquateEmpty()),
+		)
+	}
+	if n.Children[0].Key != `"a" r2` {
+		t.Fatalf("n.Prune(keep) modified the original tree")
+	}
+
+	want = abnf.Nodes{
+		{Key: "r2", Pos: 1, Value: []byte("b")},
+		{Key: "r2", Pos: 2, Value: []byte("c")},
+	}
+	if got := n.Prune(abnf.KeepKeys("r2")); !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("n.Prune(keep) = %+v, want %+v\ndiff (-got +want):\n%v",
+			got, want,
+			cmp.Diff(got, want, cmpopts.EquateEmpty()),
+		)
+	}
+}
+
+func TestNode_Detach(t *testing.T) {
+	in := []byte("abc")
+	n := &abnf.Node{
+		Key:   "abc",
+		Value: in,
+		Children: abnf.Nodes{
+			{Key: "a", Value: in[0:1]},
+			{Key: "bc", Pos: 1, Value: in[1:3]},
+		},
+	}
+
+	cn, dn := n.Clone(), n.Detach()
+	if !cmp.Equal(cn, n) {
+		t.Fatalf("n.Clone() = %+v, want %+v\ndiff (-got +want):\n%v", cn, n, cmp.Diff(cn, n))
+	}
+	if !cmp.Equal(dn, n) {
+		t.Fatalf("n.Detach() = %+v, want %+v\ndiff (-got +want):\n%v", dn, n, cmp.Diff(dn, n))
+	}
+
+	copy(in, "xyz")
+	if got := cn.Children[1].String(); got != "yz" {
+		t.Errorf("cloned node value = %q, want %q", got, "yz")
+	}
+	if got := dn.String(); got != "abc" {
+		t.Errorf("detached node value = %q, want %q", got, "abc")
+	}
+	if got := dn.Children[1].String(); got != "bc" {
+		t.Errorf("detached child value = %q, want %q", got, "bc")
+	}
+}
+
+func TestEnableNodeCacheIsolation(t *testing.T) {
+	abnf.EnableNodeCache(0)
+	defer abnf.DisableNodeCache()
+	abnf.EnableNodeCacheIsolation()
+	defer abnf.DisableNodeCacheIsolation()
+
+	op := abnf.Concat(`"a" "b"`, abnf.Literal(`"a"`, []byte("a")), abnf.Literal(`"b"`, []byte("b")))
+
+	ns1 := abnf.NewNodes()
+	defer ns1.Free()
+	in1 := []byte("ab")
+	if err := op(nil, in1, 0, ns1); err != nil {
+		t.Fatalf("op(in1, 0, ns1) error = %v, want nil", err)
+	}
+	n1 := ns1.Best()
+	n1.Children = n1.Children[:1]
+
+	ns2 := abnf.NewNodes()
+	defer ns2.Free()
+	in2 := []byte("ab")
+	if err := op(nil, in2, 0, ns2); err != nil {
+		t.Fatalf("op(in2, 0, ns2) error = %v, want nil", err)
+	}
+	n2 := ns2.Best()
+	if n1 == n2 {
+		t.Fatalf("op returned the same node for different callers")
+	}
+	if got := len(n2.Children); got != 2 {
+		t.Fatalf("len(n2.Children) = %d, want 2", got)
+	}
+
+	copy(in1, "zz")
+	if got := n2.String(); got != "ab" {
+		t.Fatalf("n2.String() = %q, want %q", got, "ab")
+	}
+}
@@ -0,0 +1,147 @@
+//go:build abnf_debug
+
+package abnf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// NodesDebug reports whether the package is built with the abnf_debug build tag.
+// In the debug build every list returned by [NewNodes] is tracked:
+// freed lists are poisoned and never returned to the pool,
+// any use of a freed list panics with its allocation and free stacks,
+// and [CheckNodesLeaks] reports lists that were never freed.
+const NodesDebug = true
+
+type nodesInfo struct {
+	alloc []uintptr
+}
+
+// nodesInfos tracks lists that are allocated and not freed yet.
+var (
+	nodesInfosMu sync.Mutex
+	nodesInfos   = make(map[*Nodes]*nodesInfo)
+)
+
+// freedMark marks the hidden node of freed lists, see poisonNodes.
+var freedMark = &Node{}
+
+// poisonNodes returns an empty list that replaces the freed one.
+// Its only hidden node, beyond the length, holds allocation and free stacks,
+// so freed lists don't stay in nodesInfos and their stacks are collected with them.
+// Program counters of the stacks are encoded in the node value, the allocation stack goes first.
+func poisonNodes(info *nodesInfo) Nodes {
+	free := callers()
+	val := make([]byte, 0, 8*(len(info.alloc)+len(free)))
+	for _, pcs := range [][]uintptr{info.alloc, free} {
+		for _, pc := range pcs {
+			val = binary.NativeEndian.AppendUint64(val, uint64(pc))
+		}
+	}
+	return Nodes{{
+		Pos:      uint(len(info.alloc)),
+		Value:    val,
+		Children: Nodes{freedMark},
+	}}[:0]
+}
+
+// freedNodes returns the hidden node of the freed list or nil if the list isn't freed.
+func freedNodes(ns *Nodes) *Node {
+	if len(*ns) != 0 || cap(*ns) != 1 {
+		return nil
+	}
+	n := (*ns)[:1][0]
+	if n == nil || len(n.Children) != 1 || n.Children[0] != freedMark {
+		return nil
+	}
+	return n
+}
+
+// fmtFreedStacks formats stacks of the freed list from its hidden node.
+func fmtFreedStacks(n *Node) string {
+	pcs := make([]uintptr, 0, len(n.Value)/8)
+	for v := n.Value; len(v) >= 8; v = v[8:] {
+		pcs = append(pcs, uintptr(binary.NativeEndian.Uint64(v)))
+	}
+	return fmt.Sprintf("allocated at:\n%sfreed at:\n%s", fmtStack(pcs[:n.Pos]), fmtStack(pcs[n.Pos:]))
+}
+
+func callers() []uintptr {
+	pcs := make([]uintptr, 32)
+	return pcs[:runtime.Callers(3, pcs)]
+}
+
+func fmtStack(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&sb, "\t%s\n\t\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+func debugNodesAlloc(ns *Nodes) {
+	nodesInfosMu.Lock()
+	defer nodesInfosMu.Unlock()
+
+	nodesInfos[ns] = &nodesInfo{alloc: callers()}
+}
+
+// debugNodesFree poisons the list and reports whether it must not be returned to the pool.
+// The list is removed from nodesInfos.
+func debugNodesFree(ns *Nodes) bool {
+	if ns == nil {
+		return true
+	}
+	if n := freedNodes(ns); n != nil {
+		panic("abnf: Nodes freed twice\n" + fmtFreedStacks(n))
+	}
+
+	nodesInfosMu.Lock()
+	info, ok := nodesInfos[ns]
+	delete(nodesInfos, ns)
+	nodesInfosMu.Unlock()
+
+	if !ok {
+		// list wasn't created by NewNodes
+		return false
+	}
+
+	clear(*ns)
+	*ns = poisonNodes(info)
+	return true
+}
+
+func debugNodesCheck(ns *Nodes) {
+	if ns == nil {
+		return
+	}
+	if n := freedNodes(ns); n != nil {
+		panic("abnf: use of freed Nodes\n" + fmtFreedStacks(n))
+	}
+}
+
+// CheckNodesLeaks returns an error that lists allocation stacks of all [Nodes]
+// created by [NewNodes] and not freed yet.
+// Reported lists are forgotten, so subsequent calls report only new leaks.
+// It always returns nil unless the package is built with the abnf_debug build tag.
+func CheckNodesLeaks() error {
+	nodesInfosMu.Lock()
+	defer nodesInfosMu.Unlock()
+
+	var errs []error
+	for ns, info := range nodesInfos {
+		errs = append(errs, fmt.Errorf("abnf: Nodes not freed, allocated at:\n%s", fmtStack(info.alloc)))
+		delete(nodesInfos, ns)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+//go:build abnf_debug
+
+package abnf_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+)
+
+func TestNodes_UseAfterFree(t *testing.T) {
+	ns := abnf.NewNodes()
+	ns.Free()
+
+	defer func() {
+		r := recover()
+		msg, _ := r.(string)
+		if !strings.Contains(msg, "use of freed Nodes") || !strings.Contains(msg, "TestNodes_UseAfterFree") {
+			t.Fatalf("ns.Append() panic = %v, want use of freed Nodes", r)
+		}
+	}()
+
+	ns.Append(&abnf.Node{Key: "a"})
+}
+
+func TestNodes_DoubleFree(t *testing.T) {
+	ns := abnf.NewNodes()
+	ns.Free()
+
+	defer func() {
+		r := recover()
+		msg, _ := r.(string)
+		if !strings.Contains(msg, "Nodes freed twice") || !strings.Contains(msg, "TestNodes_DoubleFree") {
+			t.Fatalf("ns.Free() panic = %v, want Nodes freed twice", r)
+		}
+	}()
+
+	ns.Free()
+}
+
+func TestCheckNodesLeaks(t *testing.T) {
+	if err := abnf.CheckNodesLeaks(); err != nil {
+		t.Fatalf("abnf.CheckNodesLeaks() error = %v, want nil", err)
+	}
+
+	abnf.NewNodes().Free()
+	if err := abnf.CheckNodesLeaks(); err != nil {
+		t.Fatalf("abnf.CheckNodesLeaks() error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	err := abnf.CheckNodesLeaks()
+	if err == nil || !strings.Contains(err.Error(), "TestCheckNodesLeaks") {
+		t.Fatalf("abnf.CheckNodesLeaks() error = %v, want leak report", err)
+	}
+	_ = ns
+}
@@ -0,0 +1,24 @@
+package abnf
+
+import (
+	"fmt"
+	"os"
+)
+
+// RunWithLeakCheck runs tests with m, usually [testing.M], and then checks that all [Nodes]
+// created by the tests are freed, see [CheckNodesLeaks]. Leaks are printed to the standard error.
+// It returns the exit code of the tests or 1 if the tests passed but leaked, so it's called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(abnf.RunWithLeakCheck(m))
+//	}
+func RunWithLeakCheck(m interface{ Run() int }) int {
+	code := m.Run()
+	if err := CheckNodesLeaks(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,22 @@
+//go:build !abnf_debug
+
+package abnf
+
+// NodesDebug reports whether the package is built with the abnf_debug build tag.
+// In the debug build every list returned by [NewNodes] is tracked:
+// freed lists are poisoned and never returned to the pool,
+// any use of a freed list panics with its allocation and free stacks,
+// and [CheckNodesLeaks] reports lists that were never freed.
+const NodesDebug = false
+
+func debugNodesAlloc(*Nodes) {}
+
+func debugNodesFree(*Nodes) bool { return false }
+
+func debugNodesCheck(*Nodes) {}
+
+// CheckNodesLeaks returns an error that lists allocation stacks of all [Nodes]
+// created by [NewNodes] and not freed yet.
+// Reported lists are forgotten, so subsequent calls report only new leaks.
+// It always returns nil unless the package is built with the abnf_debug build tag.
+func CheckNodesLeaks() error { return nil }
@@ -2,29 +2,47 @@ package abnf
 
 import (
 	"bytes"
-	"sort"
+	"fmt"
+	"strconv"
 	"unicode/utf8"
 )
 
 // Operator represents an ABNF operator.
-type Operator = func(in []byte, pos uint, ns *Nodes) error
+// It matches in from pos and appends matched nodes to ns, ctx carries options of the parse, see [Context].
+type Operator = func(ctx *Context, in []byte, pos uint, ns *Nodes) error
+
+// LegacyOperator is the operator signature without the parse [Context], used by operators
+// written before the context was introduced.
+type LegacyOperator = func(in []byte, pos uint, ns *Nodes) error
+
+// FromLegacy wraps the operator op written with the [LegacyOperator] signature to an [Operator].
+// Parse options don't reach op and operators it invokes, op runs with the defaults as it did before.
+// Operators are converted back by invoking them with a nil context: op(nil, in, pos, ns).
+func FromLegacy(op LegacyOperator) Operator {
+	return func(_ *Context, in []byte, pos uint, ns *Nodes) error {
+		return op(in, pos, ns)
+	}
+}
 
 func literal(key string, want []byte, ci bool) Operator {
-	return func(in []byte, pos uint, ns *Nodes) error {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
 		if len(in[pos:]) < len(want) {
+			if ctx.tracksPartial() && hasPrefixFold(want, in[pos:], ci) {
+				ctx.NeedMore(uint(len(want) - len(in[pos:])))
+			}
 			return wrapNotMatched(key, pos)
 		}
 
 		got := in[pos : int(pos)+len(want)]
 		if !bytes.Equal(got, want) {
-			if !ci || !bytes.Equal(toLower(want), toLower(got)) {
+			if !ci || !EqualFold(want, got) {
 				return wrapNotMatched(key, pos)
 			}
 		}
 
 		ns.Append(loadOrStoreNode(
 			newNodeCacheKey(key, pos, uint(len(got)), in),
-			func() *Node { return &Node{Key: key, Pos: pos, Value: got} },
+			func() *Node { return ctx.newNode(key, pos, got) },
 		))
 		return nil
 	}
@@ -36,6 +54,27 @@ func Literal(key string, val []byte) Operator {
 	return literal(key, val, true)
 }
 
+// EqualFold reports whether a and b are equal case-insensitively, as [Literal] compares them:
+// values with upper-case letters are lower-cased with [bytes.ToLower], other values are compared as is.
+func EqualFold(a, b []byte) bool {
+	if len(a) == len(b) {
+		i := 0
+		for ; i < len(a); i++ {
+			x, y := a[i], b[i]
+			if x >= utf8.RuneSelf || y >= utf8.RuneSelf {
+				break
+			}
+			if x != y && lowerASCII(x) != lowerASCII(y) {
+				return false
+			}
+		}
+		if i == len(a) {
+			return true
+		}
+	}
+	return bytes.Equal(toLower(a), toLower(b))
+}
+
 // LiteralCS defines a case-sensitive characters sequence.
 // It returns ErrNotMatched if input doesn't match.
 func LiteralCS(key string, val []byte) Operator {
@@ -45,8 +84,15 @@ func LiteralCS(key string, val []byte) Operator {
 // Range defines a range of alternative numeric values.
 // It returns ErrNotMatched if input doesn't match.
 func Range(key string, low, high []byte) Operator {
-	return func(in []byte, pos uint, ns *Nodes) error {
-		if len(in[pos:]) < len(low) || bytes.Compare(in[pos:int(pos)+len(low)], low) < 0 {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		if len(in[pos:]) < len(low) {
+			if k := len(in[pos:]); ctx.tracksPartial() &&
+				bytes.Compare(in[pos:], low[:k]) >= 0 && bytes.Compare(in[pos:], high[:min(k, len(high))]) <= 0 {
+				ctx.NeedMore(uint(len(low) - k))
+			}
+			return wrapNotMatched(key, pos)
+		}
+		if bytes.Compare(in[pos:int(pos)+len(low)], low) < 0 {
 			return wrapNotMatched(key, pos)
 		}
 
@@ -66,14 +112,14 @@ func Range(key string, low, high []byte) Operator {
 
 		ns.Append(loadOrStoreNode(
 			newNodeCacheKey(key, pos, uint(l), in),
-			func() *Node { return &Node{Key: key, Pos: pos, Value: in[pos : int(pos)+l]} },
+			func() *Node { return ctx.newNode(key, pos, in[pos:int(pos)+l]) },
 		))
 		return nil
 	}
 }
 
 func alt(key string, fm bool, op Operator, ops ...Operator) Operator {
-	return func(in []byte, pos uint, ns *Nodes) (finErr error) {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) (finErr error) {
 		resns, subns := NewNodes(), NewNodes()
 		defer resns.Free()
 		defer subns.Free()
@@ -101,7 +147,7 @@ func alt(key string, fm bool, op Operator, ops ...Operator) Operator {
 			}
 
 			subns.Clear()
-			if err := o(in, pos, subns); err != nil {
+			if err := o(ctx, in, pos, subns); err != nil {
 				if detail {
 					if me == nil {
 						me = newMultiErr(uint(len(ops) + 1))
@@ -119,7 +165,7 @@ func alt(key string, fm bool, op Operator, ops ...Operator) Operator {
 			}
 
 			for _, sn := range subns.All() {
-				resns.Append(newAltNode(key, pos, sn, in))
+				resns.Append(newAltNode(ctx, key, pos, sn, in))
 			}
 			lastErr = nil
 
@@ -134,9 +180,7 @@ func alt(key string, fm bool, op Operator, ops ...Operator) Operator {
 		}
 
 		if resns.Len() > 0 {
-			if resns.Len() > 1 {
-				sort.Sort((*nodesSorter)(resns))
-			}
+			resns.SortBy(ctx.Policy())
 			ns.Append(resns.All()...)
 			if detail {
 				me.clear()
@@ -157,24 +201,28 @@ func alt(key string, fm bool, op Operator, ops ...Operator) Operator {
 }
 
 // newAltNode creates a new alternative node with the given key, position, and subnode
-func newAltNode(key string, pos uint, sn *Node, in []byte) *Node {
+func newAltNode(ctx *Context, key string, pos uint, sn *Node, in []byte) *Node {
+	add := []*Node{sn}
+	if ctx.pruned(sn) {
+		add = sn.Children
+	}
 	return loadOrStoreNode(
-		newNodeCacheKey(key, pos, uint(len(sn.Value)), in, sn),
+		newNodeCacheKey(key, pos, uint(len(sn.Value)), in, add...),
 		func() *Node {
-			chns := make(Nodes, 1)
-			chns[0] = sn
-			return &Node{
-				Key:      key,
-				Pos:      pos,
-				Value:    in[pos : pos+uint(len(sn.Value))],
-				Children: chns,
+			var chns Nodes
+			if len(add) > 0 {
+				chns = ctx.newChildren(len(add))
+				copy(chns, add)
 			}
+			n := ctx.newNode(key, pos, in[pos:pos+uint(len(sn.Value))])
+			n.Children = chns
+			return n
 		},
 	)
 }
 
 // Alt defines a sequence of alternative elements that are separated by a forward slash ("/").
-// Created operator will return all matched alternatives.
+// Created operator will return all matched alternatives ordered by the parse [Policy].
 // It returns joined errors if all alternatives failed.
 func Alt(key string, op Operator, ops ...Operator) Operator {
 	return alt(key, false, op, ops...)
@@ -188,12 +236,12 @@ func AltFirst(key string, op Operator, ops ...Operator) Operator {
 }
 
 func concat(key string, all bool, op Operator, ops ...Operator) Operator {
-	return func(in []byte, pos uint, ns *Nodes) (finErr error) {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) (finErr error) {
 		resns := NewNodes()
 		defer resns.Free()
 		resns.Append(loadOrStoreNode(
 			newNodeCacheKey(key, pos, 0, in),
-			func() *Node { return &Node{Key: key, Pos: pos, Value: in[pos:pos]} },
+			func() *Node { return ctx.newNode(key, pos, in[pos:pos]) },
 		))
 
 		newns, subns := NewNodes(), NewNodes()
@@ -225,7 +273,7 @@ func concat(key string, all bool, op Operator, ops ...Operator) Operator {
 			newns.Clear()
 			for _, n := range resns.All() {
 				subns.Clear()
-				if err := o(in, n.Pos+uint(len(n.Value)), subns); err != nil {
+				if err := o(ctx, in, n.Pos+uint(len(n.Value)), subns); err != nil {
 					if detail {
 						if me == nil {
 							me = newMultiErr(uint(len(ops) + 1))
@@ -238,7 +286,7 @@ func concat(key string, all bool, op Operator, ops ...Operator) Operator {
 				}
 
 				for _, sn := range subns.All() {
-					newns.Append(newConcatNode(key, n, sn, in))
+					newns.Append(newConcatNode(ctx, key, n, sn, in))
 				}
 			}
 
@@ -262,7 +310,7 @@ func concat(key string, all bool, op Operator, ops ...Operator) Operator {
 
 		if resns.Len() > 0 {
 			if resns.Len() > 1 && !all {
-				ns.Append(resns.Best())
+				ns.Append(resns.BestBy(ctx.Policy()))
 			} else {
 				ns.Append(resns.All()...)
 			}
@@ -285,24 +333,29 @@ func concat(key string, all bool, op Operator, ops ...Operator) Operator {
 }
 
 // newConcatNode creates a new node that represents the concatenation of n and sn
-func newConcatNode(key string, n, sn *Node, in []byte) *Node {
+func newConcatNode(ctx *Context, key string, n, sn *Node, in []byte) *Node {
+	add := []*Node{sn}
+	if ctx.pruned(sn) {
+		add = sn.Children
+	}
 	ck := newNodeCacheKey(key, n.Pos, uint(len(n.Value)+len(sn.Value)), in, n.Children...)
-	ck.writeChildKeys(0, sn)
+	ck.writeChildKeys(0, add...)
 	return loadOrStoreNode(ck, func() *Node {
-		chns := make(Nodes, len(n.Children)+1)
-		copy(chns, n.Children)
-		chns[len(n.Children)] = sn
-		return &Node{
-			Key:      key,
-			Pos:      n.Pos,
-			Value:    in[n.Pos : int(n.Pos)+len(n.Value)+len(sn.Value)],
-			Children: chns,
+		var chns Nodes
+		if l := len(n.Children) + len(add); l > 0 {
+			chns = ctx.newChildren(l)
+			copy(chns, n.Children)
+			copy(chns[len(n.Children):], add)
 		}
+		cn := ctx.newNode(key, n.Pos, in[n.Pos:int(n.Pos)+len(n.Value)+len(sn.Value)])
+		cn.Children = chns
+		return cn
 	})
 }
 
 // Concat defines a simple, ordered string of values.
-// Created operator will return the longest alternative.
+// Created operator will return the alternative preferred by the parse [Policy],
+// the longest one by default.
 // It returns error if one of the operators failed.
 func Concat(key string, op Operator, ops ...Operator) Operator {
 	return concat(key, false, op, ops...)
@@ -316,8 +369,26 @@ func ConcatAll(key string, op Operator, ops ...Operator) Operator {
 }
 
 // Repeat defines a variable repetition.
+// Created operator will return all matched repetitions ordered by the parse [Policy].
 // It returns error in case when operator wasn't matched min times.
 func Repeat(key string, min, max uint, op Operator) Operator {
+	return repeat(key, min, max, false, op)
+}
+
+// RepeatLazy defines a non-greedy variable repetition.
+// Created operator will return the same matches as [Repeat], but ordered by ascending
+// repetition count regardless of the parse [Policy], so the first match is the shortest one.
+// Combined with first-match operators like [AltFirst] or [PolicyFirst] it behaves
+// as a non-greedy repetition.
+//
+// It only reorders matches: operators don't see what follows them, so all repetition counts
+// are still matched up to max, it doesn't stop at the first count that lets the continuation succeed.
+// It returns error in case when operator wasn't matched min times.
+func RepeatLazy(key string, min, max uint, op Operator) Operator {
+	return repeat(key, min, max, true, op)
+}
+
+func repeat(key string, min, max uint, lazy bool, op Operator) Operator {
 	// Create operator for minimum required repetitions
 	var minOp Operator
 	if min > 0 {
@@ -328,16 +399,16 @@ func Repeat(key string, min, max uint, op Operator) Operator {
 		minOp = concat(key, true, ops[0], ops[1:]...)
 	}
 
-	return func(in []byte, pos uint, ns *Nodes) error {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
 		resns := NewNodes()
 		defer resns.Free()
 
 		if min == 0 {
 			resns.Append(loadOrStoreNode(
 				newNodeCacheKey(key, pos, 0, in),
-				func() *Node { return &Node{Key: key, Pos: pos, Value: in[pos:pos]} },
+				func() *Node { return ctx.newNode(key, pos, in[pos:pos]) },
 			))
-		} else if err := minOp(in, pos, resns); err != nil {
+		} else if err := minOp(ctx, in, pos, resns); err != nil {
 			return wrapOperError(key, pos, err)
 		}
 
@@ -361,13 +432,13 @@ func Repeat(key string, min, max uint, op Operator) Operator {
 			newns.Clear()
 			for _, n := range curns.All() {
 				subns.Clear()
-				if err := op(in, n.Pos+uint(len(n.Value)), subns); err != nil {
+				if err := op(ctx, in, n.Pos+uint(len(n.Value)), subns); err != nil {
 					// ignore errors, we already match min times
 					continue
 				}
 
 				for _, sn := range subns.All() {
-					newns.Append(newConcatNode(key, n, sn, in))
+					newns.Append(newConcatNode(ctx, key, n, sn, in))
 				}
 			}
 
@@ -379,14 +450,86 @@ func Repeat(key string, min, max uint, op Operator) Operator {
 			resns.Append(curns.All()...)
 		}
 
-		if resns.Len() > 1 {
-			sort.Sort((*nodesSorter)(resns))
+		if !lazy {
+			resns.SortBy(ctx.Policy())
 		}
 		ns.Append(resns.All()...)
 		return nil
 	}
 }
 
+// RepeatPossessive defines a possessive variable repetition.
+// Created operator matches op as many times as possible, taking only the match
+// preferred by the parse [Policy] on every step, and returns the single longest repetition.
+// Shorter repetitions are never returned, so enclosing operators can't backtrack into it.
+// An operator that succeeds without returning nodes is treated as not matched.
+// It returns error in case when operator wasn't matched min times.
+func RepeatPossessive(key string, min, max uint, op Operator) Operator {
+	if 0 < max && max < min {
+		max = min
+	}
+
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		subns := NewNodes()
+		defer subns.Free()
+
+		n := loadOrStoreNode(
+			newNodeCacheKey(key, pos, 0, in),
+			func() *Node { return ctx.newNode(key, pos, in[pos:pos]) },
+		)
+		for i := uint(0); i < max || max == 0; i++ {
+			subns.Clear()
+			if err := op(ctx, in, n.Pos+uint(len(n.Value)), subns); err != nil {
+				if i < min {
+					return wrapOperError(key, pos, err)
+				}
+				break
+			}
+
+			sn := subns.BestBy(ctx.Policy())
+			if sn == nil {
+				// op succeeded without matches, which is a failure of the repetition
+				if i < min {
+					return wrapNotMatched(key, pos)
+				}
+				break
+			}
+			if sn.IsEmpty() && i >= min {
+				// empty match can repeat infinitely
+				break
+			}
+			n = newConcatNode(ctx, key, n, sn, in)
+		}
+
+		ns.Append(n)
+		return nil
+	}
+}
+
+// Atomic defines an atomic group.
+// Created operator returns a single node with the only child - the match of op
+// preferred by the parse [Policy]. Other matches are discarded,
+// so enclosing operators can't backtrack into the group.
+// The group node wraps the match of op the same way an alternation node wraps its alternative,
+// so trees of atomic groups have an extra level keyed by key.
+// It returns error if op failed.
+func Atomic(key string, op Operator) Operator {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		subns := NewNodes()
+		defer subns.Free()
+
+		if err := op(ctx, in, pos, subns); err != nil {
+			return wrapOperError(key, pos, err)
+		}
+		if subns.Len() == 0 {
+			return wrapNotMatched(key, pos)
+		}
+
+		ns.Append(newAltNode(ctx, key, pos, subns.BestBy(ctx.Policy()), in))
+		return nil
+	}
+}
+
 // RepeatN defines a specific repetition.
 func RepeatN(key string, n uint, op Operator) Operator {
 	return Repeat(key, n, n, op)
@@ -408,3 +551,173 @@ func Repeat1Inf(key string, op Operator) Operator {
 func Optional(key string, op Operator) Operator {
 	return Repeat(key, 0, 1, op)
 }
+
+// Pruned wraps op so that nodes created by op keep only children accepted by keep,
+// as parses started with [WithPrune] do. The top-level nodes are always kept,
+// so the created operator can be combined with other operators as usual.
+//
+// Pruning is set up once, by the outermost pruned operator of the parse:
+// if the parse is already pruned, by another pruned operator or [WithPrune], op is invoked with that filter.
+func Pruned(op Operator, keep func(n *Node) bool) Operator {
+	// a context with the filter only has no parse state, so parses with defaults share it
+	pctx := NewContext(WithPrune(keep))
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		switch {
+		case ctx == nil:
+			ctx = pctx
+		case ctx.keep == nil:
+			ctx = ctx.with(WithPrune(keep))
+		}
+		return op(ctx, in, pos, ns)
+	}
+}
+
+// Octets defines exactly n arbitrary octets.
+// It returns ErrNotMatched if input is shorter than n octets.
+func Octets(key string, n uint) Operator {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		if uint(len(in[pos:])) < n {
+			ctx.NeedMore(n - uint(len(in[pos:])))
+			return wrapNotMatched(key, pos)
+		}
+
+		ns.Append(loadOrStoreNode(
+			newNodeCacheKey(key, pos, n, in),
+			func() *Node { return ctx.newNode(key, pos, in[pos:pos+n]) },
+		))
+		return nil
+	}
+}
+
+// NumberFunc converts a matched node to a number, see [Bind].
+type NumberFunc = func(n *Node) (uint, error)
+
+// DecNumber converts the node value in decimal notation to a number.
+func DecNumber(n *Node) (uint, error) {
+	v, err := strconv.ParseUint(n.String(), 10, strconv.IntSize)
+	return uint(v), err
+}
+
+// HexNumber converts the node value in hexadecimal notation to a number.
+func HexNumber(n *Node) (uint, error) {
+	v, err := strconv.ParseUint(n.String(), 16, strconv.IntSize)
+	return uint(v), err
+}
+
+// Bind defines a data-dependent sequence, e.g. a length-prefixed field.
+// Created operator matches op, converts the match to a number with num
+// and then matches the operator returned by next for that number right after the match.
+// Created node has two children: the match of op and the match of the next operator.
+// If op or the next operator return several matches, the one preferred by the parse [Policy] is returned.
+// It returns error if op failed, the match can't be converted to a number or the next operator failed.
+func Bind(key string, op Operator, num NumberFunc, next func(n uint) Operator) Operator {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		subns, nextns, resns := NewNodes(), NewNodes(), NewNodes()
+		defer subns.Free()
+		defer nextns.Free()
+		defer resns.Free()
+
+		if err := op(ctx, in, pos, subns); err != nil {
+			return wrapOperError(key, pos, err)
+		}
+
+		zn := loadOrStoreNode(
+			newNodeCacheKey(key, pos, 0, in),
+			func() *Node { return ctx.newNode(key, pos, in[pos:pos]) },
+		)
+
+		var lastErr error
+		for _, sn := range subns.All() {
+			v, err := num(sn)
+			if err != nil {
+				lastErr = fmt.Errorf("%w: %w", ErrNotMatched, err)
+				continue
+			}
+
+			nextns.Clear()
+			if err := next(v)(ctx, in, sn.Pos+uint(len(sn.Value)), nextns); err != nil {
+				lastErr = err
+				continue
+			}
+
+			bn := newConcatNode(ctx, key, zn, sn, in)
+			for _, nn := range nextns.All() {
+				resns.Append(newConcatNode(ctx, key, bn, nn, in))
+			}
+		}
+
+		if resns.Len() == 0 {
+			if lastErr == nil {
+				lastErr = ErrNotMatched
+			}
+			return wrapOperError(key, pos, lastErr)
+		}
+
+		ns.Append(resns.BestBy(ctx.Policy()))
+		return nil
+	}
+}
+
+// ByteClass defines a single octet from the set.
+// It is a faster equivalent of an alternation of single octet values and ranges.
+// It returns ErrNotMatched if input doesn't match.
+func ByteClass(key string, set ByteSet) Operator {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		if len(in[pos:]) == 0 {
+			ctx.NeedMore(1)
+			return wrapNotMatched(key, pos)
+		}
+		if !set.Has(in[pos]) {
+			return wrapNotMatched(key, pos)
+		}
+
+		ns.Append(loadOrStoreNode(
+			newNodeCacheKey(key, pos, 1, in),
+			func() *Node { return ctx.newNode(key, pos, in[pos:pos+1]) },
+		))
+		return nil
+	}
+}
+
+// Predicate defines a single UTF-8 encoded character accepted by f.
+// Invalid encodings are passed to f as [utf8.RuneError] one octet long.
+// It returns ErrNotMatched if input is empty or f rejects the character.
+func Predicate(key string, f func(r rune) bool) Operator {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		if len(in[pos:]) == 0 {
+			ctx.NeedMore(1)
+			return wrapNotMatched(key, pos)
+		}
+
+		r, size := utf8.DecodeRune(in[pos:])
+		if !f(r) {
+			if !utf8.FullRune(in[pos:]) {
+				ctx.NeedMore(1)
+			}
+			return wrapNotMatched(key, pos)
+		}
+
+		ns.Append(loadOrStoreNode(
+			newNodeCacheKey(key, pos, uint(size), in),
+			func() *Node { return ctx.newNode(key, pos, in[pos:pos+uint(size)]) },
+		))
+		return nil
+	}
+}
+
+// Predict defines a guard of op that invokes op only if the next input octet is in the set first,
+// usually a FIRST set of op, i.e. a set of octets any match of op starts with.
+// It must not be used with operators that can match empty input.
+// It returns ErrNotMatched without invoking op if the input is over or the next octet isn't in first.
+func Predict(key string, first ByteSet, op Operator) Operator {
+	return func(ctx *Context, in []byte, pos uint, ns *Nodes) error {
+		if len(in[pos:]) == 0 {
+			ctx.NeedMore(1)
+			return wrapNotMatched(key, pos)
+		}
+		if !first.Has(in[pos]) {
+			return wrapNotMatched(key, pos)
+		}
+		return op(ctx, in, pos, ns)
+	}
+}
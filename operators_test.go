@@ -1,13 +1,16 @@
 package abnf_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"unicode"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
 )
 
 func TestOperator(t *testing.T) {
@@ -625,15 +628,6 @@ func TestOperator(t *testing.T) {
 						},
 					},
 				},
-				{
-					Key:   `*( [ "a" ] )`,
-					Pos:   0,
-					Value: []byte(""),
-					Children: abnf.Nodes{
-						{Key: `[ "a" ]`, Pos: 0, Value: []byte("")},
-						{Key: `[ "a" ]`, Pos: 0, Value: []byte("")},
-					},
-				},
 				{
 					Key:   `*( [ "a" ] )`,
 					Pos:   0,
@@ -649,6 +643,15 @@ func TestOperator(t *testing.T) {
 						},
 					},
 				},
+				{
+					Key:   `*( [ "a" ] )`,
+					Pos:   0,
+					Value: []byte(""),
+					Children: abnf.Nodes{
+						{Key: `[ "a" ]`, Pos: 0, Value: []byte("")},
+						{Key: `[ "a" ]`, Pos: 0, Value: []byte("")},
+					},
+				},
 				{
 					Key:   `*( [ "a" ] )`,
 					Pos:   0,
@@ -852,7 +855,7 @@ func TestOperator(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			ns.Clear()
-			err := c.op(c.in, 0, ns)
+			err := c.op(nil, c.in, 0, ns)
 			if c.wantErr == nil {
 				if err != nil {
 					t.Fatalf("op(in, 0, nil) error = %q, want nil", err)
@@ -901,7 +904,7 @@ func TestError(t *testing.T) {
   - operator "\"a\" / \"b\"" failed at position 2:
     - operator "a" failed at position 2: not matched
     - operator "b" failed at position 2: not matched`
-	if err := op([]byte("ccc"), 0, ns); err == nil {
+	if err := op(nil, []byte("ccc"), 0, ns); err == nil {
 		t.Errorf("op(in, 0, nil) error = nil, want %q", want)
 	} else if got := err.Error(); !cmp.Equal(got, want) {
 		t.Errorf("op(in, 0, nil) error = %q, want %q\ndiff (-got +want):\n%v",
@@ -924,7 +927,7 @@ func BenchmarkLiteral(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -948,7 +951,7 @@ func BenchmarkLiteral_unicode(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -972,7 +975,7 @@ func BenchmarkLiteralCS(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -996,7 +999,7 @@ func BenchmarkRange(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -1030,7 +1033,7 @@ func BenchmarkAlt(tb *testing.B) {
 			b.ResetTimer()
 			for b.Loop() {
 				ns.Clear()
-				if err := op(in, 0, ns); err != nil {
+				if err := op(nil, in, 0, ns); err != nil {
 					b.Errorf("operator returned error %q, want nil", err)
 					continue
 				}
@@ -1056,7 +1059,7 @@ func BenchmarkConcat(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -1086,7 +1089,7 @@ func BenchmarkRepeat0Inf(b *testing.B) {
 			b.ResetTimer()
 			for b.Loop() {
 				ns.Clear()
-				if err := op(in, 0, ns); err != nil {
+				if err := op(nil, in, 0, ns); err != nil {
 					b.Errorf("operator returned error %q, want nil", err)
 					continue
 				}
@@ -1122,7 +1125,7 @@ func BenchmarkCombo(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -1154,7 +1157,7 @@ func ExampleConcat() {
 		[]byte("abcdcd"),
 	} {
 		ns.Clear()
-		if err := op(in, 0, ns); err != nil {
+		if err := op(nil, in, 0, ns); err != nil {
 			panic(err)
 		}
 		fmt.Println(ns.Best())
@@ -1165,3 +1168,471 @@ func ExampleConcat() {
 	// abcd
 	// abcdcd
 }
+
+func TestRepeatPossessive(t *testing.T) {
+	op := abnf.RepeatPossessive(`*("a" / "aa")`, 0, 0,
+		abnf.Alt(`"a" / "aa"`,
+			abnf.Literal(`"a"`, []byte("a")),
+			abnf.Literal(`"aa"`, []byte("aa")),
+		),
+	)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("aaab"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+
+	want := &abnf.Nodes{
+		{
+			Key:   `*("a" / "aa")`,
+			Value: []byte("aaa"),
+			Children: abnf.Nodes{
+				{
+					Key:   `"a" / "aa"`,
+					Value: []byte("aa"),
+					Children: abnf.Nodes{
+						{Key: `"aa"`, Value: []byte("aa")},
+					},
+				},
+				{
+					Key:   `"a" / "aa"`,
+					Pos:   2,
+					Value: []byte("a"),
+					Children: abnf.Nodes{
+						{Key: `"a"`, Pos: 2, Value: []byte("a")},
+					},
+				},
+			},
+		},
+	}
+	if !cmp.Equal(ns, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("op(in, 0, ns) = %+v, want %+v\ndiff (-got +want):\n%v",
+			ns, want,
+			cmp.Diff(ns, want, cmpopts.EquateEmpty()),
+		)
+	}
+
+	// possessive repetition doesn't give back matched input
+	concat := abnf.Concat(`*"a" "a"`,
+		abnf.RepeatPossessive(`*"a"`, 0, 0, abnf.Literal(`"a"`, []byte("a"))),
+		abnf.Literal(`"a"`, []byte("a")),
+	)
+	ns.Clear()
+	if err := concat(nil, []byte("aaa"), 0, ns); err == nil {
+		t.Fatalf("concat(in, 0, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+
+	ns.Clear()
+	if err := abnf.RepeatPossessive(`2*"a"`, 2, 0, abnf.Literal(`"a"`, []byte("a")))(nil, []byte("ab"), 0, ns); err == nil {
+		t.Fatalf("op(in, 0, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+
+	// operators that succeed without nodes don't match
+	none := func(*abnf.Context, []byte, uint, *abnf.Nodes) error { return nil }
+	ns.Clear()
+	if err := abnf.RepeatPossessive("1*none", 1, 0, none)(nil, []byte("a"), 0, ns); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Fatalf("op(in, 0, ns) error = %v, want %v", err, abnf.ErrNotMatched)
+	}
+	ns.Clear()
+	if err := abnf.RepeatPossessive("*none", 0, 0, none)(nil, []byte("a"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if got := ns.Best(); got == nil || !got.IsEmpty() {
+		t.Fatalf("op(in, 0, ns) = %+v, want empty match", got)
+	}
+}
+
+func TestRepeatLazy(t *testing.T) {
+	op := abnf.RepeatLazy(`*2"a"`, 0, 2, abnf.Literal(`"a"`, []byte("a")))
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("aaa"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+
+	var got []string
+	for _, n := range ns.All() {
+		got = append(got, n.String())
+	}
+	if want := []string{"", "a", "aa"}; !cmp.Equal(got, want) {
+		t.Fatalf("op(in, 0, ns) = %q, want %q", got, want)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	op := abnf.Atomic(`("a" / "ab")`,
+		abnf.Alt(`"a" / "ab"`,
+			abnf.Literal(`"a"`, []byte("a")),
+			abnf.Literal(`"ab"`, []byte("ab")),
+		),
+	)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("abc"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+
+	want := &abnf.Nodes{
+		{
+			Key:   `("a" / "ab")`,
+			Value: []byte("ab"),
+			Children: abnf.Nodes{
+				{
+					Key:   `"a" / "ab"`,
+					Value: []byte("ab"),
+					Children: abnf.Nodes{
+						{Key: `"ab"`, Value: []byte("ab")},
+					},
+				},
+			},
+		},
+	}
+	if !cmp.Equal(ns, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("op(in, 0, ns) = %+v, want %+v\ndiff (-got +want):\n%v",
+			ns, want,
+			cmp.Diff(ns, want, cmpopts.EquateEmpty()),
+		)
+	}
+
+	ns.Clear()
+	if err := op(nil, []byte("c"), 0, ns); err == nil {
+		t.Fatalf("op(in, 0, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+}
+
+func TestFromLegacy(t *testing.T) {
+	x := abnf.Literal(`"x"`, []byte("x"))
+	legacy := func(in []byte, pos uint, ns *abnf.Nodes) error {
+		return x(nil, in, pos, ns)
+	}
+	op := abnf.Concat(`"a" legacy`, abnf.Literal(`"a"`, []byte("a")), abnf.FromLegacy(legacy))
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(op, []byte("aXb"), ns, abnf.WithMemo()); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+
+	want := &abnf.Nodes{
+		{
+			Key:   `"a" legacy`,
+			Value: []byte("aX"),
+			Children: abnf.Nodes{
+				{Key: `"a"`, Value: []byte("a")},
+				{Key: `"x"`, Pos: 1, Value: []byte("X")},
+			},
+		},
+	}
+	if !cmp.Equal(ns, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("abnf.Parse(op, in, ns) = %+v, want %+v\ndiff (-got +want):\n%v",
+			ns, want,
+			cmp.Diff(ns, want, cmpopts.EquateEmpty()),
+		)
+	}
+
+	ns.Clear()
+	if err := abnf.Parse(op, []byte("ab"), ns); err == nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+}
+
+func TestBind(t *testing.T) {
+	digits := abnf.Repeat("1*DIGIT", 1, 0, abnf_core.Operators().DIGIT)
+	op := abnf.Concat(`"{" literal`,
+		abnf.Literal(`"{"`, []byte("{")),
+		abnf.Bind("literal", digits, abnf.DecNumber, func(n uint) abnf.Operator {
+			return abnf.Concat(`"}" <octets>`,
+				abnf.Literal(`"}"`, []byte("}")),
+				abnf.Octets("<octets>", n),
+			)
+		}),
+	)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("{12}hello, world!"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "{12}hello, world"; got != want {
+		t.Fatalf("op(in, 0, ns) = %q, want %q", got, want)
+	}
+	if n, _ := ns.Best().GetNode("<octets>"); n.String() != "hello, world" {
+		t.Fatalf("op(in, 0, ns).GetNode(\"<octets>\") = %q, want %q", n.String(), "hello, world")
+	}
+
+	ns.Clear()
+	if err := op(nil, []byte("{12}hello"), 0, ns); err == nil {
+		t.Fatalf("op(in, 0, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+
+	hex := abnf.Bind("chunk", abnf.Repeat("1*HEXDIG", 1, 0, abnf.Range("HEXDIG", []byte("0"), []byte("f"))),
+		abnf.HexNumber,
+		func(n uint) abnf.Operator { return abnf.Octets("<octets>", n) },
+	)
+	ns.Clear()
+	if err := hex(nil, []byte("axxxxxxxxxxyy"), 0, ns); err != nil {
+		t.Fatalf("hex(in, 0, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "axxxxxxxxxx"; got != want {
+		t.Fatalf("hex(in, 0, ns) = %q, want %q", got, want)
+	}
+}
+
+func TestByteClass(t *testing.T) {
+	set := abnf.NewByteSet('_')
+	set.AddRange('a', 'z')
+	set.AddRange('0', '9')
+	op := abnf.ByteClass("word", set)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	for _, in := range []string{"a", "z9", "_", "5"} {
+		ns.Clear()
+		if err := op(nil, []byte(in), 0, ns); err != nil {
+			t.Fatalf("op(%q, 0, ns) error = %v, want nil", in, err)
+		}
+		if got, want := ns.Best().String(), in[:1]; got != want {
+			t.Fatalf("op(%q, 0, ns) = %q, want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "A", "-", "\xff"} {
+		ns.Clear()
+		if err := op(nil, []byte(in), 0, ns); err == nil {
+			t.Fatalf("op(%q, 0, ns) error = nil, want %v", in, abnf.ErrNotMatched)
+		}
+	}
+
+	if got, want := set.Len(), 37; got != want {
+		t.Fatalf("set.Len() = %d, want %d", got, want)
+	}
+	if c := set.Complement(); c.Has('a') || !c.Has('A') || c.Len() != 256-37 {
+		t.Fatalf("set.Complement() = %v, want complement of %v", c, set)
+	}
+}
+
+func TestPredicate(t *testing.T) {
+	op := abnf.Predicate("letter", unicode.IsLetter)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("яa"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "я"; got != want {
+		t.Fatalf("op(in, 0, ns) = %q, want %q", got, want)
+	}
+
+	for _, in := range []string{"", "1", "\xff"} {
+		ns.Clear()
+		if err := op(nil, []byte(in), 0, ns); err == nil {
+			t.Fatalf("op(%q, 0, ns) error = nil, want %v", in, abnf.ErrNotMatched)
+		}
+	}
+}
+
+func TestEqualFold(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want bool
+	}{
+		{"sip", "SIP", true},
+		{"sip", "sia", false},
+		{"Straße", "STRASSE", false},
+		{"\u00c4", "\u00e4", true},
+		{"\u03c2", "\u03c3", false},
+		{"\xff", "\xfe", false},
+		{"\xffK", "\xfek", false},
+		{"", "", true},
+	} {
+		if got := abnf.EqualFold([]byte(c.a), []byte(c.b)); got != c.want {
+			t.Errorf("abnf.EqualFold(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestLiteralSet(t *testing.T) {
+	lits := []abnf.LiteralSetItem{
+		{Key: `"GET"`, Value: []byte("GET")},
+		{Key: `"get-all"`, Value: []byte("get-all")},
+		{Key: `%s"Ge"`, Value: []byte("Ge"), CaseSensitive: true},
+		{Key: `"g"`, Value: []byte("g")},
+		{Key: `"ÄB"`, Value: []byte("ÄB")},
+		{Key: `"POST"`, Value: []byte("POST")},
+	}
+	ops := make([]abnf.Operator, len(lits))
+	for i, lit := range lits {
+		if lit.CaseSensitive {
+			ops[i] = abnf.LiteralCS(lit.Key, lit.Value)
+		} else {
+			ops[i] = abnf.Literal(lit.Key, lit.Value)
+		}
+	}
+
+	set := abnf.LiteralSet("method", lits...)
+	alt := abnf.Alt("method", ops[0], ops[1:]...)
+
+	ns, altns := abnf.NewNodes(), abnf.NewNodes()
+	defer ns.Free()
+	defer altns.Free()
+
+	for _, in := range []string{"GET-ALL", "get", "Ge", "gE", "äb", "post", "PUT", ""} {
+		ns.Clear()
+		altns.Clear()
+		err := set(nil, []byte(in), 0, ns)
+		altErr := alt(nil, []byte(in), 0, altns)
+		if (err == nil) != (altErr == nil) {
+			t.Fatalf("set(%q, 0, ns) error = %v, alt error = %v", in, err, altErr)
+		}
+		if !cmp.Equal(ns, altns, cmpopts.EquateEmpty()) {
+			t.Fatalf("set(%q, 0, ns) = %+v, want %+v\ndiff (-got +want):\n%v",
+				in, ns, altns,
+				cmp.Diff(ns, altns, cmpopts.EquateEmpty()),
+			)
+		}
+	}
+}
+
+func TestPredict(t *testing.T) {
+	var calls int
+	lit := abnf.Literal(`"ab"`, []byte("ab"))
+	op := abnf.Predict(`"ab"`, abnf.NewByteSet('a', 'A'), func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		calls++
+		return lit(ctx, in, pos, ns)
+	})
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("AB"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "AB"; got != want {
+		t.Fatalf("op(in, 0, ns) = %q, want %q", got, want)
+	}
+
+	for _, in := range []string{"ba", ""} {
+		ns.Clear()
+		if err := op(nil, []byte(in), 0, ns); err == nil {
+			t.Fatalf("op(%q, 0, ns) error = nil, want %v", in, abnf.ErrNotMatched)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("op was invoked %d times, want 1", calls)
+	}
+}
+
+func TestParse_WithPrune(t *testing.T) {
+	r2 := abnf.Alt("r2", abnf.Literal(`"b"`, []byte("b")), abnf.Literal(`"c"`, []byte("c")))
+	op := abnf.Concat("r1", abnf.Concat(`"a" r2`, abnf.Literal(`"a"`, []byte("a")), r2), r2)
+	in := []byte("abc")
+	keep := abnf.KeepKeys("r1", "r2")
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(op, in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	want := ns.Best().Prune(keep)[0]
+
+	for name, parse := range map[string]func(ns *abnf.Nodes) error{
+		"option": func(ns *abnf.Nodes) error { return abnf.Parse(op, in, ns, abnf.WithPrune(keep)) },
+		"pruned": func(ns *abnf.Nodes) error { return abnf.Parse(abnf.Pruned(op, keep), in, ns) },
+		// the filter of the parse takes precedence over the one of the operator
+		"pruned option": func(ns *abnf.Nodes) error {
+			return abnf.Parse(abnf.Pruned(op, abnf.KeepKeys("r1")), in, ns, abnf.WithPrune(keep))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			abnf.EnableNodeCache(0)
+			defer abnf.DisableNodeCache()
+
+			ns.Clear()
+			if err := parse(ns); err != nil {
+				t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+			}
+			got := ns.Best()
+			if !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+				t.Fatalf("abnf.Parse(op, in, ns) mismatch (-got +want):\n%s", cmp.Diff(got, want, cmpopts.EquateEmpty()))
+			}
+
+			// pruned nodes are cached like any other nodes
+			ns.Clear()
+			if err := parse(ns); err != nil {
+				t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+			}
+			if ns.Best() != got {
+				t.Fatal("abnf.Parse(op, in, ns) returned a new node, want the cached one")
+			}
+		})
+	}
+}
+
+func TestMemo(t *testing.T) {
+	var calls int
+	lit := abnf.Literal(`"a"`, []byte("a"))
+	rule := abnf.Memo(func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		calls++
+		return lit(ctx, in, pos, ns)
+	})
+	// both alternatives start with rule, the second one invokes it again at the same position
+	op := abnf.AltFirst("r",
+		abnf.Concat(`rule "b"`, rule, abnf.Literal(`"b"`, []byte("b"))),
+		abnf.Concat(`rule "c"`, rule, abnf.Literal(`"c"`, []byte("c"))),
+	)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(op, []byte("ac"), ns, abnf.WithMemo()); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns, abnf.WithMemo()) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "ac"; got != want {
+		t.Fatalf("abnf.Parse(op, in, ns, abnf.WithMemo()) = %q, want %q", got, want)
+	}
+	if calls != 1 {
+		t.Fatalf("rule was invoked %d times, want 1", calls)
+	}
+
+	calls = 0
+	ns.Clear()
+	if err := op(nil, []byte("ac"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if calls != 2 {
+		t.Fatalf("rule was invoked %d times without memoization, want 2", calls)
+	}
+
+	// memo tables aren't shared by parses of the same buffer
+	in := []byte("ac")
+	calls = 0
+	for range 2 {
+		ns.Clear()
+		if err := abnf.Parse(op, in, ns, abnf.WithMemo()); err != nil {
+			t.Fatalf("abnf.Parse(op, in, ns, abnf.WithMemo()) error = %v, want nil", err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("rule was invoked %d times by two parses, want 2", calls)
+	}
+
+	calls = 0
+	ns.Clear()
+	if err := abnf.Parse(op, []byte("ad"), ns, abnf.WithMemo()); err == nil {
+		t.Fatal("abnf.Parse(op, in, ns, abnf.WithMemo()) error = nil, want error")
+	}
+	if calls != 1 {
+		t.Fatalf("rule was invoked %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,90 @@
+package abnf
+
+// ParseOption configures a parse started with [Parse].
+type ParseOption func(ctx *Context)
+
+// Context carries options and state of a parse to operators.
+// Operators pass the context they are invoked with to their sub-operators unchanged.
+//
+// A nil context is valid and means the default options, see [Parse].
+// A context belongs to a single parse and must not be shared by concurrent parses.
+type Context struct {
+	policy  Policy
+	memo    *memoTable
+	partial *partialState
+	keep    func(n *Node) bool
+	arena   *nodeArena
+}
+
+// NewContext returns a context of a parse configured with the options.
+// It returns nil if there are no options.
+func NewContext(opts ...ParseOption) *Context {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	ctx := &Context{}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	return ctx
+}
+
+// with returns a copy of the context with the options applied.
+// The copy shares memo tables and partial input state with the context.
+func (ctx *Context) with(opts ...ParseOption) *Context {
+	nctx := &Context{}
+	if ctx != nil {
+		*nctx = *ctx
+	}
+	for _, opt := range opts {
+		opt(nctx)
+	}
+	return nctx
+}
+
+// Policy returns the disambiguation policy of the parse, [PolicyLongest] by default.
+func (ctx *Context) Policy() Policy {
+	if ctx == nil || ctx.policy == nil {
+		return PolicyLongest
+	}
+	return ctx.policy
+}
+
+// WithPolicy sets the disambiguation policy of the parse.
+// By default, [PolicyLongest] is used.
+func WithPolicy(p Policy) ParseOption {
+	return func(ctx *Context) {
+		ctx.policy = p
+	}
+}
+
+// WithMemo enables memoization of results of operators created by [Memo] during the parse.
+// Each memoized operator is invoked at most once per input position,
+// which makes parsing with grammars of ordered choices linear in time, see [Memo].
+func WithMemo() ParseOption {
+	return func(ctx *Context) {
+		ctx.memo = &memoTable{entries: make(map[memoKey]memoEntry)}
+	}
+}
+
+// WithPrune enables pruning of parse trees: nodes created during the parse keep only children accepted by keep,
+// children of rejected nodes are spliced in their place, as [Node.Prune] does.
+// The filter is applied once when a node is created, so rejected nodes are never referenced by kept ones.
+// Nodes returned by the parse are kept regardless of keep.
+func WithPrune(keep func(n *Node) bool) ParseOption {
+	return func(ctx *Context) {
+		ctx.keep = keep
+	}
+}
+
+// pruned reports whether the child node n is spliced into its parent, see [WithPrune].
+func (ctx *Context) pruned(n *Node) bool {
+	return ctx != nil && ctx.keep != nil && !ctx.keep(n)
+}
+
+// Parse parses in with op starting from the position 0 and appends matched nodes to ns.
+// Options apply to all operators invoked during the parse through the parse [Context].
+func Parse(op Operator, in []byte, ns *Nodes, opts ...ParseOption) error {
+	return op(NewContext(opts...), in, 0, ns)
+}
@@ -0,0 +1,106 @@
+package abnf
+
+import "bytes"
+
+// PartialStatus is a status of a parse of a possibly truncated input, see [ParsePartial].
+type PartialStatus uint8
+
+const (
+	// Invalid means that the input doesn't match and more input can't fix it.
+	Invalid PartialStatus = iota
+	// Incomplete means that the input doesn't match but is a prefix of input that might match.
+	Incomplete
+	// Complete means that the input matches.
+	Complete
+)
+
+// String returns the status name.
+func (s PartialStatus) String() string {
+	switch s {
+	case Invalid:
+		return "invalid"
+	case Incomplete:
+		return "incomplete"
+	case Complete:
+		return "complete"
+	default:
+		return "unknown"
+	}
+}
+
+// PartialResult is a result of [ParsePartial].
+type PartialResult struct {
+	Status PartialStatus
+	// Need is the minimum number of more octets needed for a match if the status is [Incomplete],
+	// 0 if it's unknown.
+	Need uint
+	// Node is the match preferred by the parse [Policy] if the status is [Complete].
+	Node *Node
+	// More reports whether the [Complete] match might be extended by more input.
+	More bool
+}
+
+// partialState tracks primitive operators that ran out of input during a parse.
+// It belongs to the parse [Context], so it's updated without locking.
+type partialState struct {
+	hit  bool
+	need uint
+}
+
+func (p *partialState) add(n uint) {
+	if !p.hit || n < p.need {
+		p.need = n
+	}
+	p.hit = true
+}
+
+// NeedMore records that an operator ran out of input and needs at least n more octets to match,
+// see [ParsePartial]. Custom operators that consume input on their own should call it
+// when the input ends before they can decide whether they match.
+func (ctx *Context) NeedMore(n uint) {
+	if ctx != nil && ctx.partial != nil {
+		ctx.partial.add(n)
+	}
+}
+
+// tracksPartial reports whether the parse tracks truncated input.
+func (ctx *Context) tracksPartial() bool {
+	return ctx != nil && ctx.partial != nil
+}
+
+// ParsePartial parses in, which may be truncated, with op starting from the position 0
+// and reports whether it matches, might match with more input or can't match at all.
+// It returns the parse error if the status is [Invalid].
+//
+// Primitive operators ([Literal], [Range], [ByteClass], [Octets], etc.) record matches cut by the end of input,
+// so the result is only as precise as the operators of the grammar: custom operators
+// that don't report truncated input with [Context.NeedMore] make it look invalid.
+// Options are applied as by [Parse].
+func ParsePartial(op Operator, in []byte, opts ...ParseOption) (PartialResult, error) {
+	ctx := &Context{}
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	ctx.partial = &partialState{}
+
+	ns := NewNodes()
+	defer ns.Free()
+
+	// empty input is a prefix of any input
+	if err := op(ctx, in, 0, ns); err != nil {
+		if ctx.partial.hit || len(in) == 0 {
+			return PartialResult{Status: Incomplete, Need: ctx.partial.need}, nil
+		}
+		return PartialResult{Status: Invalid}, err
+	}
+	return PartialResult{Status: Complete, Node: ns.BestBy(ctx.Policy()), More: ctx.partial.hit || len(in) == 0}, nil
+}
+
+// hasPrefixFold reports whether in is a prefix of want, ASCII letters are compared case-insensitively if ci is true.
+func hasPrefixFold(want, in []byte, ci bool) bool {
+	if len(in) > len(want) {
+		return false
+	}
+	want = want[:len(in)]
+	return bytes.Equal(in, want) || ci && EqualFold(in, want)
+}
@@ -0,0 +1,94 @@
+package abnf_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+func TestParsePartial(t *testing.T) {
+	digits := abnf.Repeat1Inf("1*DIGIT", abnf_core.Operators().DIGIT)
+	// frame = 1*DIGIT CRLF <octets>
+	frame := abnf.Bind("frame", digits, abnf.DecNumber, func(n uint) abnf.Operator {
+		return abnf.Concat("data",
+			abnf.Literal("CRLF", []byte("\r\n")),
+			abnf.Octets("octets", n),
+		)
+	})
+
+	for _, c := range []struct {
+		name     string
+		op       abnf.Operator
+		in       string
+		opts     []abnf.ParseOption
+		want     abnf.PartialStatus
+		wantNeed uint
+		wantNode string
+		wantKey  string
+		wantMore bool
+	}{
+		{name: "empty", op: frame, in: "", want: abnf.Incomplete, wantNeed: 1},
+		{
+			name: "empty with options",
+			op: abnf.Alt(`"" / *"a"`,
+				abnf.Literal(`""`, nil),
+				abnf.Repeat0Inf(`*"a"`, abnf.Literal(`"a"`, []byte("a"))),
+			),
+			in: "",
+			opts: []abnf.ParseOption{abnf.WithPolicy(func(a, b *abnf.Node) int {
+				return strings.Compare(b.Children[0].Key, a.Children[0].Key)
+			})},
+			want:     abnf.Complete,
+			wantKey:  `*"a"`,
+			wantMore: true,
+		},
+		{name: "length", op: frame, in: "5", want: abnf.Incomplete, wantNeed: 1},
+		{name: "truncated CRLF", op: frame, in: "5\r", want: abnf.Incomplete, wantNeed: 1},
+		{name: "truncated data", op: frame, in: "5\r\nab", want: abnf.Incomplete, wantNeed: 3},
+		{name: "frame", op: frame, in: "5\r\nabcdeX", want: abnf.Complete, wantNode: "5\r\nabcde"},
+		{name: "invalid", op: frame, in: "x5\r\n", want: abnf.Invalid},
+		{name: "invalid CRLF", op: frame, in: "5\n", want: abnf.Invalid},
+		{name: "extendable", op: digits, in: "12", want: abnf.Complete, wantNode: "12", wantMore: true},
+		{
+			name: "literal set",
+			op: abnf.LiteralSet("method",
+				abnf.LiteralSetItem{Key: `"INVITE"`, Value: []byte("INVITE")},
+				abnf.LiteralSetItem{Key: `"INFO"`, Value: []byte("INFO")},
+			),
+			in:       "inv",
+			want:     abnf.Incomplete,
+			wantNeed: 3,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := abnf.ParsePartial(c.op, []byte(c.in), c.opts...)
+			if res.Status != c.want {
+				t.Fatalf("abnf.ParsePartial(op, %q) status = %v, want %v", c.in, res.Status, c.want)
+			}
+			if c.want == abnf.Invalid {
+				if !errors.Is(err, abnf.ErrNotMatched) {
+					t.Fatalf("abnf.ParsePartial(op, %q) error = %v, want %v", c.in, err, abnf.ErrNotMatched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("abnf.ParsePartial(op, %q) error = %v, want nil", c.in, err)
+			}
+			if res.Need != c.wantNeed {
+				t.Errorf("abnf.ParsePartial(op, %q) need = %d, want %d", c.in, res.Need, c.wantNeed)
+			}
+			if got := res.Node.String(); got != c.wantNode {
+				t.Errorf("abnf.ParsePartial(op, %q) node = %q, want %q", c.in, got, c.wantNode)
+			}
+			if c.wantKey != "" && res.Node.Children[0].Key != c.wantKey {
+				t.Errorf("abnf.ParsePartial(op, %q) node key = %q, want %q", c.in, res.Node.Children[0].Key, c.wantKey)
+			}
+			if res.More != c.wantMore {
+				t.Errorf("abnf.ParsePartial(op, %q) more = %v, want %v", c.in, res.More, c.wantMore)
+			}
+		})
+	}
+}
@@ -1 +1,12 @@
 package abnf_core_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(abnf.RunWithLeakCheck(m))
+}
@@ -67,6 +67,27 @@ func RulesMap() map[string]abnf.Rule {
 	}
 }
 
+// FirstMap returns FIRST sets of rules, i.e. sets of octets any match of the rule starts with.
+// Rules that can match empty input or can't be predicted are omitted.
+func FirstMap() map[string]abnf.ByteSet {
+	return map[string]abnf.ByteSet{
+		"ALPHA":  {0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000},
+		"BIT":    {0x0003000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"CHAR":   {0xfffffffffffffffe, 0xffffffffffffffff, 0x0000000000000000, 0x0000000000000000},
+		"CR":     {0x0000000000002000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"CRLF":   {0x0000000000002400, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"CTL":    {0x00000000ffffffff, 0x8000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"DIGIT":  {0x03ff000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"DQUOTE": {0x0000000400000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"HEXDIG": {0x03ff000000000000, 0x0000007e0000007e, 0x0000000000000000, 0x0000000000000000},
+		"HTAB":   {0x0000000000000200, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"LF":     {0x0000000000000400, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"SP":     {0x0000000100000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"VCHAR":  {0xfffffffe00000000, 0x7fffffffffffffff, 0x0000000000000000, 0x0000000000000000},
+		"WSP":    {0x0000000100000200, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+	}
+}
+
 // OperatorsDescr defines operators descriptor that provides operators as methods.
 type OperatorsDescr struct {
 	alpha      abnf.Operator
@@ -104,7 +125,7 @@ type OperatorsDescr struct {
 }
 
 // ALPHA operator: ALPHA = %x41-5A / %x61-7A
-func (desc *OperatorsDescr) ALPHA(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) ALPHA(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.alphaOnce.Do(func() {
 		desc.alpha = abnf.Alt(
 			"ALPHA",
@@ -112,11 +133,11 @@ func (desc *OperatorsDescr) ALPHA(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Range("%x61-7A", []byte{97}, []byte{122}),
 		)
 	})
-	return desc.alpha(in, pos, ns)
+	return desc.alpha(ctx, in, pos, ns)
 }
 
 // BIT operator: BIT = "0" / "1"
-func (desc *OperatorsDescr) BIT(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) BIT(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.bitOnce.Do(func() {
 		desc.bit = abnf.Alt(
 			"BIT",
@@ -124,27 +145,27 @@ func (desc *OperatorsDescr) BIT(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("\"1\"", []byte{49}),
 		)
 	})
-	return desc.bit(in, pos, ns)
+	return desc.bit(ctx, in, pos, ns)
 }
 
 // CHAR operator: CHAR = %x01-7F
-func (desc *OperatorsDescr) CHAR(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CHAR(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.charOnce.Do(func() {
 		desc.char = abnf.Range("CHAR", []byte{1}, []byte{127})
 	})
-	return desc.char(in, pos, ns)
+	return desc.char(ctx, in, pos, ns)
 }
 
 // CR operator: CR = %x0D
-func (desc *OperatorsDescr) CR(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CR(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.crOnce.Do(func() {
 		desc.cr = abnf.Literal("CR", []byte{13})
 	})
-	return desc.cr(in, pos, ns)
+	return desc.cr(ctx, in, pos, ns)
 }
 
 // CRLF operator: CRLF = CR LF / LF
-func (desc *OperatorsDescr) CRLF(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CRLF(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.crlfOnce.Do(func() {
 		desc.crlf = abnf.Alt(
 			"CRLF",
@@ -156,11 +177,11 @@ func (desc *OperatorsDescr) CRLF(in []byte, pos uint, ns *abnf.Nodes) error {
 			desc.LF,
 		)
 	})
-	return desc.crlf(in, pos, ns)
+	return desc.crlf(ctx, in, pos, ns)
 }
 
 // CTL operator: CTL = %x00-1F / %x7F
-func (desc *OperatorsDescr) CTL(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CTL(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.ctlOnce.Do(func() {
 		desc.ctl = abnf.Alt(
 			"CTL",
@@ -168,27 +189,27 @@ func (desc *OperatorsDescr) CTL(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("%x7F", []byte{127}),
 		)
 	})
-	return desc.ctl(in, pos, ns)
+	return desc.ctl(ctx, in, pos, ns)
 }
 
 // DIGIT operator: DIGIT = %x30-39
-func (desc *OperatorsDescr) DIGIT(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) DIGIT(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.digitOnce.Do(func() {
 		desc.digit = abnf.Range("DIGIT", []byte{48}, []byte{57})
 	})
-	return desc.digit(in, pos, ns)
+	return desc.digit(ctx, in, pos, ns)
 }
 
 // DQUOTE operator: DQUOTE = %x22
-func (desc *OperatorsDescr) DQUOTE(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) DQUOTE(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.dquoteOnce.Do(func() {
 		desc.dquote = abnf.Literal("DQUOTE", []byte{34})
 	})
-	return desc.dquote(in, pos, ns)
+	return desc.dquote(ctx, in, pos, ns)
 }
 
 // HEXDIG operator: HEXDIG = DIGIT / "A" / "B" / "C" / "D" / "E" / "F"
-func (desc *OperatorsDescr) HEXDIG(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) HEXDIG(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.hexdigOnce.Do(func() {
 		desc.hexdig = abnf.Alt(
 			"HEXDIG",
@@ -201,27 +222,27 @@ func (desc *OperatorsDescr) HEXDIG(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("\"F\"", []byte{70}),
 		)
 	})
-	return desc.hexdig(in, pos, ns)
+	return desc.hexdig(ctx, in, pos, ns)
 }
 
 // HTAB operator: HTAB = %x09
-func (desc *OperatorsDescr) HTAB(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) HTAB(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.htabOnce.Do(func() {
 		desc.htab = abnf.Literal("HTAB", []byte{9})
 	})
-	return desc.htab(in, pos, ns)
+	return desc.htab(ctx, in, pos, ns)
 }
 
 // LF operator: LF = %x0A
-func (desc *OperatorsDescr) LF(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) LF(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.lfOnce.Do(func() {
 		desc.lf = abnf.Literal("LF", []byte{10})
 	})
-	return desc.lf(in, pos, ns)
+	return desc.lf(ctx, in, pos, ns)
 }
 
 // LWSP operator: LWSP = *(WSP / CRLF WSP)
-func (desc *OperatorsDescr) LWSP(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) LWSP(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.lwspOnce.Do(func() {
 		desc.lwsp = abnf.Repeat0Inf(
 			"LWSP",
@@ -236,35 +257,35 @@ func (desc *OperatorsDescr) LWSP(in []byte, pos uint, ns *abnf.Nodes) error {
 			),
 		)
 	})
-	return desc.lwsp(in, pos, ns)
+	return desc.lwsp(ctx, in, pos, ns)
 }
 
 // OCTET operator: OCTET = %x00-FF
-func (desc *OperatorsDescr) OCTET(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) OCTET(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.octetOnce.Do(func() {
 		desc.octet = abnf.Range("OCTET", []byte{0}, []byte{255})
 	})
-	return desc.octet(in, pos, ns)
+	return desc.octet(ctx, in, pos, ns)
 }
 
 // SP operator: SP = %x20
-func (desc *OperatorsDescr) SP(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) SP(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.spOnce.Do(func() {
 		desc.sp = abnf.Literal("SP", []byte{32})
 	})
-	return desc.sp(in, pos, ns)
+	return desc.sp(ctx, in, pos, ns)
 }
 
 // VCHAR operator: VCHAR = %x21-7E
-func (desc *OperatorsDescr) VCHAR(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) VCHAR(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.vcharOnce.Do(func() {
 		desc.vchar = abnf.Range("VCHAR", []byte{33}, []byte{126})
 	})
-	return desc.vchar(in, pos, ns)
+	return desc.vchar(ctx, in, pos, ns)
 }
 
 // WSP operator: WSP = SP / HTAB
-func (desc *OperatorsDescr) WSP(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) WSP(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.wspOnce.Do(func() {
 		desc.wsp = abnf.Alt(
 			"WSP",
@@ -272,7 +293,7 @@ func (desc *OperatorsDescr) WSP(in []byte, pos uint, ns *abnf.Nodes) error {
 			desc.HTAB,
 		)
 	})
-	return desc.wsp(in, pos, ns)
+	return desc.wsp(ctx, in, pos, ns)
 }
 
 // RulesDescr defines rules descriptor that provides rules as methods.
@@ -280,80 +301,80 @@ type RulesDescr struct{}
 
 // ALPHA rule: ALPHA = %x41-5A / %x61-7A
 func (*RulesDescr) ALPHA(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.ALPHA(in, 0, ns)
+	return oprsDescr.ALPHA(nil, in, 0, ns)
 }
 
 // BIT rule: BIT = "0" / "1"
 func (*RulesDescr) BIT(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.BIT(in, 0, ns)
+	return oprsDescr.BIT(nil, in, 0, ns)
 }
 
 // CHAR rule: CHAR = %x01-7F
 func (*RulesDescr) CHAR(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CHAR(in, 0, ns)
+	return oprsDescr.CHAR(nil, in, 0, ns)
 }
 
 // CR rule: CR = %x0D
 func (*RulesDescr) CR(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CR(in, 0, ns)
+	return oprsDescr.CR(nil, in, 0, ns)
 }
 
 // CRLF rule: CRLF = CR LF / LF
 func (*RulesDescr) CRLF(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CRLF(in, 0, ns)
+	return oprsDescr.CRLF(nil, in, 0, ns)
 }
 
 // CTL rule: CTL = %x00-1F / %x7F
 func (*RulesDescr) CTL(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CTL(in, 0, ns)
+	return oprsDescr.CTL(nil, in, 0, ns)
 }
 
 // DIGIT rule: DIGIT = %x30-39
 func (*RulesDescr) DIGIT(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.DIGIT(in, 0, ns)
+	return oprsDescr.DIGIT(nil, in, 0, ns)
 }
 
 // DQUOTE rule: DQUOTE = %x22
 func (*RulesDescr) DQUOTE(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.DQUOTE(in, 0, ns)
+	return oprsDescr.DQUOTE(nil, in, 0, ns)
 }
 
 // HEXDIG rule: HEXDIG = DIGIT / "A" / "B" / "C" / "D" / "E" / "F"
 func (*RulesDescr) HEXDIG(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.HEXDIG(in, 0, ns)
+	return oprsDescr.HEXDIG(nil, in, 0, ns)
 }
 
 // HTAB rule: HTAB = %x09
 func (*RulesDescr) HTAB(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.HTAB(in, 0, ns)
+	return oprsDescr.HTAB(nil, in, 0, ns)
 }
 
 // LF rule: LF = %x0A
 func (*RulesDescr) LF(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.LF(in, 0, ns)
+	return oprsDescr.LF(nil, in, 0, ns)
 }
 
 // LWSP rule: LWSP = *(WSP / CRLF WSP)
 func (*RulesDescr) LWSP(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.LWSP(in, 0, ns)
+	return oprsDescr.LWSP(nil, in, 0, ns)
 }
 
 // OCTET rule: OCTET = %x00-FF
 func (*RulesDescr) OCTET(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.OCTET(in, 0, ns)
+	return oprsDescr.OCTET(nil, in, 0, ns)
 }
 
 // SP rule: SP = %x20
 func (*RulesDescr) SP(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.SP(in, 0, ns)
+	return oprsDescr.SP(nil, in, 0, ns)
 }
 
 // VCHAR rule: VCHAR = %x21-7E
 func (*RulesDescr) VCHAR(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.VCHAR(in, 0, ns)
+	return oprsDescr.VCHAR(nil, in, 0, ns)
 }
 
 // WSP rule: WSP = SP / HTAB
 func (*RulesDescr) WSP(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.WSP(in, 0, ns)
+	return oprsDescr.WSP(nil, in, 0, ns)
 }
@@ -889,7 +889,7 @@ func BenchmarkToken(b *testing.B) {
 	b.ResetTimer()
 	for b.Loop() {
 		ns.Clear()
-		if err := token([]byte("!aaa.bbb+ccc"), 0, ns); err != nil {
+		if err := token(nil, []byte("!aaa.bbb+ccc"), 0, ns); err != nil {
 			b.Errorf("operator returned error %q, want nil", err)
 			continue
 		}
@@ -898,3 +898,26 @@ func BenchmarkToken(b *testing.B) {
 		}
 	}
 }
+
+func TestFirstMap(t *testing.T) {
+	first := abnf_core.FirstMap()
+	if _, ok := first["LWSP"]; ok {
+		t.Error("FirstMap() has LWSP, want it omitted as it matches empty input")
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	for name, op := range abnf_core.OperatorsMap() {
+		set, ok := first[name]
+		if !ok {
+			continue
+		}
+		for b := range 256 {
+			ns.Clear()
+			if err := abnf.Parse(op, []byte{byte(b), '\n'}, ns); err == nil && !set.Has(byte(b)) {
+				t.Errorf("%s matches %q, but FirstMap()[%q] doesn't have it", name, byte(b), name)
+			}
+		}
+	}
+}
@@ -84,6 +84,37 @@ func RulesMap() map[string]abnf.Rule {
 	}
 }
 
+// FirstMap returns FIRST sets of rules, i.e. sets of octets any match of the rule starts with.
+// Rules that can match empty input or can't be predicted are omitted.
+func FirstMap() map[string]abnf.ByteSet {
+	return map[string]abnf.ByteSet{
+		"alternation":             {0x13ff052400000000, 0x07fffffe0ffffffe, 0x0000000000000000, 0x0000000000000000},
+		"bin-val":                 {0x0000000000000000, 0x0000000400000004, 0x0000000000000000, 0x0000000000000000},
+		"c-nl":                    {0x0800000000002400, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"c-wsp":                   {0x0800000100002600, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"case-insensitive-string": {0x0000002400000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"case-sensitive-string":   {0x0000002000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"char-val":                {0x0000002400000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"comment":                 {0x0800000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"concatenation":           {0x13ff052400000000, 0x07fffffe0ffffffe, 0x0000000000000000, 0x0000000000000000},
+		"dec-val":                 {0x0000000000000000, 0x0000001000000010, 0x0000000000000000, 0x0000000000000000},
+		"defined-as":              {0x2800000100002600, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"element":                 {0x1000012400000000, 0x07fffffe0ffffffe, 0x0000000000000000, 0x0000000000000000},
+		"elements":                {0x13ff052400000000, 0x07fffffe0ffffffe, 0x0000000000000000, 0x0000000000000000},
+		"group":                   {0x0000010000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"hex-val":                 {0x0000000000000000, 0x0100000001000000, 0x0000000000000000, 0x0000000000000000},
+		"num-val":                 {0x0000002000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"option":                  {0x0000000000000000, 0x0000000008000000, 0x0000000000000000, 0x0000000000000000},
+		"prose-val":               {0x1000000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"quoted-string":           {0x0000000400000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"repeat":                  {0x03ff040000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"repetition":              {0x13ff052400000000, 0x07fffffe0ffffffe, 0x0000000000000000, 0x0000000000000000},
+		"rule":                    {0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000},
+		"rulelist":                {0x0800000100002600, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000},
+		"rulename":                {0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000},
+	}
+}
+
 // OperatorsDescr defines operators descriptor that provides operators as methods.
 type OperatorsDescr struct {
 	alternation               abnf.Operator
@@ -137,7 +168,7 @@ type OperatorsDescr struct {
 }
 
 // Alternation operator: alternation = concatenation *(*c-wsp "/" *c-wsp concatenation)
-func (desc *OperatorsDescr) Alternation(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Alternation(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.alternationOnce.Do(func() {
 		desc.alternation = abnf.Concat(
 			"alternation",
@@ -160,11 +191,11 @@ func (desc *OperatorsDescr) Alternation(in []byte, pos uint, ns *abnf.Nodes) err
 			),
 		)
 	})
-	return desc.alternation(in, pos, ns)
+	return desc.alternation(ctx, in, pos, ns)
 }
 
 // BinVal operator: bin-val = "b" 1*BIT [ 1*("." 1*BIT) / ("-" 1*BIT) ]
-func (desc *OperatorsDescr) BinVal(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) BinVal(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.binValOnce.Do(func() {
 		desc.binVal = abnf.Concat(
 			"bin-val",
@@ -177,7 +208,7 @@ func (desc *OperatorsDescr) BinVal(in []byte, pos uint, ns *abnf.Nodes) error {
 				"[ 1*(\".\" 1*BIT) / (\"-\" 1*BIT) ]",
 				abnf.Alt(
 					"1*(\".\" 1*BIT) / (\"-\" 1*BIT)",
-					abnf.Repeat1Inf(
+					abnf.Predict("1*(\".\" 1*BIT)", abnf.ByteSet{0x0000400000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Repeat1Inf(
 						"1*(\".\" 1*BIT)",
 						abnf.Concat(
 							"\".\" 1*BIT",
@@ -187,52 +218,52 @@ func (desc *OperatorsDescr) BinVal(in []byte, pos uint, ns *abnf.Nodes) error {
 								abnf_core.Operators().BIT,
 							),
 						),
-					),
-					abnf.Concat(
+					)),
+					abnf.Predict("\"-\" 1*BIT", abnf.ByteSet{0x0000200000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(
 						"\"-\" 1*BIT",
 						abnf.Literal("\"-\"", []byte{45}),
 						abnf.Repeat1Inf(
 							"1*BIT",
 							abnf_core.Operators().BIT,
 						),
-					),
+					)),
 				),
 			),
 		)
 	})
-	return desc.binVal(in, pos, ns)
+	return desc.binVal(ctx, in, pos, ns)
 }
 
 // CNl operator: c-nl = comment / CRLF
-func (desc *OperatorsDescr) CNl(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CNl(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.cNlOnce.Do(func() {
 		desc.cNl = abnf.Alt(
 			"c-nl",
-			desc.Comment,
-			abnf_core.Operators().CRLF,
+			abnf.Predict("comment", abnf.ByteSet{0x0800000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.Comment),
+			abnf.Predict("CRLF", abnf.ByteSet{0x0000000000002400, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().CRLF),
 		)
 	})
-	return desc.cNl(in, pos, ns)
+	return desc.cNl(ctx, in, pos, ns)
 }
 
 // CWsp operator: c-wsp = WSP / (c-nl WSP)
-func (desc *OperatorsDescr) CWsp(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CWsp(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.cWspOnce.Do(func() {
 		desc.cWsp = abnf.Alt(
 			"c-wsp",
-			abnf_core.Operators().WSP,
-			abnf.Concat(
+			abnf.Predict("WSP", abnf.ByteSet{0x0000000100000200, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().WSP),
+			abnf.Predict("c-nl WSP", abnf.ByteSet{0x0800000000002400, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(
 				"c-nl WSP",
 				desc.CNl,
 				abnf_core.Operators().WSP,
-			),
+			)),
 		)
 	})
-	return desc.cWsp(in, pos, ns)
+	return desc.cWsp(ctx, in, pos, ns)
 }
 
 // CaseInsensitiveString operator: case-insensitive-string = [ "%i" ] quoted-string
-func (desc *OperatorsDescr) CaseInsensitiveString(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CaseInsensitiveString(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.caseInsensitiveStringOnce.Do(func() {
 		desc.caseInsensitiveString = abnf.Concat(
 			"case-insensitive-string",
@@ -243,11 +274,11 @@ func (desc *OperatorsDescr) CaseInsensitiveString(in []byte, pos uint, ns *abnf.
 			desc.QuotedString,
 		)
 	})
-	return desc.caseInsensitiveString(in, pos, ns)
+	return desc.caseInsensitiveString(ctx, in, pos, ns)
 }
 
 // CaseSensitiveString operator: case-sensitive-string = "%s" quoted-string
-func (desc *OperatorsDescr) CaseSensitiveString(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CaseSensitiveString(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.caseSensitiveStringOnce.Do(func() {
 		desc.caseSensitiveString = abnf.Concat(
 			"case-sensitive-string",
@@ -255,23 +286,23 @@ func (desc *OperatorsDescr) CaseSensitiveString(in []byte, pos uint, ns *abnf.No
 			desc.QuotedString,
 		)
 	})
-	return desc.caseSensitiveString(in, pos, ns)
+	return desc.caseSensitiveString(ctx, in, pos, ns)
 }
 
 // CharVal operator: char-val = case-insensitive-string / case-sensitive-string
-func (desc *OperatorsDescr) CharVal(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) CharVal(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.charValOnce.Do(func() {
 		desc.charVal = abnf.Alt(
 			"char-val",
-			desc.CaseInsensitiveString,
-			desc.CaseSensitiveString,
+			abnf.Predict("case-insensitive-string", abnf.ByteSet{0x0000002400000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.CaseInsensitiveString),
+			abnf.Predict("case-sensitive-string", abnf.ByteSet{0x0000002000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.CaseSensitiveString),
 		)
 	})
-	return desc.charVal(in, pos, ns)
+	return desc.charVal(ctx, in, pos, ns)
 }
 
 // Comment operator: comment = ";" *(WSP / VCHAR) CRLF
-func (desc *OperatorsDescr) Comment(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Comment(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.commentOnce.Do(func() {
 		desc.comment = abnf.Concat(
 			"comment",
@@ -280,18 +311,18 @@ func (desc *OperatorsDescr) Comment(in []byte, pos uint, ns *abnf.Nodes) error {
 				"*(WSP / VCHAR)",
 				abnf.Alt(
 					"WSP / VCHAR",
-					abnf_core.Operators().WSP,
-					abnf_core.Operators().VCHAR,
+					abnf.Predict("WSP", abnf.ByteSet{0x0000000100000200, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().WSP),
+					abnf.Predict("VCHAR", abnf.ByteSet{0xfffffffe00000000, 0x7fffffffffffffff, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().VCHAR),
 				),
 			),
 			abnf_core.Operators().CRLF,
 		)
 	})
-	return desc.comment(in, pos, ns)
+	return desc.comment(ctx, in, pos, ns)
 }
 
 // Concatenation operator: concatenation = repetition *(1*c-wsp repetition)
-func (desc *OperatorsDescr) Concatenation(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Concatenation(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.concatenationOnce.Do(func() {
 		desc.concatenation = abnf.Concat(
 			"concatenation",
@@ -309,11 +340,11 @@ func (desc *OperatorsDescr) Concatenation(in []byte, pos uint, ns *abnf.Nodes) e
 			),
 		)
 	})
-	return desc.concatenation(in, pos, ns)
+	return desc.concatenation(ctx, in, pos, ns)
 }
 
 // DecVal operator: dec-val = "d" 1*DIGIT [ 1*("." 1*DIGIT) / ("-" 1*DIGIT) ]
-func (desc *OperatorsDescr) DecVal(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) DecVal(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.decValOnce.Do(func() {
 		desc.decVal = abnf.Concat(
 			"dec-val",
@@ -326,7 +357,7 @@ func (desc *OperatorsDescr) DecVal(in []byte, pos uint, ns *abnf.Nodes) error {
 				"[ 1*(\".\" 1*DIGIT) / (\"-\" 1*DIGIT) ]",
 				abnf.Alt(
 					"1*(\".\" 1*DIGIT) / (\"-\" 1*DIGIT)",
-					abnf.Repeat1Inf(
+					abnf.Predict("1*(\".\" 1*DIGIT)", abnf.ByteSet{0x0000400000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Repeat1Inf(
 						"1*(\".\" 1*DIGIT)",
 						abnf.Concat(
 							"\".\" 1*DIGIT",
@@ -336,24 +367,24 @@ func (desc *OperatorsDescr) DecVal(in []byte, pos uint, ns *abnf.Nodes) error {
 								abnf_core.Operators().DIGIT,
 							),
 						),
-					),
-					abnf.Concat(
+					)),
+					abnf.Predict("\"-\" 1*DIGIT", abnf.ByteSet{0x0000200000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(
 						"\"-\" 1*DIGIT",
 						abnf.Literal("\"-\"", []byte{45}),
 						abnf.Repeat1Inf(
 							"1*DIGIT",
 							abnf_core.Operators().DIGIT,
 						),
-					),
+					)),
 				),
 			),
 		)
 	})
-	return desc.decVal(in, pos, ns)
+	return desc.decVal(ctx, in, pos, ns)
 }
 
 // DefinedAs operator: defined-as = *c-wsp ("=" / "=/") *c-wsp
-func (desc *OperatorsDescr) DefinedAs(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) DefinedAs(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.definedAsOnce.Do(func() {
 		desc.definedAs = abnf.Concat(
 			"defined-as",
@@ -363,8 +394,8 @@ func (desc *OperatorsDescr) DefinedAs(in []byte, pos uint, ns *abnf.Nodes) error
 			),
 			abnf.Alt(
 				"\"=\" / \"=/\"",
-				abnf.Literal("\"=\"", []byte{61}),
-				abnf.Literal("\"=/\"", []byte{61, 47}),
+				abnf.Predict("\"=\"", abnf.ByteSet{0x2000000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Literal("\"=\"", []byte{61})),
+				abnf.Predict("\"=/\"", abnf.ByteSet{0x2000000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Literal("\"=/\"", []byte{61, 47})),
 			),
 			abnf.Repeat0Inf(
 				"*c-wsp",
@@ -372,27 +403,27 @@ func (desc *OperatorsDescr) DefinedAs(in []byte, pos uint, ns *abnf.Nodes) error
 			),
 		)
 	})
-	return desc.definedAs(in, pos, ns)
+	return desc.definedAs(ctx, in, pos, ns)
 }
 
 // Element operator: element = rulename / group / option / char-val / num-val / prose-val
-func (desc *OperatorsDescr) Element(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Element(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.elementOnce.Do(func() {
 		desc.element = abnf.Alt(
 			"element",
-			desc.Rulename,
-			desc.Group,
-			desc.Option,
-			desc.CharVal,
-			desc.NumVal,
-			desc.ProseVal,
+			abnf.Predict("rulename", abnf.ByteSet{0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000}, desc.Rulename),
+			abnf.Predict("group", abnf.ByteSet{0x0000010000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.Group),
+			abnf.Predict("option", abnf.ByteSet{0x0000000000000000, 0x0000000008000000, 0x0000000000000000, 0x0000000000000000}, desc.Option),
+			abnf.Predict("char-val", abnf.ByteSet{0x0000002400000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.CharVal),
+			abnf.Predict("num-val", abnf.ByteSet{0x0000002000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.NumVal),
+			abnf.Predict("prose-val", abnf.ByteSet{0x1000000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, desc.ProseVal),
 		)
 	})
-	return desc.element(in, pos, ns)
+	return desc.element(ctx, in, pos, ns)
 }
 
 // Elements operator: elements = alternation *WSP
-func (desc *OperatorsDescr) Elements(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Elements(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.elementsOnce.Do(func() {
 		desc.elements = abnf.Concat(
 			"elements",
@@ -403,11 +434,11 @@ func (desc *OperatorsDescr) Elements(in []byte, pos uint, ns *abnf.Nodes) error
 			),
 		)
 	})
-	return desc.elements(in, pos, ns)
+	return desc.elements(ctx, in, pos, ns)
 }
 
 // Group operator: group = "(" *c-wsp alternation *c-wsp ")"
-func (desc *OperatorsDescr) Group(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Group(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.groupOnce.Do(func() {
 		desc.group = abnf.Concat(
 			"group",
@@ -424,11 +455,11 @@ func (desc *OperatorsDescr) Group(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("\")\"", []byte{41}),
 		)
 	})
-	return desc.group(in, pos, ns)
+	return desc.group(ctx, in, pos, ns)
 }
 
 // HexVal operator: hex-val = "x" 1*HEXDIG [ 1*("." 1*HEXDIG) / ("-" 1*HEXDIG) ]
-func (desc *OperatorsDescr) HexVal(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) HexVal(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.hexValOnce.Do(func() {
 		desc.hexVal = abnf.Concat(
 			"hex-val",
@@ -441,7 +472,7 @@ func (desc *OperatorsDescr) HexVal(in []byte, pos uint, ns *abnf.Nodes) error {
 				"[ 1*(\".\" 1*HEXDIG) / (\"-\" 1*HEXDIG) ]",
 				abnf.Alt(
 					"1*(\".\" 1*HEXDIG) / (\"-\" 1*HEXDIG)",
-					abnf.Repeat1Inf(
+					abnf.Predict("1*(\".\" 1*HEXDIG)", abnf.ByteSet{0x0000400000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Repeat1Inf(
 						"1*(\".\" 1*HEXDIG)",
 						abnf.Concat(
 							"\".\" 1*HEXDIG",
@@ -451,41 +482,41 @@ func (desc *OperatorsDescr) HexVal(in []byte, pos uint, ns *abnf.Nodes) error {
 								abnf_core.Operators().HEXDIG,
 							),
 						),
-					),
-					abnf.Concat(
+					)),
+					abnf.Predict("\"-\" 1*HEXDIG", abnf.ByteSet{0x0000200000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(
 						"\"-\" 1*HEXDIG",
 						abnf.Literal("\"-\"", []byte{45}),
 						abnf.Repeat1Inf(
 							"1*HEXDIG",
 							abnf_core.Operators().HEXDIG,
 						),
-					),
+					)),
 				),
 			),
 		)
 	})
-	return desc.hexVal(in, pos, ns)
+	return desc.hexVal(ctx, in, pos, ns)
 }
 
 // NumVal operator: num-val = "%" (bin-val / dec-val / hex-val)
-func (desc *OperatorsDescr) NumVal(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) NumVal(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.numValOnce.Do(func() {
 		desc.numVal = abnf.Concat(
 			"num-val",
 			abnf.Literal("\"%\"", []byte{37}),
 			abnf.Alt(
 				"bin-val / dec-val / hex-val",
-				desc.BinVal,
-				desc.DecVal,
-				desc.HexVal,
+				abnf.Predict("bin-val", abnf.ByteSet{0x0000000000000000, 0x0000000400000004, 0x0000000000000000, 0x0000000000000000}, desc.BinVal),
+				abnf.Predict("dec-val", abnf.ByteSet{0x0000000000000000, 0x0000001000000010, 0x0000000000000000, 0x0000000000000000}, desc.DecVal),
+				abnf.Predict("hex-val", abnf.ByteSet{0x0000000000000000, 0x0100000001000000, 0x0000000000000000, 0x0000000000000000}, desc.HexVal),
 			),
 		)
 	})
-	return desc.numVal(in, pos, ns)
+	return desc.numVal(ctx, in, pos, ns)
 }
 
 // Option operator: option = "[" *c-wsp alternation *c-wsp "]"
-func (desc *OperatorsDescr) Option(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Option(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.optionOnce.Do(func() {
 		desc.option = abnf.Concat(
 			"option",
@@ -502,11 +533,11 @@ func (desc *OperatorsDescr) Option(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("\"]\"", []byte{93}),
 		)
 	})
-	return desc.option(in, pos, ns)
+	return desc.option(ctx, in, pos, ns)
 }
 
 // ProseVal operator: prose-val = "<" *(%x20-3D / %x3F-7E) ">"
-func (desc *OperatorsDescr) ProseVal(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) ProseVal(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.proseValOnce.Do(func() {
 		desc.proseVal = abnf.Concat(
 			"prose-val",
@@ -515,18 +546,18 @@ func (desc *OperatorsDescr) ProseVal(in []byte, pos uint, ns *abnf.Nodes) error
 				"*(%x20-3D / %x3F-7E)",
 				abnf.Alt(
 					"%x20-3D / %x3F-7E",
-					abnf.Range("%x20-3D", []byte{32}, []byte{61}),
-					abnf.Range("%x3F-7E", []byte{63}, []byte{126}),
+					abnf.Predict("%x20-3D", abnf.ByteSet{0x3fffffff00000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Range("%x20-3D", []byte{32}, []byte{61})),
+					abnf.Predict("%x3F-7E", abnf.ByteSet{0x8000000000000000, 0x7fffffffffffffff, 0x0000000000000000, 0x0000000000000000}, abnf.Range("%x3F-7E", []byte{63}, []byte{126})),
 				),
 			),
 			abnf.Literal("\">\"", []byte{62}),
 		)
 	})
-	return desc.proseVal(in, pos, ns)
+	return desc.proseVal(ctx, in, pos, ns)
 }
 
 // QuotedString operator: quoted-string = DQUOTE *(%x20-21 / %x23-7E) DQUOTE
-func (desc *OperatorsDescr) QuotedString(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) QuotedString(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.quotedStringOnce.Do(func() {
 		desc.quotedString = abnf.Concat(
 			"quoted-string",
@@ -535,26 +566,26 @@ func (desc *OperatorsDescr) QuotedString(in []byte, pos uint, ns *abnf.Nodes) er
 				"*(%x20-21 / %x23-7E)",
 				abnf.Alt(
 					"%x20-21 / %x23-7E",
-					abnf.Range("%x20-21", []byte{32}, []byte{33}),
-					abnf.Range("%x23-7E", []byte{35}, []byte{126}),
+					abnf.Predict("%x20-21", abnf.ByteSet{0x0000000300000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Range("%x20-21", []byte{32}, []byte{33})),
+					abnf.Predict("%x23-7E", abnf.ByteSet{0xfffffff800000000, 0x7fffffffffffffff, 0x0000000000000000, 0x0000000000000000}, abnf.Range("%x23-7E", []byte{35}, []byte{126})),
 				),
 			),
 			abnf_core.Operators().DQUOTE,
 		)
 	})
-	return desc.quotedString(in, pos, ns)
+	return desc.quotedString(ctx, in, pos, ns)
 }
 
 // Repeat operator: repeat = 1*DIGIT / (*DIGIT "*" *DIGIT)
-func (desc *OperatorsDescr) Repeat(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Repeat(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.repeatOnce.Do(func() {
 		desc.repeat = abnf.Alt(
 			"repeat",
-			abnf.Repeat1Inf(
+			abnf.Predict("1*DIGIT", abnf.ByteSet{0x03ff000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Repeat1Inf(
 				"1*DIGIT",
 				abnf_core.Operators().DIGIT,
-			),
-			abnf.Concat(
+			)),
+			abnf.Predict("*DIGIT \"*\" *DIGIT", abnf.ByteSet{0x03ff040000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(
 				"*DIGIT \"*\" *DIGIT",
 				abnf.Repeat0Inf(
 					"*DIGIT",
@@ -565,14 +596,14 @@ func (desc *OperatorsDescr) Repeat(in []byte, pos uint, ns *abnf.Nodes) error {
 					"*DIGIT",
 					abnf_core.Operators().DIGIT,
 				),
-			),
+			)),
 		)
 	})
-	return desc.repeat(in, pos, ns)
+	return desc.repeat(ctx, in, pos, ns)
 }
 
 // Repetition operator: repetition = [repeat] element
-func (desc *OperatorsDescr) Repetition(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Repetition(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.repetitionOnce.Do(func() {
 		desc.repetition = abnf.Concat(
 			"repetition",
@@ -583,11 +614,11 @@ func (desc *OperatorsDescr) Repetition(in []byte, pos uint, ns *abnf.Nodes) erro
 			desc.Element,
 		)
 	})
-	return desc.repetition(in, pos, ns)
+	return desc.repetition(ctx, in, pos, ns)
 }
 
 // Rule operator: rule = rulename defined-as elements c-nl
-func (desc *OperatorsDescr) Rule(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Rule(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.ruleOnce.Do(func() {
 		desc.rule = abnf.Concat(
 			"rule",
@@ -597,33 +628,33 @@ func (desc *OperatorsDescr) Rule(in []byte, pos uint, ns *abnf.Nodes) error {
 			desc.CNl,
 		)
 	})
-	return desc.rule(in, pos, ns)
+	return desc.rule(ctx, in, pos, ns)
 }
 
 // Rulelist operator: rulelist = 1*( rule / (*WSP c-nl) )
-func (desc *OperatorsDescr) Rulelist(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Rulelist(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.rulelistOnce.Do(func() {
 		desc.rulelist = abnf.Repeat1Inf(
 			"rulelist",
 			abnf.Alt(
 				"rule / (*WSP c-nl)",
-				desc.Rule,
-				abnf.Concat(
+				abnf.Predict("rule", abnf.ByteSet{0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000}, desc.Rule),
+				abnf.Predict("*WSP c-nl", abnf.ByteSet{0x0800000100002600, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(
 					"*WSP c-nl",
 					abnf.Repeat0Inf(
 						"*WSP",
 						abnf_core.Operators().WSP,
 					),
 					desc.CNl,
-				),
+				)),
 			),
 		)
 	})
-	return desc.rulelist(in, pos, ns)
+	return desc.rulelist(ctx, in, pos, ns)
 }
 
 // Rulename operator: rulename = ALPHA *(ALPHA / DIGIT / "-")
-func (desc *OperatorsDescr) Rulename(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Rulename(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.rulenameOnce.Do(func() {
 		desc.rulename = abnf.Concat(
 			"rulename",
@@ -632,14 +663,14 @@ func (desc *OperatorsDescr) Rulename(in []byte, pos uint, ns *abnf.Nodes) error
 				"*(ALPHA / DIGIT / \"-\")",
 				abnf.Alt(
 					"ALPHA / DIGIT / \"-\"",
-					abnf_core.Operators().ALPHA,
-					abnf_core.Operators().DIGIT,
-					abnf.Literal("\"-\"", []byte{45}),
+					abnf.Predict("ALPHA", abnf.ByteSet{0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().ALPHA),
+					abnf.Predict("DIGIT", abnf.ByteSet{0x03ff000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().DIGIT),
+					abnf.Predict("\"-\"", abnf.ByteSet{0x0000200000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Literal("\"-\"", []byte{45})),
 				),
 			),
 		)
 	})
-	return desc.rulename(in, pos, ns)
+	return desc.rulename(ctx, in, pos, ns)
 }
 
 // RulesDescr defines rules descriptor that provides rules as methods.
@@ -647,120 +678,120 @@ type RulesDescr struct{}
 
 // Alternation rule: alternation = concatenation *(*c-wsp "/" *c-wsp concatenation)
 func (*RulesDescr) Alternation(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Alternation(in, 0, ns)
+	return oprsDescr.Alternation(nil, in, 0, ns)
 }
 
 // BinVal rule: bin-val = "b" 1*BIT [ 1*("." 1*BIT) / ("-" 1*BIT) ]
 func (*RulesDescr) BinVal(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.BinVal(in, 0, ns)
+	return oprsDescr.BinVal(nil, in, 0, ns)
 }
 
 // CNl rule: c-nl = comment / CRLF
 func (*RulesDescr) CNl(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CNl(in, 0, ns)
+	return oprsDescr.CNl(nil, in, 0, ns)
 }
 
 // CWsp rule: c-wsp = WSP / (c-nl WSP)
 func (*RulesDescr) CWsp(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CWsp(in, 0, ns)
+	return oprsDescr.CWsp(nil, in, 0, ns)
 }
 
 // CaseInsensitiveString rule: case-insensitive-string = [ "%i" ] quoted-string
 func (*RulesDescr) CaseInsensitiveString(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CaseInsensitiveString(in, 0, ns)
+	return oprsDescr.CaseInsensitiveString(nil, in, 0, ns)
 }
 
 // CaseSensitiveString rule: case-sensitive-string = "%s" quoted-string
 func (*RulesDescr) CaseSensitiveString(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CaseSensitiveString(in, 0, ns)
+	return oprsDescr.CaseSensitiveString(nil, in, 0, ns)
 }
 
 // CharVal rule: char-val = case-insensitive-string / case-sensitive-string
 func (*RulesDescr) CharVal(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.CharVal(in, 0, ns)
+	return oprsDescr.CharVal(nil, in, 0, ns)
 }
 
 // Comment rule: comment = ";" *(WSP / VCHAR) CRLF
 func (*RulesDescr) Comment(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Comment(in, 0, ns)
+	return oprsDescr.Comment(nil, in, 0, ns)
 }
 
 // Concatenation rule: concatenation = repetition *(1*c-wsp repetition)
 func (*RulesDescr) Concatenation(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Concatenation(in, 0, ns)
+	return oprsDescr.Concatenation(nil, in, 0, ns)
 }
 
 // DecVal rule: dec-val = "d" 1*DIGIT [ 1*("." 1*DIGIT) / ("-" 1*DIGIT) ]
 func (*RulesDescr) DecVal(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.DecVal(in, 0, ns)
+	return oprsDescr.DecVal(nil, in, 0, ns)
 }
 
 // DefinedAs rule: defined-as = *c-wsp ("=" / "=/") *c-wsp
 func (*RulesDescr) DefinedAs(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.DefinedAs(in, 0, ns)
+	return oprsDescr.DefinedAs(nil, in, 0, ns)
 }
 
 // Element rule: element = rulename / group / option / char-val / num-val / prose-val
 func (*RulesDescr) Element(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Element(in, 0, ns)
+	return oprsDescr.Element(nil, in, 0, ns)
 }
 
 // Elements rule: elements = alternation *WSP
 func (*RulesDescr) Elements(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Elements(in, 0, ns)
+	return oprsDescr.Elements(nil, in, 0, ns)
 }
 
 // Group rule: group = "(" *c-wsp alternation *c-wsp ")"
 func (*RulesDescr) Group(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Group(in, 0, ns)
+	return oprsDescr.Group(nil, in, 0, ns)
 }
 
 // HexVal rule: hex-val = "x" 1*HEXDIG [ 1*("." 1*HEXDIG) / ("-" 1*HEXDIG) ]
 func (*RulesDescr) HexVal(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.HexVal(in, 0, ns)
+	return oprsDescr.HexVal(nil, in, 0, ns)
 }
 
 // NumVal rule: num-val = "%" (bin-val / dec-val / hex-val)
 func (*RulesDescr) NumVal(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.NumVal(in, 0, ns)
+	return oprsDescr.NumVal(nil, in, 0, ns)
 }
 
 // Option rule: option = "[" *c-wsp alternation *c-wsp "]"
 func (*RulesDescr) Option(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Option(in, 0, ns)
+	return oprsDescr.Option(nil, in, 0, ns)
 }
 
 // ProseVal rule: prose-val = "<" *(%x20-3D / %x3F-7E) ">"
 func (*RulesDescr) ProseVal(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.ProseVal(in, 0, ns)
+	return oprsDescr.ProseVal(nil, in, 0, ns)
 }
 
 // QuotedString rule: quoted-string = DQUOTE *(%x20-21 / %x23-7E) DQUOTE
 func (*RulesDescr) QuotedString(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.QuotedString(in, 0, ns)
+	return oprsDescr.QuotedString(nil, in, 0, ns)
 }
 
 // Repeat rule: repeat = 1*DIGIT / (*DIGIT "*" *DIGIT)
 func (*RulesDescr) Repeat(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Repeat(in, 0, ns)
+	return oprsDescr.Repeat(nil, in, 0, ns)
 }
 
 // Repetition rule: repetition = [repeat] element
 func (*RulesDescr) Repetition(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Repetition(in, 0, ns)
+	return oprsDescr.Repetition(nil, in, 0, ns)
 }
 
 // Rule rule: rule = rulename defined-as elements c-nl
 func (*RulesDescr) Rule(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Rule(in, 0, ns)
+	return oprsDescr.Rule(nil, in, 0, ns)
 }
 
 // Rulelist rule: rulelist = 1*( rule / (*WSP c-nl) )
 func (*RulesDescr) Rulelist(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Rulelist(in, 0, ns)
+	return oprsDescr.Rulelist(nil, in, 0, ns)
 }
 
 // Rulename rule: rulename = ALPHA *(ALPHA / DIGIT / "-")
 func (*RulesDescr) Rulename(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Rulename(in, 0, ns)
+	return oprsDescr.Rulename(nil, in, 0, ns)
 }
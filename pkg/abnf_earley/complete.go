@@ -0,0 +1,125 @@
+package abnf_earley
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// SuggestionKind is a kind of [Suggestion].
+type SuggestionKind uint8
+
+const (
+	// SuggestLiteral suggests the rest of a literal.
+	SuggestLiteral SuggestionKind = iota + 1
+	// SuggestRule suggests a rule or an external operator.
+	SuggestRule
+	// SuggestBytes suggests an octet from a set, e.g. of a numeric value range.
+	SuggestBytes
+)
+
+func (k SuggestionKind) String() string {
+	switch k {
+	case SuggestLiteral:
+		return "literal"
+	case SuggestRule:
+		return "rule"
+	case SuggestBytes:
+		return "bytes"
+	default:
+		return fmt.Sprintf("SuggestionKind(%d)", k)
+	}
+}
+
+// Suggestion is a valid continuation of a prefix, see [Grammar.Complete].
+type Suggestion struct {
+	Kind SuggestionKind
+	// Text is the rest of the literal for [SuggestLiteral] and the rule name for [SuggestRule].
+	Text string
+	// Set is the set of octets for [SuggestBytes].
+	Set abnf.ByteSet
+	// Count is the number of parse states expecting the suggestion.
+	Count int
+}
+
+func (s Suggestion) String() string {
+	switch s.Kind {
+	case SuggestLiteral:
+		return fmt.Sprintf("%q", s.Text)
+	case SuggestBytes:
+		return fmt.Sprintf("<%d octets>", s.Set.Len())
+	default:
+		return s.Text
+	}
+}
+
+type suggestionKey struct {
+	kind SuggestionKind
+	text string
+	set  abnf.ByteSet
+}
+
+// Complete returns continuations of the prefix that are valid for the rule start:
+// rests of literals, names of rules and external operators and sets of octets that can follow the prefix.
+// If the prefix ends inside a literal, the rest of the literal is suggested.
+//
+// Suggestions are deduplicated and ranked: literals first, then rules, then octet sets,
+// suggestions of the same kind are ordered by the number of parse states expecting them and then by text.
+// It returns an error wrapping [abnf.ErrNotMatched] with the furthest reached position
+// if the prefix isn't a prefix of any match of the rule.
+func (g *Grammar) Complete(start string, prefix []byte) ([]Suggestion, error) {
+	c, _, err := g.recognize(start, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	set := c.sets[len(prefix)]
+	if set == nil {
+		return nil, fmt.Errorf("rule '%s' failed at position %d: %w", start, c.furthest(), abnf.ErrNotMatched)
+	}
+
+	idx := make(map[suggestionKey]int)
+	var res []Suggestion
+	for _, it := range set.items {
+		p := g.prods[it.prod]
+		if int(it.dot) == len(p.rhs) {
+			continue
+		}
+
+		var k suggestionKey
+		switch next := p.rhs[it.dot]; {
+		case !next.isTerm():
+			if g.names[next] == "" {
+				continue
+			}
+			k = suggestionKey{kind: SuggestRule, text: g.names[next]}
+		case g.terms[^next].op != nil:
+			k = suggestionKey{kind: SuggestRule, text: g.terms[^next].name}
+		case g.terms[^next].lit != nil:
+			t := g.terms[^next]
+			k = suggestionKey{kind: SuggestLiteral, text: string(t.lit[t.off:])}
+		default:
+			k = suggestionKey{kind: SuggestBytes, set: g.terms[^next].set}
+		}
+
+		if i, ok := idx[k]; ok {
+			res[i].Count++
+			continue
+		}
+		idx[k] = len(res)
+		res = append(res, Suggestion{Kind: k.kind, Text: k.text, Set: k.set, Count: 1})
+	}
+
+	slices.SortStableFunc(res, func(a, b Suggestion) int {
+		if c := cmp.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Text, b.Text)
+	})
+	return res, nil
+}
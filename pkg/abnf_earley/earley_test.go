@@ -0,0 +1,288 @@
+package abnf_earley_test
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_earley"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(abnf.RunWithLeakCheck(m))
+}
+
+// exprGrammar returns the ambiguous grammar:
+//
+//	e = e "+" e / "a"
+func exprGrammar(t *testing.T) *abnf_earley.Grammar {
+	t.Helper()
+
+	g, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"e": abnf_earley.Alt(
+			abnf_earley.Seq(abnf_earley.Ref("e"), abnf_earley.Literal([]byte("+"), true), abnf_earley.Ref("e")),
+			abnf_earley.Literal([]byte("a"), false),
+		),
+	})
+	if err != nil {
+		t.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want nil", err)
+	}
+	return g
+}
+
+func sum(n int) []byte {
+	return []byte(strings.Repeat("a+", n) + "a")
+}
+
+func TestGrammar_Parse(t *testing.T) {
+	g := exprGrammar(t)
+
+	// the number of binary trees with n+1 leaves is the Catalan number C(n)
+	for n, want := range []uint64{1, 1, 2, 5, 14, 42, 132, 429} {
+		f, err := g.Parse("e", sum(n))
+		if err != nil {
+			t.Fatalf("g.Parse(\"e\", in) error = %v, want nil", err)
+		}
+		if got := f.Count(); got != want {
+			t.Fatalf("f.Count() = %d, want %d for %d operators", got, want, n)
+		}
+	}
+
+	f, err := g.Parse("e", []byte("A+a"))
+	if err != nil {
+		t.Fatalf("g.Parse(\"e\", in) error = %v, want nil", err)
+	}
+	if got, want := f.Count(), uint64(1); got != want {
+		t.Fatalf("f.Count() = %d, want %d", got, want)
+	}
+
+	if _, err := g.Parse("e", []byte("a+a+")); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Fatalf("g.Parse(\"e\", in) error = %v, want %v", err, abnf.ErrNotMatched)
+	}
+	if _, err := g.Parse("x", []byte("a")); err == nil {
+		t.Fatal("g.Parse(\"x\", in) error = nil, want error")
+	}
+}
+
+func TestGrammar_Parse_Large(t *testing.T) {
+	g := exprGrammar(t)
+
+	f, err := g.Parse("e", sum(100))
+	if err != nil {
+		t.Fatalf("g.Parse(\"e\", in) error = %v, want nil", err)
+	}
+	if got := f.Count(); got != math.MaxUint64 {
+		t.Fatalf("f.Count() = %d, want %d", got, uint64(math.MaxUint64))
+	}
+}
+
+func TestNewGrammar_Undefined(t *testing.T) {
+	_, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"a": abnf_earley.Seq(abnf_earley.Ref("b"), abnf_earley.Ref("c")),
+		"b": abnf_earley.Literal([]byte("b"), false),
+	})
+	if err == nil || !strings.Contains(err.Error(), "'c'") {
+		t.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want undefined rule 'c'", err)
+	}
+}
+
+func TestForest_Trees(t *testing.T) {
+	g := exprGrammar(t)
+
+	f, err := g.Parse("e", sum(3))
+	if err != nil {
+		t.Fatalf("g.Parse(\"e\", in) error = %v, want nil", err)
+	}
+
+	seen := make(map[string]bool)
+	for n := range f.Trees() {
+		if got, want := n.String(), "a+a+a+a"; got != want {
+			t.Fatalf("tree = %q, want %q", got, want)
+		}
+		seen[shape(n)] = true
+	}
+	if got, want := len(seen), 5; got != want {
+		t.Fatalf("got %d distinct trees, want %d", got, want)
+	}
+
+	var count int
+	for range f.Trees() {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Fatalf("got %d trees after break, want 1", count)
+	}
+}
+
+func shape(n *abnf.Node) string {
+	if len(n.Children) == 0 {
+		return n.String()
+	}
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i, c := range n.Children {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(shape(c))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+func TestForest_Ambiguities(t *testing.T) {
+	g, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"list": abnf_earley.Seq(abnf_earley.Ref("item"), abnf_earley.Repeat(0, 0, abnf_earley.Seq(
+			abnf_earley.Literal([]byte(","), true), abnf_earley.Ref("item"),
+		))),
+		"item": abnf_earley.Alt(abnf_earley.Ref("word"), abnf_earley.Ref("name")),
+		"word": abnf_earley.Repeat(1, 0, abnf_earley.Bytes(abnf.NewByteSet('a', 'b'))),
+		"name": abnf_earley.Repeat(1, 0, abnf_earley.Bytes(abnf.NewByteSet('b', 'c'))),
+	})
+	if err != nil {
+		t.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want nil", err)
+	}
+
+	f, err := g.Parse("list", []byte("ab,bb,cc"))
+	if err != nil {
+		t.Fatalf("g.Parse(\"list\", in) error = %v, want nil", err)
+	}
+	if got, want := f.Count(), uint64(2); got != want {
+		t.Fatalf("f.Count() = %d, want %d", got, want)
+	}
+
+	amb := f.Ambiguities()
+	if len(amb) != 1 {
+		t.Fatalf("f.Ambiguities() = %+v, want 1 ambiguity", amb)
+	}
+	if got, want := amb[0], (abnf_earley.Ambiguity{Key: "item", Pos: 3, End: 5, Count: 2}); got != want {
+		t.Fatalf("f.Ambiguities()[0] = %+v, want %+v", got, want)
+	}
+}
+
+func TestForest_Cycles(t *testing.T) {
+	g, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"a": abnf_earley.Alt(abnf_earley.Ref("b"), abnf_earley.Literal([]byte("x"), true)),
+		"b": abnf_earley.Ref("a"),
+	})
+	if err != nil {
+		t.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want nil", err)
+	}
+
+	f, err := g.Parse("a", []byte("x"))
+	if err != nil {
+		t.Fatalf("g.Parse(\"a\", in) error = %v, want nil", err)
+	}
+	if got := f.Count(); got != math.MaxUint64 {
+		t.Fatalf("f.Count() = %d, want %d", got, uint64(math.MaxUint64))
+	}
+
+	var count int
+	for range f.Trees() {
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("got %d trees, want 1", count)
+	}
+}
+
+func TestForest_Extern(t *testing.T) {
+	digits := abnf.Repeat1Inf("DIGITS", abnf.Range("DIGIT", []byte("0"), []byte("9")))
+	g, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"num": abnf_earley.Seq(
+			abnf_earley.Extern("DIGITS", digits),
+			abnf_earley.Repeat(0, 1, abnf_earley.Extern("DIGITS", digits)),
+		),
+	})
+	if err != nil {
+		t.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want nil", err)
+	}
+
+	f, err := g.Parse("num", []byte("123"))
+	if err != nil {
+		t.Fatalf("g.Parse(\"num\", in) error = %v, want nil", err)
+	}
+	// 123 and 1|23, 12|3
+	if got, want := f.Count(), uint64(3); got != want {
+		t.Fatalf("f.Count() = %d, want %d", got, want)
+	}
+	for n := range f.Trees() {
+		if n.Key != "num" || len(n.Children) == 0 || n.Children[0].Key != "DIGITS" {
+			t.Fatalf("tree = %+v, want num node with DIGITS children", n)
+		}
+	}
+}
+
+func BenchmarkGrammar_Parse(b *testing.B) {
+	g, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"e": abnf_earley.Alt(
+			abnf_earley.Seq(abnf_earley.Ref("e"), abnf_earley.Literal([]byte("+"), true), abnf_earley.Ref("e")),
+			abnf_earley.Literal([]byte("a"), false),
+		),
+	})
+	if err != nil {
+		b.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want nil", err)
+	}
+	in := sum(50)
+
+	b.ResetTimer()
+	for range b.N {
+		f, err := g.Parse("e", in)
+		if err != nil {
+			b.Fatalf("g.Parse(\"e\", in) error = %v, want nil", err)
+		}
+		f.Count()
+	}
+}
+
+func TestGrammar_Complete(t *testing.T) {
+	// line = key "=" value
+	// key = "timeout" / "title"
+	// value = 1*DIGIT / "on" / "off" / ("+" / "-") 1*DIGIT
+	digits := abnf_earley.Repeat(1, 0, abnf_earley.Extern("DIGIT", abnf.Range("DIGIT", []byte("0"), []byte("9"))))
+	g, err := abnf_earley.NewGrammar(map[string]abnf_earley.Expr{
+		"line": abnf_earley.Seq(abnf_earley.Ref("key"), abnf_earley.Literal([]byte("="), true), abnf_earley.Ref("value")),
+		"key":  abnf_earley.Alt(abnf_earley.Literal([]byte("timeout"), false), abnf_earley.Literal([]byte("title"), false)),
+		"value": abnf_earley.Alt(
+			digits,
+			abnf_earley.Literal([]byte("on"), false),
+			abnf_earley.Literal([]byte("off"), false),
+			abnf_earley.Seq(abnf_earley.Bytes(abnf.NewByteSet('+', '-')), digits),
+		),
+	})
+	if err != nil {
+		t.Fatalf("abnf_earley.NewGrammar(rules) error = %v, want nil", err)
+	}
+
+	for _, c := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{`"timeout"`, `"title"`, "key"}},
+		{"Ti", []string{`"meout"`, `"tle"`}},
+		{"timeout", []string{`"="`}},
+		{"timeout=", []string{`"off"`, `"on"`, "DIGIT", "value", "<2 octets>"}},
+		{"timeout=1", []string{"DIGIT"}},
+		{"timeout=on", nil},
+	} {
+		ss, err := g.Complete("line", []byte(c.prefix))
+		if err != nil {
+			t.Fatalf("g.Complete(\"line\", %q) error = %v, want nil", c.prefix, err)
+		}
+		var got []string
+		for _, s := range ss {
+			got = append(got, s.String())
+		}
+		if strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Fatalf("g.Complete(\"line\", %q) = %q, want %q", c.prefix, got, c.want)
+		}
+	}
+
+	if _, err := g.Complete("line", []byte("timeouts")); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Fatalf("g.Complete(\"line\", in) error = %v, want %v", err, abnf.ErrNotMatched)
+	}
+}
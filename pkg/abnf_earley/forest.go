@@ -0,0 +1,120 @@
+package abnf_earley
+
+import (
+	"github.com/ghettovoice/abnf"
+)
+
+// Forest is the shared packed parse forest of all parses of the input, see [Grammar.Parse].
+// Parse trees contain nodes of named rules and nodes of external operators,
+// terminals and anonymous subexpressions are merged into their rules.
+type Forest = abnf.Forest
+
+// Ambiguity is a rule match with more than one derivation, see [abnf.Forest.Ambiguities].
+type Ambiguity = abnf.Ambiguity
+
+// span is a symbol or a production prefix spanning input from pos to end.
+type span struct {
+	sym      symbol
+	prod     int32
+	dot      int32
+	pos, end int32
+}
+
+// forestBuilder builds the forest of parses from the Earley chart.
+// Named rules become keyed forest nodes, anonymous symbols and production prefixes
+// become intermediate nodes, so the forest is binarized and its size is cubic in the input length at worst.
+type forestBuilder struct {
+	c     *chart
+	b     *abnf.ForestBuilder
+	nodes map[span]abnf.ForestID
+}
+
+func newForest(c *chart, root symbol) *Forest {
+	fb := &forestBuilder{
+		c:     c,
+		b:     abnf.NewForestBuilder(c.in),
+		nodes: make(map[span]abnf.ForestID),
+	}
+	return fb.b.Build(fb.sym(root, 0, int32(len(c.in))))
+}
+
+// completed reports whether the production p spans input from i to j.
+func (fb *forestBuilder) completed(p, i, j int32) bool {
+	return fb.c.sets[j].has(item{p, int32(len(fb.c.g.prods[p].rhs)), i})
+}
+
+// spans reports whether the symbol s spans input from i to j.
+func (fb *forestBuilder) spans(s symbol, i, j int32) bool {
+	if s.isTerm() {
+		t := fb.c.g.terms[^s]
+		if t.op != nil {
+			_, ok := fb.c.externs[externKey{^s, i, j}]
+			return ok
+		}
+		return j == i+1 && t.set.Has(fb.c.in[i])
+	}
+	for _, p := range fb.c.g.byLHS[s] {
+		if fb.completed(int32(p), i, j) {
+			return true
+		}
+	}
+	return false
+}
+
+// sym returns the forest node of the nonterminal s spanning input from i to j.
+func (fb *forestBuilder) sym(s symbol, i, j int32) abnf.ForestID {
+	k := span{sym: s, pos: i, end: j}
+	if id, ok := fb.nodes[k]; ok {
+		return id
+	}
+
+	var id abnf.ForestID
+	if name := fb.c.g.names[s]; name != "" {
+		id = fb.b.Node(name, uint(i), uint(j))
+	} else {
+		id = fb.b.Intermediate(uint(i), uint(j))
+	}
+	fb.nodes[k] = id
+
+	for _, p := range fb.c.g.byLHS[s] {
+		if !fb.completed(int32(p), i, j) {
+			continue
+		}
+		if m := int32(len(fb.c.g.prods[p].rhs)); m == 0 {
+			fb.b.Pack(id)
+		} else {
+			fb.b.Pack(id, fb.prefix(int32(p), m, i, j))
+		}
+	}
+	return id
+}
+
+// prefix returns the forest node of the prefix of m symbols of the production p spanning input from i to k.
+func (fb *forestBuilder) prefix(p, m, i, k int32) abnf.ForestID {
+	key := span{prod: p, dot: m, pos: i, end: k}
+	if id, ok := fb.nodes[key]; ok {
+		return id
+	}
+	id := fb.b.Intermediate(uint(i), uint(k))
+	fb.nodes[key] = id
+
+	x := fb.c.g.prods[p].rhs[m-1]
+	for l := i; l <= k; l++ {
+		if !fb.c.sets[l].has(item{p, m - 1, i}) || !fb.spans(x, l, k) {
+			continue
+		}
+
+		var children []abnf.ForestID
+		if m > 1 {
+			children = append(children, fb.prefix(p, m-1, i, l))
+		}
+		switch {
+		case !x.isTerm():
+			children = append(children, fb.sym(x, l, k))
+		case fb.c.g.terms[^x].op != nil:
+			children = append(children, fb.b.Leaf(fb.c.externs[externKey{^x, l, k}]))
+		}
+		fb.b.Pack(id, children...)
+	}
+	return id
+}
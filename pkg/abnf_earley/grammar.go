@@ -0,0 +1,275 @@
+// Package abnf_earley implements an Earley parser for ABNF grammars.
+//
+// Unlike operators of the closure engine that enumerate all alternatives with backtracking
+// and take exponential time on ambiguous grammars, the Earley parser recognizes the input
+// in polynomial time and returns all parses as a shared packed parse forest, see [abnf.Forest].
+//
+// Grammars are context-free: dialect annotations of the closure engine are ignored.
+// Case-insensitive literals are folded octet by octet, so only ASCII letters are case-insensitive.
+package abnf_earley
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// Expr is a grammar expression.
+type Expr interface {
+	// compile appends symbols of the expression to seq.
+	compile(c *compiler, seq []symbol) []symbol
+}
+
+type refExpr struct{ name string }
+
+// Ref refers to the rule name.
+func Ref(name string) Expr { return refExpr{name} }
+
+type seqExpr struct{ exprs []Expr }
+
+// Seq defines a concatenation of expressions.
+func Seq(exprs ...Expr) Expr { return seqExpr{exprs} }
+
+type altExpr struct{ exprs []Expr }
+
+// Alt defines an alternation of expressions.
+func Alt(exprs ...Expr) Expr { return altExpr{exprs} }
+
+type repeatExpr struct {
+	min, max uint
+	expr     Expr
+}
+
+// Repeat defines a repetition of the expression from min to max times, max 0 means infinity.
+func Repeat(min, max uint, expr Expr) Expr { return repeatExpr{min, max, expr} }
+
+type bytesExpr struct{ set abnf.ByteSet }
+
+// Bytes defines a single octet from the set.
+func Bytes(set abnf.ByteSet) Expr { return bytesExpr{set} }
+
+type literalExpr struct {
+	val []byte
+	cs  bool
+}
+
+// Literal defines a sequence of octets, ASCII letters match case-insensitively unless cs is true.
+func Literal(val []byte, cs bool) Expr { return literalExpr{val, cs} }
+
+type externExpr struct {
+	name string
+	op   abnf.Operator
+}
+
+// Extern defines an external operator.
+// Every match of the operator is a terminal, the first node of each match length is kept in parse trees.
+func Extern(name string, op abnf.Operator) Expr { return externExpr{name, op} }
+
+// symbol is a nonterminal index if it is not negative, otherwise it is ^ of a terminal index.
+type symbol int32
+
+func (s symbol) isTerm() bool { return s < 0 }
+
+type production struct {
+	lhs symbol
+	rhs []symbol
+}
+
+type terminal struct {
+	set  abnf.ByteSet
+	name string
+	op   abnf.Operator
+	// lit is the literal the octet terminal is taken from at the offset off, used by completion.
+	lit []byte
+	off int
+}
+
+type litKey struct {
+	val string
+	cs  bool
+	off int
+}
+
+// Grammar is a context-free grammar compiled for the Earley parser.
+// It is safe for concurrent use.
+type Grammar struct {
+	prods   []production
+	byLHS   [][]int
+	names   []string
+	nameIdx map[string]symbol
+	terms   []terminal
+}
+
+type compiler struct {
+	g       *Grammar
+	setIdx  map[abnf.ByteSet]symbol
+	litIdx  map[litKey]symbol
+	extIdx  map[string]symbol
+	defined map[string]bool
+}
+
+// NewGrammar compiles rules into a grammar.
+func NewGrammar(rules map[string]Expr) (*Grammar, error) {
+	c := &compiler{
+		g:       &Grammar{nameIdx: make(map[string]symbol, len(rules))},
+		setIdx:  make(map[abnf.ByteSet]symbol),
+		litIdx:  make(map[litKey]symbol),
+		extIdx:  make(map[string]symbol),
+		defined: make(map[string]bool, len(rules)),
+	}
+
+	names := make([]string, 0, len(rules))
+	for n := range rules {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	for _, n := range names {
+		c.defined[n] = true
+		c.nonterm(n)
+	}
+	for _, n := range names {
+		lhs := c.nonterm(n)
+		if alt, ok := rules[n].(altExpr); ok {
+			for _, e := range alt.exprs {
+				c.production(lhs, e.compile(c, nil))
+			}
+		} else {
+			c.production(lhs, rules[n].compile(c, nil))
+		}
+	}
+
+	var errs []error
+	for _, n := range c.g.names {
+		if n != "" && !c.defined[n] {
+			errs = append(errs, fmt.Errorf("rule '%s' isn't defined", n))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return c.g, nil
+}
+
+func (c *compiler) nonterm(name string) symbol {
+	if s, ok := c.g.nameIdx[name]; ok {
+		return s
+	}
+	s := c.anon()
+	c.g.names[s] = name
+	c.g.nameIdx[name] = s
+	return s
+}
+
+func (c *compiler) anon() symbol {
+	c.g.names = append(c.g.names, "")
+	c.g.byLHS = append(c.g.byLHS, nil)
+	return symbol(len(c.g.names) - 1)
+}
+
+func (c *compiler) production(lhs symbol, rhs []symbol) {
+	c.g.prods = append(c.g.prods, production{lhs, rhs})
+	c.g.byLHS[lhs] = append(c.g.byLHS[lhs], len(c.g.prods)-1)
+}
+
+func (c *compiler) byteTerm(set abnf.ByteSet) symbol {
+	if s, ok := c.setIdx[set]; ok {
+		return s
+	}
+	c.g.terms = append(c.g.terms, terminal{set: set})
+	s := ^symbol(len(c.g.terms) - 1)
+	c.setIdx[set] = s
+	return s
+}
+
+func (e refExpr) compile(c *compiler, seq []symbol) []symbol {
+	return append(seq, c.nonterm(e.name))
+}
+
+func (e seqExpr) compile(c *compiler, seq []symbol) []symbol {
+	for _, e := range e.exprs {
+		seq = e.compile(c, seq)
+	}
+	return seq
+}
+
+func (e altExpr) compile(c *compiler, seq []symbol) []symbol {
+	s := c.anon()
+	for _, e := range e.exprs {
+		c.production(s, e.compile(c, nil))
+	}
+	return append(seq, s)
+}
+
+func (e repeatExpr) compile(c *compiler, seq []symbol) []symbol {
+	item := e.expr.compile(c, nil)
+	for range e.min {
+		seq = append(seq, item...)
+	}
+
+	if e.max == 0 {
+		// S = "" / S item
+		s := c.anon()
+		c.production(s, nil)
+		c.production(s, append([]symbol{s}, item...))
+		return append(seq, s)
+	}
+
+	if e.max > e.min {
+		// O1 = "" / item, On = "" / item On-1
+		var prev symbol
+		for i := uint(0); i < e.max-e.min; i++ {
+			s := c.anon()
+			c.production(s, nil)
+			rhs := slices.Clone(item)
+			if i > 0 {
+				rhs = append(rhs, prev)
+			}
+			c.production(s, rhs)
+			prev = s
+		}
+		seq = append(seq, prev)
+	}
+	return seq
+}
+
+func (e bytesExpr) compile(c *compiler, seq []symbol) []symbol {
+	return append(seq, c.byteTerm(e.set))
+}
+
+func (e literalExpr) compile(c *compiler, seq []symbol) []symbol {
+	for i, b := range e.val {
+		k := litKey{string(e.val), e.cs, i}
+		if s, ok := c.litIdx[k]; ok {
+			seq = append(seq, s)
+			continue
+		}
+
+		set := abnf.NewByteSet(b)
+		if !e.cs {
+			switch {
+			case 'a' <= b && b <= 'z':
+				set.Add(b - 'a' + 'A')
+			case 'A' <= b && b <= 'Z':
+				set.Add(b - 'A' + 'a')
+			}
+		}
+		c.g.terms = append(c.g.terms, terminal{set: set, lit: e.val, off: i})
+		s := ^symbol(len(c.g.terms) - 1)
+		c.litIdx[k] = s
+		seq = append(seq, s)
+	}
+	return seq
+}
+
+func (e externExpr) compile(c *compiler, seq []symbol) []symbol {
+	s, ok := c.extIdx[e.name]
+	if !ok {
+		c.g.terms = append(c.g.terms, terminal{name: e.name, op: e.op})
+		s = ^symbol(len(c.g.terms) - 1)
+		c.extIdx[e.name] = s
+	}
+	return append(seq, s)
+}
@@ -0,0 +1,190 @@
+package abnf_earley
+
+import (
+	"fmt"
+
+	"github.com/ghettovoice/abnf"
+)
+
+type item struct {
+	prod   int32
+	dot    int32
+	origin int32
+}
+
+type earleySet struct {
+	items []item
+	seen  map[item]struct{}
+	// waiting maps nonterminals to indexes of items expecting them.
+	waiting map[symbol][]int
+	// completed contains nonterminals completed with the origin at this set.
+	completed map[symbol]bool
+}
+
+func (s *earleySet) add(it item) {
+	if _, ok := s.seen[it]; ok {
+		return
+	}
+	s.seen[it] = struct{}{}
+	s.items = append(s.items, it)
+}
+
+func (s *earleySet) has(it item) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.seen[it]
+	return ok
+}
+
+type externKey struct {
+	term     symbol
+	pos, end int32
+}
+
+type chart struct {
+	g    *Grammar
+	in   []byte
+	sets []*earleySet
+	// externs keeps the first node of each match length of external terminals.
+	externs map[externKey]*abnf.Node
+	// ends keeps end positions of external terminals matches, the end of keys is unused.
+	ends map[externKey][]int
+}
+
+func (c *chart) set(i int) *earleySet {
+	if c.sets[i] == nil {
+		c.sets[i] = &earleySet{
+			seen:      make(map[item]struct{}),
+			waiting:   make(map[symbol][]int),
+			completed: make(map[symbol]bool),
+		}
+	}
+	return c.sets[i]
+}
+
+// Parse parses the whole input with the rule start and returns the shared packed forest of all parses.
+// Parse trees contain nodes of named rules and nodes of external operators,
+// terminals and anonymous subexpressions are merged into their rules.
+// It returns an error wrapping [abnf.ErrNotMatched] with the furthest reached position if the input doesn't match.
+func (g *Grammar) Parse(start string, in []byte) (*Forest, error) {
+	c, s, err := g.recognize(start, in)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range g.byLHS[s] {
+		if c.sets[len(in)].has(item{int32(p), int32(len(g.prods[p].rhs)), 0}) {
+			return newForest(c, s), nil
+		}
+	}
+	return nil, fmt.Errorf("rule '%s' failed at position %d: %w", start, c.furthest(), abnf.ErrNotMatched)
+}
+
+// recognize builds the Earley chart of the input for the rule start.
+func (g *Grammar) recognize(start string, in []byte) (*chart, symbol, error) {
+	s, ok := g.nameIdx[start]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown rule '%s'", start)
+	}
+
+	c := &chart{
+		g:       g,
+		in:      in,
+		sets:    make([]*earleySet, len(in)+1),
+		externs: make(map[externKey]*abnf.Node),
+		ends:    make(map[externKey][]int),
+	}
+	for _, p := range g.byLHS[s] {
+		c.set(0).add(item{int32(p), 0, 0})
+	}
+
+	for j := range c.sets {
+		if c.sets[j] != nil {
+			c.process(j)
+		}
+	}
+	return c, s, nil
+}
+
+// furthest returns the furthest position reached by the chart.
+func (c *chart) furthest() int {
+	for j := len(c.sets) - 1; j > 0; j-- {
+		if c.sets[j] != nil {
+			return j
+		}
+	}
+	return 0
+}
+
+func (c *chart) process(j int) {
+	set := c.sets[j]
+	for k := 0; k < len(set.items); k++ {
+		it := set.items[k]
+		p := c.g.prods[it.prod]
+
+		if int(it.dot) == len(p.rhs) {
+			// complete
+			if int(it.origin) == j {
+				set.completed[p.lhs] = true
+			}
+			orig := c.sets[it.origin]
+			for _, wi := range orig.waiting[p.lhs] {
+				w := orig.items[wi]
+				set.add(item{w.prod, w.dot + 1, w.origin})
+			}
+			continue
+		}
+
+		next := p.rhs[it.dot]
+		adv := item{it.prod, it.dot + 1, it.origin}
+		if !next.isTerm() {
+			// predict
+			set.waiting[next] = append(set.waiting[next], k)
+			for _, np := range c.g.byLHS[next] {
+				set.add(item{int32(np), 0, int32(j)})
+			}
+			if set.completed[next] {
+				set.add(adv)
+			}
+			continue
+		}
+
+		// scan
+		for _, end := range c.scan(^next, j) {
+			c.set(end).add(adv)
+		}
+	}
+}
+
+// scan returns end positions of matches of the terminal t at the position pos.
+func (c *chart) scan(t symbol, pos int) []int {
+	term := c.g.terms[t]
+	if term.op == nil {
+		if pos < len(c.in) && term.set.Has(c.in[pos]) {
+			return []int{pos + 1}
+		}
+		return nil
+	}
+
+	sk := externKey{t, int32(pos), -1}
+	if ends, ok := c.ends[sk]; ok {
+		return ends
+	}
+
+	var ends []int
+	ns := abnf.NewNodes()
+	if err := term.op(nil, c.in, uint(pos), ns); err == nil {
+		for _, n := range ns.All() {
+			end := pos + n.Len()
+			k := externKey{t, int32(pos), int32(end)}
+			if _, ok := c.externs[k]; !ok {
+				c.externs[k] = n
+				ends = append(ends, end)
+			}
+		}
+	}
+	ns.Free()
+	c.ends[sk] = ends
+	return ends
+}
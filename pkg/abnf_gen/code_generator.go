@@ -4,26 +4,56 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 
 	"github.com/dave/jennifer/jen"
 	"mvdan.cc/gofumpt/format"
+
+	"github.com/ghettovoice/abnf"
 )
 
 // CodeGenerator generates ABNF rules as Go sources.
 type CodeGenerator struct {
 	// External ABNF rules.
+	// FIRST sets of generated rules are published by the generated FirstMap function,
+	// so they can be passed to [ExternalRule.First] of grammars that refer to the rules.
 	External map[string]ExternalRule
 	// Package name for generated sources.
 	PackageName string
+	// Prune enables pruning of parse trees to rule-level nodes.
+	// Anonymous sub-expression nodes are spliced into the closest rule node when nodes are created,
+	// see [abnf.Pruned]. The outermost generated operator of a parse sets up pruning,
+	// unless the parse is already pruned, e.g. with [abnf.WithPrune].
+	Prune bool
+	// FoldByteClasses enables folding of alternations of single octet values and ranges
+	// into [abnf.ByteClass] operators. Folded nodes have no children.
+	FoldByteClasses bool
+	// LiteralSets enables compiling of alternations of literals into [abnf.LiteralSet] operators.
+	LiteralSets bool
+	// Predict enables FIRST set prediction: alternatives of alternations are guarded by [abnf.Predict],
+	// so alternatives that can't match the next input octet aren't invoked.
+	Predict bool
+	// PEG enables PEG semantics: alternations are ordered choices that return the first matched alternative,
+	// repetitions and options are possessive and rules are memoized with [abnf.Memo],
+	// so parses started with [abnf.WithMemo], as rules start them, take linear time. LiteralSets is ignored in this mode.
+	PEG bool
+	// Engine is an execution engine of generated operators, [EngineClosure] by default.
+	// [EngineVM] embeds a compiled program into the sources, other options are ignored by it.
+	Engine Engine
 
 	rulesParser
 
 	code     bytes.Buffer
 	ruleName string
+	pragmas  pragmas
+	first    map[string]firstSet
 }
 
-const mainPkg = "github.com/ghettovoice/abnf"
+const (
+	mainPkg = "github.com/ghettovoice/abnf"
+	vmPkg   = "github.com/ghettovoice/abnf/pkg/abnf_vm"
+)
 
 // ReadFrom reads and parses ABNF grammar from src.
 func (g *CodeGenerator) ReadFrom(src io.Reader) (int64, error) {
@@ -41,12 +71,18 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 
 		f.ImportName("sync", "")
 		f.ImportName(mainPkg, "abnf")
+		f.ImportName(vmPkg, "abnf_vm")
 		for _, extRule := range g.External {
 			if extRule.PackagePath != "" && extRule.PackageName != "" {
 				f.ImportName(extRule.PackagePath, extRule.PackageName)
 			}
 		}
 
+		g.first = nil
+		if g.Predict {
+			g.first = firstSets(g.rules, g.External)
+		}
+
 		rs := make([]rule, 0, len(g.rules))
 		for _, r := range g.rules {
 			rs = append(rs, r)
@@ -55,10 +91,26 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 			return rs[i].pubName() < rs[j].pubName()
 		})
 
-		f.Var().Defs(
+		vars := []jen.Code{
 			jen.Id("oprsDescr").Op("=").Op("&").Qual("", "OperatorsDescr").Values(),
 			jen.Id("rulesDescr").Op("=").Op("&").Qual("", "RulesDescr").Values(),
-		)
+		}
+		if g.Prune && g.Engine != EngineVM {
+			vars = append(vars, jen.Id("keepRules").Op("=").Qual(mainPkg, "KeepKeys").CallFunc(func(args *jen.Group) {
+				for _, n := range g.ruleNames() {
+					args.Lit(n)
+				}
+			}))
+		}
+		f.Var().Defs(vars...)
+
+		if g.Engine == EngineVM {
+			progStmt, err := g.programStmt()
+			if err != nil {
+				return 0, fmt.Errorf("generate code: %w", err)
+			}
+			f.Add(progStmt).Line()
+		}
 
 		f.Comment("Operators returns operators descriptor.")
 		f.Func().Id("Operators").Params().Op("*").Qual("", "OperatorsDescr").
@@ -81,6 +133,7 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 				Params(jen.Id("desc").Op("*").Qual("", "OperatorsDescr")).
 				Id(r.pubName()).
 				Params(
+					jen.Id("ctx").Op("*").Qual(mainPkg, "Context"),
 					jen.Id("in").Index().Byte(),
 					jen.Id("pos").Uint(),
 					jen.Id("ns").Op("*").Qual(mainPkg, "Nodes"),
@@ -89,11 +142,12 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 				Block(
 					jen.Id("desc").Dot(r.privName()+"Once").Dot("Do").Call(
 						jen.Func().Params().Block(
-							jen.Id("desc").Dot(r.privName()).Op("=").Add(r.buildStmt(g)),
+							jen.Id("desc").Dot(r.privName()).Op("=").Add(g.ruleStmt(r)),
 						),
 					),
 					jen.Return(
 						jen.Id("desc").Dot(r.privName()).Call(
+							jen.Id("ctx"),
 							jen.Id("in"),
 							jen.Id("pos"),
 							jen.Id("ns"),
@@ -121,15 +175,7 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 					jen.Id("ns").Op("*").Qual(mainPkg, "Nodes"),
 				).
 				Error().
-				Block(
-					jen.Return(
-						jen.Id("oprsDescr").Dot(r.pubName()).Call(
-							jen.Id("in"),
-							jen.Lit(0),
-							jen.Id("ns"),
-						),
-					),
-				).
+				Block(jen.Return(g.ruleCallStmt(r))).
 				Line()
 			rulesMethods = append(rulesMethods, ruleStmt)
 
@@ -162,6 +208,31 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 			).
 			Line()
 
+		first := g.first
+		if first == nil {
+			first = firstSets(g.rules, g.External)
+		}
+		firstElems := make(jen.Dict, len(rs))
+		for _, r := range rs {
+			if fs, ok := first[r.name]; ok && fs.predictive() {
+				firstElems[jen.Lit(r.name)] = byteSetStmt(fs.set)
+			}
+		}
+
+		f.Comment("FirstMap returns FIRST sets of rules, i.e. sets of octets any match of the rule starts with.")
+		f.Comment("Rules that can match empty input or can't be predicted are omitted.")
+		f.Func().
+			Id("FirstMap").
+			Params().
+			Map(jen.String()).Qual(mainPkg, "ByteSet").
+			Block(
+				jen.Return(
+					jen.Map(jen.String()).Qual(mainPkg, "ByteSet").
+						Values(firstElems),
+				),
+			).
+			Line()
+
 		f.Comment("OperatorsDescr defines operators descriptor that provides operators as methods.")
 		f.Type().Id("OperatorsDescr").Struct(oprsFields...).Line()
 		f.Add(oprsMethods...)
@@ -189,6 +260,80 @@ func (g *CodeGenerator) WriteTo(dst io.Writer) (int64, error) {
 	return int64(num), err
 }
 
+func (g *CodeGenerator) ruleStmt(r rule) jen.Code {
+	if g.Engine == EngineVM {
+		return jen.Id("program").Call().Dot("Operator").Call(jen.Lit(r.name))
+	}
+	stmt := r.buildStmt(g)
+	if g.PEG {
+		stmt = jen.Qual(mainPkg, "Memo").Call(stmt)
+	}
+	if g.Prune {
+		stmt = jen.Qual(mainPkg, "Pruned").Call(stmt, jen.Id("keepRules"))
+	}
+	return stmt
+}
+
+// ruleNames returns sorted names of the grammar and external rules.
+func (g *CodeGenerator) ruleNames() []string {
+	names := make([]string, 0, len(g.rules)+len(g.External))
+	for n := range g.rules {
+		names = append(names, n)
+	}
+	for n := range g.External {
+		if _, ok := g.rules[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// programStmt compiles rules and generates the program variable.
+func (g *CodeGenerator) programStmt() (jen.Code, error) {
+	b, err := compileProgram(g.rules, g.External)
+	if err != nil {
+		return nil, err
+	}
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("compile program: %w", err)
+	}
+
+	ext := make(jen.Dict, len(b.Externs()))
+	for _, n := range b.Externs() {
+		ext[jen.Lit(n)] = ruleNameOperator{n}.buildStmt(g)
+	}
+
+	return jen.Var().Id("program").Op("=").Qual("sync", "OnceValue").Call(
+		jen.Func().Params().Op("*").Qual(vmPkg, "Program").Block(
+			jen.Return(jen.Qual(vmPkg, "MustLoad").Call(
+				jen.Index().Byte().Parens(jen.Lit(string(data))),
+				jen.Map(jen.String()).Qual(mainPkg, "Operator").Values(ext),
+			)),
+		),
+	), nil
+}
+
+// ruleCallStmt returns a call of the rule operator that starts parsing from position 0.
+// With PEG enabled the parse is started with [abnf.WithMemo].
+func (g *CodeGenerator) ruleCallStmt(r rule) jen.Code {
+	if g.PEG && g.Engine != EngineVM {
+		return jen.Qual(mainPkg, "Parse").Call(
+			jen.Id("oprsDescr").Dot(r.pubName()),
+			jen.Id("in"),
+			jen.Id("ns"),
+			jen.Qual(mainPkg, "WithMemo").Call(),
+		)
+	}
+	return jen.Id("oprsDescr").Dot(r.pubName()).Call(
+		jen.Nil(),
+		jen.Id("in"),
+		jen.Lit(0),
+		jen.Id("ns"),
+	)
+}
+
 func (g *CodeGenerator) oprtKey(key string) string {
 	if g.ruleName != "" {
 		key = g.ruleName
@@ -202,12 +347,93 @@ type statementBuilder interface {
 }
 
 func (r rule) buildStmt(g *CodeGenerator) jen.Code {
+	g.pragmas = r.pragmas
+	if g.PEG {
+		g.pragmas |= pragmaPossessive
+	}
+	if r.pragmas.has(pragmaAtomic) {
+		g.ruleName = ""
+		return jen.Qual(mainPkg, "Atomic").
+			Custom(
+				jen.Options{
+					Open:      "(",
+					Close:     ")",
+					Separator: ", ",
+					Multi:     true,
+				},
+				jen.Lit(r.name),
+				r.oprt.buildStmt(g),
+				jen.Empty(),
+			)
+	}
+
 	g.ruleName = r.name
 	return r.oprt.buildStmt(g)
 }
 
+// repeatFuncName returns the name of the variable repetition function for the current rule.
+func (g *CodeGenerator) repeatFuncName() string {
+	switch {
+	case g.pragmas.has(pragmaPossessive):
+		return "RepeatPossessive"
+	case g.pragmas.has(pragmaLazy):
+		return "RepeatLazy"
+	default:
+		return "Repeat"
+	}
+}
+
+func byteSetStmt(set abnf.ByteSet) jen.Code {
+	return jen.Qual(mainPkg, "ByteSet").ValuesFunc(func(vals *jen.Group) {
+		for _, w := range set {
+			vals.Add(jen.Id(fmt.Sprintf("0x%016x", w)))
+		}
+	})
+}
+
 func (op altOperator) buildStmt(g *CodeGenerator) jen.Code {
-	return jen.Qual(mainPkg, "Alt").
+	if g.FoldByteClasses {
+		if set, ok := foldByteClass(op, g.rulesParser.rules, g.External); ok {
+			return jen.Qual(mainPkg, "ByteClass").Call(jen.Lit(g.oprtKey(op.key())), byteSetStmt(set))
+		}
+	}
+	if g.LiteralSets && !g.PEG {
+		if lits, ok := literalSetOf(op); ok {
+			return jen.Qual(mainPkg, "LiteralSet").
+				CustomFunc(
+					jen.Options{
+						Open:      "(",
+						Close:     ")",
+						Separator: ", ",
+						Multi:     true,
+					},
+					func(args *jen.Group) {
+						args.Add(jen.Lit(g.oprtKey(op.key())))
+						for _, lit := range lits {
+							fields := jen.Dict{
+								jen.Id("Key"): jen.Lit(lit.Key),
+								jen.Id("Value"): jen.Index().Byte().ValuesFunc(func(vals *jen.Group) {
+									for _, b := range lit.Value {
+										vals.Add(jen.Lit(int(b)))
+									}
+								}),
+							}
+							if lit.CaseSensitive {
+								fields[jen.Id("CaseSensitive")] = jen.True()
+							}
+							args.Add(jen.Qual(mainPkg, "LiteralSetItem").Values(fields))
+						}
+						args.Add(jen.Empty())
+					},
+				)
+		}
+	}
+
+	altFunc := "Alt"
+	if g.PEG {
+		altFunc = "AltFirst"
+	}
+	return jen.Qual(mainPkg, altFunc).
 		CustomFunc(
 			jen.Options{
 				Open:      "(",
@@ -218,7 +444,13 @@ func (op altOperator) buildStmt(g *CodeGenerator) jen.Code {
 			func(args *jen.Group) {
 				args.Add(jen.Lit(g.oprtKey(op.key())))
 				for _, op := range op.oprts {
-					args.Add(op.buildStmt(g))
+					stmt := op.buildStmt(g)
+					if g.first != nil {
+						if f := firstOf(op, g.first, g.External); f.predictive() {
+							stmt = jen.Qual(mainPkg, "Predict").Call(jen.Lit(op.key()), byteSetStmt(f.set), stmt)
+						}
+					}
+					args.Add(stmt)
 				}
 				args.Add(jen.Empty())
 			},
@@ -245,6 +477,24 @@ func (op concatOperator) buildStmt(g *CodeGenerator) jen.Code {
 }
 
 func (op repeatOperator) buildStmt(g *CodeGenerator) jen.Code {
+	fnName := g.repeatFuncName()
+	if fnName != "Repeat" {
+		return jen.Qual(mainPkg, fnName).
+			Custom(
+				jen.Options{
+					Open:      "(",
+					Close:     ")",
+					Separator: ", ",
+					Multi:     true,
+				},
+				jen.Lit(g.oprtKey(op.key())),
+				jen.Lit(int(op.min)),
+				jen.Lit(int(op.max)),
+				op.oprt.buildStmt(g),
+				jen.Empty(),
+			)
+	}
+
 	if op.max == 0 && (op.min == 0 || op.min == 1) {
 		var fnName string
 		if op.min == 0 {
@@ -313,6 +563,23 @@ func (op ruleNameOperator) buildStmt(g *CodeGenerator) jen.Code {
 }
 
 func (op optionOperator) buildStmt(g *CodeGenerator) jen.Code {
+	if fnName := g.repeatFuncName(); fnName != "Repeat" {
+		return jen.Qual(mainPkg, fnName).
+			Custom(
+				jen.Options{
+					Open:      "(",
+					Close:     ")",
+					Separator: ", ",
+					Multi:     true,
+				},
+				jen.Lit(g.oprtKey(op.key())),
+				jen.Lit(0),
+				jen.Lit(1),
+				op.oprt.buildStmt(g),
+				jen.Empty(),
+			)
+	}
+
 	return jen.Qual(mainPkg, "Optional").
 		Custom(
 			jen.Options{
@@ -342,6 +609,80 @@ func (op charValOperator) buildStmt(g *CodeGenerator) jen.Code {
 	)
 }
 
+func (op bindOperator) buildStmt(g *CodeGenerator) jen.Code {
+	key := g.oprtKey(op.key())
+	countStmt := op.oprt.buildStmt(g)
+
+	num := "DecNumber"
+	if op.hex {
+		num = "HexNumber"
+	}
+
+	// operators of the rest are built once, the closure only adds octets elements of the count
+	var defs []jen.Code
+	rest := make([]jen.Code, len(op.rest))
+	for i, o := range op.rest {
+		if _, ok := o.(octetsOperator); ok {
+			rest[i] = o.buildStmt(g)
+			continue
+		}
+		id := fmt.Sprintf("rest%d", i)
+		defs = append(defs, jen.Id(id).Op(":=").Add(o.buildStmt(g)))
+		rest[i] = jen.Id(id)
+	}
+
+	var restStmt jen.Code
+	if len(rest) == 1 {
+		restStmt = rest[0]
+	} else {
+		restStmt = jen.Qual(mainPkg, "Concat").
+			CustomFunc(
+				jen.Options{
+					Open:      "(",
+					Close:     ")",
+					Separator: ", ",
+					Multi:     true,
+				},
+				func(args *jen.Group) {
+					args.Add(jen.Lit(op.restKey))
+					for _, stmt := range rest {
+						args.Add(stmt)
+					}
+					args.Add(jen.Empty())
+				},
+			)
+	}
+
+	bindStmt := jen.Qual(mainPkg, "Bind").
+		Custom(
+			jen.Options{
+				Open:      "(",
+				Close:     ")",
+				Separator: ", ",
+				Multi:     true,
+			},
+			jen.Lit(key),
+			countStmt,
+			jen.Qual(mainPkg, num),
+			jen.Func().Params(jen.Id("n").Uint()).Qual(mainPkg, "Operator").Block(
+				jen.Return(restStmt),
+			),
+			jen.Empty(),
+		)
+	if len(defs) == 0 {
+		return bindStmt
+	}
+	return jen.Func().Params().Qual(mainPkg, "Operator").Block(
+		append(defs, jen.Return(bindStmt))...,
+	).Call()
+}
+
+// buildStmt is only called by bindOperator.buildStmt, n is the count parameter of the Bind closure.
+// Octets elements outside of a counted concatenation are rejected when rules are parsed.
+func (op octetsOperator) buildStmt(*CodeGenerator) jen.Code {
+	return jen.Qual(mainPkg, "Octets").Call(jen.Lit(op.key()), jen.Id("n"))
+}
+
 func (op numValOperator) buildStmt(g *CodeGenerator) jen.Code {
 	vals := op.byteVals()
 
@@ -3,8 +3,13 @@ package abnf_gen_test
 import (
 	"bytes"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
 	"github.com/ghettovoice/abnf/pkg/abnf_gen"
 	"github.com/google/go-cmp/cmp"
 )
@@ -15,42 +20,20 @@ func TestCodeGenerator_WriteTo(t *testing.T) {
 		t.Fatalf("read ABNF file failed: %v", err)
 	}
 
+	// abnf_def is generated with FIRST sets of abnf_core rules, see abnf_def/abnf.yml
+	external := make(map[string]abnf_gen.ExternalRule)
+	for _, n := range []string{"CRLF", "WSP", "BIT", "VCHAR", "DIGIT", "HEXDIG", "DQUOTE", "ALPHA"} {
+		first := abnf_core.FirstMap()[n]
+		external[n] = abnf_gen.ExternalRule{
+			PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
+			PackageName: "abnf_core",
+			First:       &first,
+		}
+	}
 	g := &abnf_gen.CodeGenerator{
 		PackageName: "abnf_def",
-		External: map[string]abnf_gen.ExternalRule{
-			"CRLF": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"WSP": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"BIT": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"VCHAR": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"DIGIT": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"HEXDIG": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"DQUOTE": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-			"ALPHA": {
-				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
-				PackageName: "abnf_core",
-			},
-		},
+		External:    external,
+		Predict:     true,
 	}
 	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
 		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
@@ -132,6 +115,16 @@ func RulesMap() map[string]abnf.Rule {
 	}
 }
 
+// FirstMap returns FIRST sets of rules, i.e. sets of octets any match of the rule starts with.
+// Rules that can match empty input or can't be predicted are omitted.
+func FirstMap() map[string]abnf.ByteSet {
+	return map[string]abnf.ByteSet{
+		"struct": {0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000},
+		"type":   {0x0003000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000},
+		"var":    {0x0003000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000},
+	}
+}
+
 // OperatorsDescr defines operators descriptor that provides operators as methods.
 type OperatorsDescr struct {
 	_struct     abnf.Operator
@@ -143,7 +136,7 @@ type OperatorsDescr struct {
 }
 
 // Struct operator: struct = %x41-5A / %x61-7A
-func (desc *OperatorsDescr) Struct(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Struct(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc._structOnce.Do(func() {
 		desc._struct = abnf.Alt(
 			"struct",
@@ -151,11 +144,11 @@ func (desc *OperatorsDescr) Struct(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Range("%x61-7A", []byte{97}, []byte{122}),
 		)
 	})
-	return desc._struct(in, pos, ns)
+	return desc._struct(ctx, in, pos, ns)
 }
 
 // Type operator: type = "0" / "1"
-func (desc *OperatorsDescr) Type(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Type(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc._typeOnce.Do(func() {
 		desc._type = abnf.Alt(
 			"type",
@@ -163,11 +156,11 @@ func (desc *OperatorsDescr) Type(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("\"1\"", []byte{49}),
 		)
 	})
-	return desc._type(in, pos, ns)
+	return desc._type(ctx, in, pos, ns)
 }
 
 // Var operator: var = type / struct
-func (desc *OperatorsDescr) Var(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) Var(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc._varOnce.Do(func() {
 		desc._var = abnf.Alt(
 			"var",
@@ -175,7 +168,7 @@ func (desc *OperatorsDescr) Var(in []byte, pos uint, ns *abnf.Nodes) error {
 			desc.Struct,
 		)
 	})
-	return desc._var(in, pos, ns)
+	return desc._var(ctx, in, pos, ns)
 }
 
 // RulesDescr defines rules descriptor that provides rules as methods.
@@ -183,17 +176,17 @@ type RulesDescr struct{}
 
 // Struct rule: struct = %x41-5A / %x61-7A
 func (*RulesDescr) Struct(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Struct(in, 0, ns)
+	return oprsDescr.Struct(nil, in, 0, ns)
 }
 
 // Type rule: type = "0" / "1"
 func (*RulesDescr) Type(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Type(in, 0, ns)
+	return oprsDescr.Type(nil, in, 0, ns)
 }
 
 // Var rule: var = type / struct
 func (*RulesDescr) Var(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.Var(in, 0, ns)
+	return oprsDescr.Var(nil, in, 0, ns)
 }
 `
 
@@ -264,6 +257,12 @@ func RulesMap() map[string]abnf.Rule {
 	}
 }
 
+// FirstMap returns FIRST sets of rules, i.e. sets of octets any match of the rule starts with.
+// Rules that can match empty input or can't be predicted are omitted.
+func FirstMap() map[string]abnf.ByteSet {
+	return map[string]abnf.ByteSet{}
+}
+
 // OperatorsDescr defines operators descriptor that provides operators as methods.
 type OperatorsDescr struct {
 	r1     abnf.Operator
@@ -273,7 +272,7 @@ type OperatorsDescr struct {
 }
 
 // R1 operator: r1 = r2 / "2" / "3" / "4"
-func (desc *OperatorsDescr) R1(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) R1(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.r1Once.Do(func() {
 		desc.r1 = abnf.Alt(
 			"r1",
@@ -283,11 +282,11 @@ func (desc *OperatorsDescr) R1(in []byte, pos uint, ns *abnf.Nodes) error {
 			abnf.Literal("\"4\"", []byte{52}),
 		)
 	})
-	return desc.r1(in, pos, ns)
+	return desc.r1(ctx, in, pos, ns)
 }
 
 // R2 operator: r2 = BIT / ALPHA
-func (desc *OperatorsDescr) R2(in []byte, pos uint, ns *abnf.Nodes) error {
+func (desc *OperatorsDescr) R2(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 	desc.r2Once.Do(func() {
 		desc.r2 = abnf.Alt(
 			"r2",
@@ -295,7 +294,7 @@ func (desc *OperatorsDescr) R2(in []byte, pos uint, ns *abnf.Nodes) error {
 			desc.ALPHA,
 		)
 	})
-	return desc.r2(in, pos, ns)
+	return desc.r2(ctx, in, pos, ns)
 }
 
 // RulesDescr defines rules descriptor that provides rules as methods.
@@ -303,12 +302,12 @@ type RulesDescr struct{}
 
 // R1 rule: r1 = r2 / "2" / "3" / "4"
 func (*RulesDescr) R1(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.R1(in, 0, ns)
+	return oprsDescr.R1(nil, in, 0, ns)
 }
 
 // R2 rule: r2 = BIT / ALPHA
 func (*RulesDescr) R2(in []byte, ns *abnf.Nodes) error {
-	return oprsDescr.R2(in, 0, ns)
+	return oprsDescr.R2(nil, in, 0, ns)
 }
 `
 
@@ -316,3 +315,357 @@ func (*RulesDescr) R2(in []byte, ns *abnf.Nodes) error {
 		t.Fatalf("got != want\ndiff (-got +want)\n%v", cmp.Diff(got, want))
 	}
 }
+
+func TestCodeGenerator_Pragmas(t *testing.T) {
+	src := []byte(
+		"; @possessive\n" +
+			"r1 = *r2 [\"-\"]\n" +
+			"r2 = \"a\" / \"b\" ; @atomic\n" +
+			"r3 = *\"c\" ; @lazy\n",
+	)
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "pragmas",
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`		desc.r1 = abnf.Concat(
+			"r1",
+			abnf.RepeatPossessive(
+				"*r2",
+				0,
+				0,
+				desc.R2,
+			),
+			abnf.RepeatPossessive(
+				"[\"-\"]",
+				0,
+				1,
+				abnf.Literal("\"-\"", []byte{45}),
+			),
+		)`,
+		`		desc.r2 = abnf.Atomic(
+			"r2",
+			abnf.Alt(
+				"\"a\" / \"b\"",
+				abnf.Literal("\"a\"", []byte{97}),
+				abnf.Literal("\"b\"", []byte{98}),
+			),
+		)`,
+		`		desc.r3 = abnf.RepeatLazy(
+			"r3",
+			0,
+			0,
+			abnf.Literal("\"c\"", []byte{99}),
+		)`,
+	} {
+		if got := dst.String(); !strings.Contains(got, want) {
+			t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+		}
+	}
+}
+
+func TestCodeGenerator_Pragmas_Unknown(t *testing.T) {
+	for _, src := range []string{
+		"r = \"a\" ; @posessive\n",
+		"; @atomic @lazyy\nr = \"a\"\n",
+	} {
+		g := &abnf_gen.CodeGenerator{PackageName: "pragmas"}
+		if _, err := g.ReadFrom(bytes.NewBufferString(src)); err == nil {
+			t.Fatalf("g.ReadFrom(%q) error = nil, want error", src)
+		}
+	}
+}
+
+func TestCodeGenerator_Octets(t *testing.T) {
+	src := []byte(
+		"literal = \"{\" number \"}\" <octets number>\n" +
+			"chunk = size CRLF <octets size hex> CRLF\n" +
+			"number = 1*DIGIT\n" +
+			"size = 1*HEXDIG\n",
+	)
+	ext := make(map[string]abnf_gen.ExternalRule)
+	for _, n := range []string{"CRLF", "DIGIT", "HEXDIG"} {
+		ext[n] = abnf_gen.ExternalRule{
+			PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
+			PackageName: "abnf_core",
+		}
+	}
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "octets",
+		External:    ext,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`		desc.literal = abnf.Concat(
+			"literal",
+			abnf.Literal("\"{\"", []byte{123}),
+			func() abnf.Operator {
+				rest0 := abnf.Literal("\"}\"", []byte{125})
+				return abnf.Bind(
+					"number \"}\" <octets number>",
+					desc.Number,
+					abnf.DecNumber,
+					func(n uint) abnf.Operator {
+						return abnf.Concat(
+							"\"}\" <octets number>",
+							rest0,
+							abnf.Octets("<octets number>", n),
+						)
+					},
+				)
+			}(),
+		)`,
+		`		desc.chunk = func() abnf.Operator {
+			rest0 := abnf_core.Operators().CRLF
+			rest2 := abnf_core.Operators().CRLF
+			return abnf.Bind(
+				"chunk",
+				desc.Size,
+				abnf.HexNumber,
+				func(n uint) abnf.Operator {
+					return abnf.Concat(
+						"CRLF <octets size hex> CRLF",
+						rest0,
+						abnf.Octets("<octets size hex>", n),
+						rest2,
+					)
+				},
+			)
+		}()`,
+	} {
+		if got := dst.String(); !strings.Contains(got, want) {
+			t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("skip compilation of generated code in short mode")
+	}
+	// the package must be inside the module to resolve its imports
+	dir, err := os.MkdirTemp(".", "octets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "octets.go"), dst.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("go", "build", "./"+dir).CombinedOutput(); err != nil {
+		t.Fatalf("go build generated code error = %v, output:\n%s", err, out)
+	}
+}
+
+func TestCodeGenerator_FoldByteClasses(t *testing.T) {
+	src := []byte("alpha = %x41-5A / %x61-7A\n")
+	g := &abnf_gen.CodeGenerator{
+		PackageName:     "fold",
+		FoldByteClasses: true,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `desc.alpha = abnf.ByteClass("alpha", abnf.ByteSet{0x0000000000000000, 0x07fffffe07fffffe, 0x0000000000000000, 0x0000000000000000})`
+	if got := dst.String(); !strings.Contains(got, want) {
+		t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCodeGenerator_LiteralSets(t *testing.T) {
+	src := []byte("method = \"GET\" / %s\"POST\"\n")
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "literals",
+		LiteralSets: true,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `		desc.method = abnf.LiteralSet(
+			"method",
+			abnf.LiteralSetItem{
+				Key:   "\"GET\"",
+				Value: []byte{71, 69, 84},
+			},
+			abnf.LiteralSetItem{
+				CaseSensitive: true,
+				Key:           "%s\"POST\"",
+				Value:         []byte{80, 79, 83, 84},
+			},
+		)`
+	if got := dst.String(); !strings.Contains(got, want) {
+		t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCodeGenerator_Predict(t *testing.T) {
+	digit := abnf.NewByteSet()
+	digit.AddRange('0', '9')
+
+	src := []byte(
+		"r1 = r2 / DIGIT / [\"-\"] \"+\"\n" +
+			"r2 = %x61-62\n",
+	)
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "predict",
+		External: map[string]abnf_gen.ExternalRule{
+			"DIGIT": {
+				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
+				PackageName: "abnf_core",
+				First:       &digit,
+			},
+		},
+		Predict: true,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `		desc.r1 = abnf.Alt(
+			"r1",
+			abnf.Predict("r2", abnf.ByteSet{0x0000000000000000, 0x0000000600000000, 0x0000000000000000, 0x0000000000000000}, desc.R2),
+			abnf.Predict("DIGIT", abnf.ByteSet{0x03ff000000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf_core.Operators().DIGIT),
+			abnf.Predict("[\"-\"] \"+\"", abnf.ByteSet{0x0000280000000000, 0x0000000000000000, 0x0000000000000000, 0x0000000000000000}, abnf.Concat(`
+	if got := dst.String(); !strings.Contains(got, want) {
+		t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCodeGenerator_PEG(t *testing.T) {
+	src := []byte("r1 = \"a\" / *\"b\" / [\"c\"]\n")
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "peg",
+		PEG:         true,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `		desc.r1 = abnf.Memo(abnf.AltFirst(
+			"r1",
+			abnf.Literal("\"a\"", []byte{97}),
+			abnf.RepeatPossessive(
+				"*\"b\"",
+				0,
+				0,
+				abnf.Literal("\"b\"", []byte{98}),
+			),
+			abnf.RepeatPossessive(
+				"[\"c\"]",
+				0,
+				1,
+				abnf.Literal("\"c\"", []byte{99}),
+			),
+		))`
+	if got := dst.String(); !strings.Contains(got, want) {
+		t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+	}
+
+	want = `	return abnf.Parse(oprsDescr.R1, in, ns, abnf.WithMemo())`
+	if got := dst.String(); !strings.Contains(got, want) {
+		t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCodeGenerator_Prune(t *testing.T) {
+	src := []byte(
+		"r1 = r2 *(\",\" r2)\n" +
+			"r2 = \"a\" / \"b\"\n",
+	)
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "prune",
+		Prune:       true,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`	keepRules  = abnf.KeepKeys("r1", "r2")`,
+		`		desc.r1 = abnf.Pruned(abnf.Concat(`,
+		`		desc.r2 = abnf.Pruned(abnf.Alt(`,
+		`		), keepRules)`,
+	} {
+		if got := dst.String(); !strings.Contains(got, want) {
+			t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+		}
+	}
+}
+
+func TestCodeGenerator_EngineVM(t *testing.T) {
+	src := []byte(
+		"r1 = r2 / DIGIT\n" +
+			"r2 = %x61-62\n",
+	)
+	g := &abnf_gen.CodeGenerator{
+		PackageName: "vm",
+		External: map[string]abnf_gen.ExternalRule{
+			"DIGIT": {
+				PackagePath: "github.com/ghettovoice/abnf/pkg/abnf_core",
+				PackageName: "abnf_core",
+			},
+		},
+		Engine: abnf_gen.EngineVM,
+	}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst bytes.Buffer
+	if _, err := g.WriteTo(&dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`var program = sync.OnceValue(func() *abnf_vm.Program {
+	return abnf_vm.MustLoad([]byte("ABVM\x01`,
+		`map[string]abnf.Operator{"DIGIT": abnf_core.Operators().DIGIT})`,
+		`		desc.r1 = program().Operator("r1")`,
+		`		desc.r2 = program().Operator("r2")`,
+	} {
+		if got := dst.String(); !strings.Contains(got, want) {
+			t.Fatalf("generated code doesn't contain\n%s\ngot:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package abnf_gen
+
+import (
+	"fmt"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_earley"
+)
+
+type grammarCompiler interface {
+	earleyExpr(c *earleyCompiler) abnf_earley.Expr
+}
+
+type earleyCompiler struct {
+	rules map[string]rule
+	ext   map[string]ExternalRule
+}
+
+// compileGrammar compiles rules into a grammar of the Earley parser.
+func compileGrammar(rules map[string]rule, ext map[string]ExternalRule) (g *abnf_earley.Grammar, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if e, ok := v.(error); ok {
+				err = fmt.Errorf("compile grammar: %w", e)
+				return
+			}
+			panic(v)
+		}
+	}()
+
+	c := &earleyCompiler{rules: rules, ext: ext}
+	exprs := make(map[string]abnf_earley.Expr, len(rules))
+	for n, r := range rules {
+		if _, ok := ext[n]; !ok {
+			exprs[n] = r.oprt.earleyExpr(c)
+		}
+	}
+	return abnf_earley.NewGrammar(exprs)
+}
+
+func (op altOperator) earleyExpr(c *earleyCompiler) abnf_earley.Expr {
+	exprs := make([]abnf_earley.Expr, len(op.oprts))
+	for i, o := range op.oprts {
+		exprs[i] = o.earleyExpr(c)
+	}
+	return abnf_earley.Alt(exprs...)
+}
+
+func (op concatOperator) earleyExpr(c *earleyCompiler) abnf_earley.Expr {
+	exprs := make([]abnf_earley.Expr, len(op.oprts))
+	for i, o := range op.oprts {
+		exprs[i] = o.earleyExpr(c)
+	}
+	return abnf_earley.Seq(exprs...)
+}
+
+func (op repeatOperator) earleyExpr(c *earleyCompiler) abnf_earley.Expr {
+	return abnf_earley.Repeat(op.min, op.max, op.oprt.earleyExpr(c))
+}
+
+func (op optionOperator) earleyExpr(c *earleyCompiler) abnf_earley.Expr {
+	return abnf_earley.Repeat(0, 1, op.oprt.earleyExpr(c))
+}
+
+func (op ruleNameOperator) earleyExpr(c *earleyCompiler) abnf_earley.Expr {
+	if extRule, ok := c.ext[op.key()]; ok {
+		if extRule.Operator == nil {
+			panic(fmt.Errorf("invalid external ABNF rule '%s' found: 'Operator' field is empty", op.key()))
+		}
+		return abnf_earley.Extern(op.key(), extRule.Operator)
+	}
+	return abnf_earley.Ref(op.key())
+}
+
+func (op charValOperator) earleyExpr(*earleyCompiler) abnf_earley.Expr {
+	return abnf_earley.Literal([]byte(op.val), op.cs)
+}
+
+func (op numValOperator) earleyExpr(*earleyCompiler) abnf_earley.Expr {
+	vals := op.byteVals()
+	if op.isRange {
+		if len(vals[0]) == 1 && len(vals[1]) == 1 {
+			var set abnf.ByteSet
+			set.AddRange(vals[0][0], vals[1][0])
+			return abnf_earley.Bytes(set)
+		}
+		return abnf_earley.Extern(op.key(), abnf.Range(op.key(), vals[0], vals[1]))
+	}
+
+	var buf []byte
+	for _, v := range vals {
+		buf = append(buf, v...)
+	}
+	return abnf_earley.Literal(buf, true)
+}
+
+func (op bindOperator) earleyExpr(*earleyCompiler) abnf_earley.Expr {
+	panic(fmt.Errorf("counted field '%s' isn't supported by the Earley parser", op.key()))
+}
+
+func (op octetsOperator) earleyExpr(*earleyCompiler) abnf_earley.Expr {
+	panic(fmt.Errorf("counted field '%s' isn't supported by the Earley parser", op.key()))
+}
@@ -9,8 +9,13 @@ import (
 //
 // [ParserGenerator] uses Operator field.
 // [CodeGenerator] uses PackagePath and PackageName fields.
+// Both generators use First field for FIRST set prediction, if it is nil,
+// references to the rule aren't predicted.
 type ExternalRule struct {
 	Operator    abnf.Operator
 	PackagePath string
 	PackageName string
+	// First is a set of octets any match of the rule starts with.
+	// The rule must not match empty input.
+	First *abnf.ByteSet
 }
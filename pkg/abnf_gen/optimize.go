@@ -0,0 +1,273 @@
+package abnf_gen
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// foldByteClass returns a set of octets matched by the alternation op
+// if every alternative matches exactly one octet.
+// Alternatives may be single octet char-vals and num-vals, num-val ranges, groups
+// and references to foldable rules defined in rules and not overridden by ext.
+//
+// Char-vals and num-vals are matched case-insensitively by [abnf.Literal],
+// so both letter cases are added for them to keep the folded operator equivalent.
+func foldByteClass(op altOperator, rules map[string]rule, ext map[string]ExternalRule) (abnf.ByteSet, bool) {
+	seen := make(map[string]bool, len(ext))
+	for n := range ext {
+		seen[n] = true
+	}
+	return byteClassOf(op, rules, seen)
+}
+
+// byteClassOf returns a set of octets matched by op, rules from seen aren't resolved.
+func byteClassOf(op operator, rules map[string]rule, seen map[string]bool) (abnf.ByteSet, bool) {
+	var set abnf.ByteSet
+	switch op := op.(type) {
+	case altOperator:
+		for _, op := range op.oprts {
+			s, ok := byteClassOf(op, rules, seen)
+			if !ok {
+				return set, false
+			}
+			set = set.Union(s)
+		}
+		return set, true
+	case concatOperator:
+		if len(op.oprts) != 1 {
+			return set, false
+		}
+		return byteClassOf(op.oprts[0], rules, seen)
+	case ruleNameOperator:
+		r, ok := rules[op.key()]
+		if !ok || seen[r.name] || r.pragmas != 0 {
+			return set, false
+		}
+		seen[r.name] = true
+		defer delete(seen, r.name)
+		return byteClassOf(r.oprt, rules, seen)
+	case charValOperator:
+		if len(op.val) != 1 {
+			return set, false
+		}
+		addByte(&set, op.val[0], !op.cs)
+		return set, true
+	case numValOperator:
+		vals := op.byteVals()
+		if op.isRange {
+			if len(vals[0]) != 1 || len(vals[1]) != 1 {
+				return set, false
+			}
+			set.AddRange(vals[0][0], vals[1][0])
+			return set, true
+		}
+		if len(vals) != 1 || len(vals[0]) != 1 {
+			return set, false
+		}
+		addByte(&set, vals[0][0], true)
+		return set, true
+	default:
+		return set, false
+	}
+}
+
+func addByte(set *abnf.ByteSet, b byte, ci bool) {
+	set.Add(b)
+	if !ci {
+		return
+	}
+	switch {
+	case 'a' <= b && b <= 'z':
+		set.Add(b - 'a' + 'A')
+	case 'A' <= b && b <= 'Z':
+		set.Add(b - 'A' + 'a')
+	}
+}
+
+// literalSetOf returns literals of the alternation op if every alternative is a char-val or a num-val literal.
+func literalSetOf(op altOperator) ([]abnf.LiteralSetItem, bool) {
+	lits := make([]abnf.LiteralSetItem, 0, len(op.oprts))
+	for _, o := range op.oprts {
+		switch o := o.(type) {
+		case charValOperator:
+			lits = append(lits, abnf.LiteralSetItem{Key: o.key(), Value: []byte(o.val), CaseSensitive: o.cs})
+		case numValOperator:
+			if o.isRange {
+				return nil, false
+			}
+			lits = append(lits, abnf.LiteralSetItem{Key: o.key(), Value: bytes.Join(o.byteVals(), nil)})
+		default:
+			return nil, false
+		}
+	}
+	return lits, true
+}
+
+// literalKeys returns sorted keys of nodes of case-insensitive char-vals of rules.
+// A rule defined as a single char-val creates the literal node with the rule name,
+// unless the rule is atomic and the node is wrapped.
+func literalKeys(rules map[string]rule) []string {
+	set := make(map[string]bool)
+	var walk func(op operator)
+	walk = func(op operator) {
+		switch op := op.(type) {
+		case altOperator:
+			for _, op := range op.oprts {
+				walk(op)
+			}
+		case concatOperator:
+			for _, op := range op.oprts {
+				walk(op)
+			}
+		case bindOperator:
+			walk(op.oprt)
+			for _, op := range op.rest {
+				walk(op)
+			}
+		case repeatOperator:
+			walk(op.oprt)
+		case optionOperator:
+			walk(op.oprt)
+		case charValOperator:
+			if !op.cs {
+				set[op.key()] = true
+			}
+		}
+	}
+	for n, r := range rules {
+		if op, ok := r.oprt.(charValOperator); ok && !op.cs && !r.pragmas.has(pragmaAtomic) {
+			set[n] = true
+			continue
+		}
+		walk(r.oprt)
+	}
+	return slices.Sorted(maps.Keys(set))
+}
+
+// firstSet is a FIRST set of an operator: a set of octets its matches start with
+// and whether it can match empty input.
+type firstSet struct {
+	set      abnf.ByteSet
+	nullable bool
+}
+
+// anyFirst is a FIRST set of operators that can't be predicted.
+var anyFirst = firstSet{abnf.ByteSet{}.Complement(), true}
+
+func (f firstSet) union(o firstSet) firstSet {
+	return firstSet{f.set.Union(o.set), f.nullable || o.nullable}
+}
+
+// predictive reports whether the operator can be skipped when the next octet isn't in the set.
+func (f firstSet) predictive() bool {
+	return !f.nullable && f.set != anyFirst.set
+}
+
+// firstSets computes FIRST sets of rules.
+// External rules are opaque, so anything that refers to them can't be predicted
+// unless their FIRST sets are provided.
+func firstSets(rules map[string]rule, ext map[string]ExternalRule) map[string]firstSet {
+	fs := make(map[string]firstSet, len(rules))
+	for n := range rules {
+		if _, ok := ext[n]; !ok {
+			fs[n] = firstSet{}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for n, r := range rules {
+			if _, ok := ext[n]; ok {
+				continue
+			}
+			f := firstOf(r.oprt, fs, ext)
+			if f != fs[n] {
+				fs[n] = f
+				changed = true
+			}
+		}
+	}
+	return fs
+}
+
+// firstOf returns a FIRST set of op using FIRST sets of rules from fs.
+// Sets of rules that aren't computed yet are empty in fs to reach the fixpoint in firstSets.
+// Unknown rules aren't in fs and can't be predicted.
+func firstOf(op operator, fs map[string]firstSet, ext map[string]ExternalRule) firstSet {
+	var f firstSet
+	switch op := op.(type) {
+	case altOperator:
+		for _, op := range op.oprts {
+			f = f.union(firstOf(op, fs, ext))
+		}
+		return f
+	case concatOperator:
+		return firstOfSeq(op.oprts, fs, ext)
+	case bindOperator:
+		return firstOfSeq(append([]operator{op.oprt}, op.rest...), fs, ext)
+	case repeatOperator:
+		f = firstOf(op.oprt, fs, ext)
+		f.nullable = f.nullable || op.min == 0
+		return f
+	case optionOperator:
+		f = firstOf(op.oprt, fs, ext)
+		f.nullable = true
+		return f
+	case ruleNameOperator:
+		if r, ok := ext[op.key()]; ok {
+			if r.First == nil {
+				return anyFirst
+			}
+			return firstSet{set: *r.First}
+		}
+		if f, ok := fs[op.key()]; ok {
+			return f
+		}
+		return anyFirst
+	case charValOperator:
+		if len(op.val) == 0 {
+			return firstSet{nullable: true}
+		}
+		addFirstByte(&f.set, op.val[0], !op.cs)
+		return f
+	case numValOperator:
+		vals := op.byteVals()
+		if op.isRange {
+			if len(vals[0]) != 1 || len(vals[1]) != 1 {
+				return anyFirst
+			}
+			f.set.AddRange(vals[0][0], vals[1][0])
+			return f
+		}
+		addFirstByte(&f.set, vals[0][0], true)
+		return f
+	default:
+		return anyFirst
+	}
+}
+
+func firstOfSeq(ops []operator, fs map[string]firstSet, ext map[string]ExternalRule) firstSet {
+	f := firstSet{nullable: true}
+	for _, op := range ops {
+		of := firstOf(op, fs, ext)
+		f.set = f.set.Union(of.set)
+		if !of.nullable {
+			f.nullable = false
+			break
+		}
+	}
+	return f
+}
+
+// addFirstByte adds the first octet b of a literal to set.
+// Case-insensitive literals are lower-cased with Unicode rules,
+// so any non-ASCII octet may start them.
+func addFirstByte(set *abnf.ByteSet, b byte, ci bool) {
+	if ci && b >= 0x80 {
+		set.AddRange(0x80, 0xff)
+		return
+	}
+	addByte(set, b, ci)
+}
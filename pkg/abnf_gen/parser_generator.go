@@ -3,24 +3,51 @@ package abnf_gen
 import (
 	"fmt"
 	"io"
+	"slices"
 
 	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_earley"
+	"github.com/ghettovoice/abnf/pkg/abnf_vm"
 )
 
 // ParserGenerator generates ABNF rules as operator functions or operator factories in memory.
 type ParserGenerator struct {
 	External map[string]ExternalRule
+	// Prune enables pruning of parse trees to rule-level nodes.
+	// Anonymous sub-expression nodes are spliced into the closest rule node when nodes are created,
+	// see [abnf.Pruned]. Returned operators start pruning unless the parse is already pruned, e.g. with [abnf.WithPrune],
+	// rule references inside the grammar don't re-apply it.
+	Prune bool
+	// FoldByteClasses enables folding of alternations of single octet values and ranges
+	// into [abnf.ByteClass] operators. Folded nodes have no children.
+	FoldByteClasses bool
+	// LiteralSets enables compiling of alternations of literals into [abnf.LiteralSet] operators.
+	LiteralSets bool
+	// Predict enables FIRST set prediction: alternatives of alternations are guarded by [abnf.Predict],
+	// so alternatives that can't match the next input octet aren't invoked.
+	Predict bool
+	// PEG enables PEG semantics: alternations are ordered choices that return the first matched alternative,
+	// repetitions and options are possessive and rules are memoized with [abnf.Memo],
+	// so parses started with [abnf.WithMemo], as rules start them, take linear time. LiteralSets is ignored in this mode.
+	PEG bool
+	// Engine is an execution engine of operators, [EngineClosure] by default.
+	// Other options are ignored by [EngineVM].
+	Engine Engine
 
 	rulesParser
 
 	oprts    map[string]abnf.Operator
+	pruned   map[string]abnf.Operator
 	rules    map[string]abnf.Rule
 	ruleName string
+	pragmas  pragmas
+	first    map[string]firstSet
 }
 
 // ReadFrom reads and parses ABNF grammar from src.
 func (g *ParserGenerator) ReadFrom(src io.Reader) (int64, error) {
 	clear(g.oprts)
+	clear(g.pruned)
 	return g.rulesParser.ReadFrom(src)
 }
 
@@ -30,29 +57,135 @@ func (g *ParserGenerator) Operators() map[string]abnf.Operator {
 		if g.oprts == nil {
 			g.oprts = make(map[string]abnf.Operator, len(g.rulesParser.rules))
 		}
+		if g.Engine == EngineVM {
+			prog, err := g.Program()
+			if err != nil {
+				panic(err)
+			}
+			for _, r := range prog.Rules {
+				g.oprts[r.Name] = prog.Operator(r.Name)
+			}
+			return g.oprts
+		}
+		g.first = nil
+		if g.Predict {
+			g.first = firstSets(g.rulesParser.rules, g.External)
+		}
 		for n, r := range g.rulesParser.rules {
-			g.oprts[n] = r.buildOprt(g)
+			op := r.buildOprt(g)
+			if g.PEG {
+				op = abnf.Memo(op)
+			}
+			g.oprts[n] = op
 		}
 	}
-	return g.oprts
+	if !g.Prune || g.Engine == EngineVM {
+		return g.oprts
+	}
+
+	if len(g.pruned) == 0 {
+		if g.pruned == nil {
+			g.pruned = make(map[string]abnf.Operator, len(g.oprts))
+		}
+		keep := abnf.KeepKeys(g.RuleNames()...)
+		for n, op := range g.oprts {
+			g.pruned[n] = abnf.Pruned(op, keep)
+		}
+	}
+	return g.pruned
 }
 
 // Rules returns a map of ABNF rules as functions that start parsing from position 0.
+// With PEG enabled rules start parses with [abnf.WithMemo].
 func (g *ParserGenerator) Rules() map[string]abnf.Rule {
 	if len(g.rules) == 0 {
 		oprts := g.Operators()
 		if g.rules == nil {
 			g.rules = make(map[string]abnf.Rule, len(oprts))
 		}
+		var opts []abnf.ParseOption
+		if g.PEG && g.Engine != EngineVM {
+			opts = append(opts, abnf.WithMemo())
+		}
 		for n, op := range oprts {
 			g.rules[n] = func(in []byte, ns *abnf.Nodes) error {
-				return op(in, 0, ns)
+				return abnf.Parse(op, in, ns, opts...)
 			}
 		}
 	}
 	return g.rules
 }
 
+// Program compiles ABNF rules into a program of the VM engine, see [EngineVM].
+func (g *ParserGenerator) Program() (*abnf_vm.Program, error) {
+	extOps := make(map[string]abnf.Operator, len(g.External))
+	for n, r := range g.External {
+		extOps[n] = r.Operator
+	}
+	b, err := compileProgram(g.rulesParser.rules, g.External)
+	if err != nil {
+		return nil, err
+	}
+	return b.Build(extOps)
+}
+
+// First returns the FIRST set of the rule, i.e. a set of octets any non-empty match of the rule starts with.
+// It returns false if the rule isn't found or the set is unknown,
+// e.g. the rule starts with an external rule without [ExternalRule.First].
+func (g *ParserGenerator) First(name string) (abnf.ByteSet, bool) {
+	if _, ok := g.rulesParser.rules[name]; !ok {
+		return abnf.ByteSet{}, false
+	}
+	f := firstSets(g.rulesParser.rules, g.External)[name]
+	if f.set == anyFirst.set {
+		return abnf.ByteSet{}, false
+	}
+	return f.set, true
+}
+
+// Searcher returns a searcher of matches of the rule in a larger input.
+// Positions that can't start a match are skipped using the FIRST set of the rule, see [ParserGenerator.First].
+// It returns nil if the rule isn't found.
+func (g *ParserGenerator) Searcher(name string, opts ...abnf.ParseOption) *abnf.Searcher {
+	op, ok := g.Operators()[name]
+	if !ok {
+		return nil
+	}
+	var first *abnf.ByteSet
+	if set, ok := g.First(name); ok {
+		first = &set
+	}
+	return abnf.NewSearcher(op, first, opts...)
+}
+
+// LiteralKeys returns sorted keys of nodes of case-insensitive char-vals, i.e. their quoted values
+// and names of rules defined as a single char-val, see [abnf.Canonicalizer.FoldLiterals].
+func (g *ParserGenerator) LiteralKeys() []string {
+	return literalKeys(g.rulesParser.rules)
+}
+
+// Grammar compiles ABNF rules into a grammar of the Earley parser.
+// The parser finds all parses of ambiguous grammars in polynomial time, see [abnf_earley.Forest].
+// External rules are matched as terminals with their operators.
+func (g *ParserGenerator) Grammar() (*abnf_earley.Grammar, error) {
+	return compileGrammar(g.rulesParser.rules, g.External)
+}
+
+// RuleNames returns sorted names of all parsed and external ABNF rules.
+func (g *ParserGenerator) RuleNames() []string {
+	names := make([]string, 0, len(g.rulesParser.rules)+len(g.External))
+	for n := range g.rulesParser.rules {
+		names = append(names, n)
+	}
+	for n := range g.External {
+		if _, ok := g.rulesParser.rules[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
 func (g *ParserGenerator) oprtKey(key string) string {
 	if g.ruleName != "" {
 		key = g.ruleName
@@ -66,16 +199,43 @@ type operatorBuilder interface {
 }
 
 func (r rule) buildOprt(g *ParserGenerator) abnf.Operator {
-	g.ruleName = r.name
+	g.pragmas = r.pragmas
+	if g.PEG {
+		g.pragmas |= pragmaPossessive
+	}
+	if r.pragmas.has(pragmaAtomic) {
+		g.ruleName = ""
+		return abnf.Atomic(r.name, r.oprt.buildOprt(g))
+	}
 
+	g.ruleName = r.name
 	return r.oprt.buildOprt(g)
 }
 
 func (op altOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 	key := g.oprtKey(op.key())
+	if g.FoldByteClasses {
+		if set, ok := foldByteClass(op, g.rulesParser.rules, g.External); ok {
+			return abnf.ByteClass(key, set)
+		}
+	}
+	if g.LiteralSets && !g.PEG {
+		if lits, ok := literalSetOf(op); ok {
+			return abnf.LiteralSet(key, lits...)
+		}
+	}
 	oprts := make([]abnf.Operator, 0, len(op.oprts))
 	for _, op := range op.oprts {
-		oprts = append(oprts, op.buildOprt(g))
+		oprt := op.buildOprt(g)
+		if g.first != nil {
+			if f := firstOf(op, g.first, g.External); f.predictive() {
+				oprt = abnf.Predict(op.key(), f.set, oprt)
+			}
+		}
+		oprts = append(oprts, oprt)
+	}
+	if g.PEG {
+		return abnf.AltFirst(key, oprts[0], oprts[1:]...)
 	}
 	return abnf.Alt(key, oprts[0], oprts[1:]...)
 }
@@ -92,6 +252,13 @@ func (op concatOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 func (op repeatOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 	key := g.oprtKey(op.key())
 
+	switch {
+	case g.pragmas.has(pragmaPossessive):
+		return abnf.RepeatPossessive(key, op.min, op.max, op.oprt.buildOprt(g))
+	case g.pragmas.has(pragmaLazy):
+		return abnf.RepeatLazy(key, op.min, op.max, op.oprt.buildOprt(g))
+	}
+
 	if op.max == 0 {
 		if op.min == 0 {
 			return abnf.Repeat0Inf(key, op.oprt.buildOprt(g))
@@ -116,7 +283,7 @@ func (op ruleNameOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 		return extRule.Operator
 	}
 
-	return func(in []byte, pos uint, ns *abnf.Nodes) error {
+	return func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
 		var (
 			oprt abnf.Operator
 			ok   bool
@@ -124,12 +291,21 @@ func (op ruleNameOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 		if oprt, ok = g.oprts[op.key()]; !ok {
 			panic(fmt.Errorf("unknown ABNF rule '%s'", op.key()))
 		}
-		return oprt(in, pos, ns)
+		return oprt(ctx, in, pos, ns)
 	}
 }
 
 func (op optionOperator) buildOprt(g *ParserGenerator) abnf.Operator {
-	return abnf.Optional(g.oprtKey(op.key()), op.oprt.buildOprt(g))
+	key := g.oprtKey(op.key())
+
+	switch {
+	case g.pragmas.has(pragmaPossessive):
+		return abnf.RepeatPossessive(key, 0, 1, op.oprt.buildOprt(g))
+	case g.pragmas.has(pragmaLazy):
+		return abnf.RepeatLazy(key, 0, 1, op.oprt.buildOprt(g))
+	}
+
+	return abnf.Optional(key, op.oprt.buildOprt(g))
 }
 
 func (op charValOperator) buildOprt(g *ParserGenerator) abnf.Operator {
@@ -142,11 +318,45 @@ func (op charValOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 	return oprtFunc(g.oprtKey(op.key()), []byte(op.val))
 }
 
+func (op bindOperator) buildOprt(g *ParserGenerator) abnf.Operator {
+	key := g.oprtKey(op.key())
+	countOp := op.oprt.buildOprt(g)
+
+	num := abnf.DecNumber
+	if op.hex {
+		num = abnf.HexNumber
+	}
+
+	rest := make([]abnf.Operator, len(op.rest))
+	for i, o := range op.rest {
+		if _, ok := o.(octetsOperator); !ok {
+			rest[i] = o.buildOprt(g)
+		}
+	}
+
+	return abnf.Bind(key, countOp, num, func(n uint) abnf.Operator {
+		ops := slices.Clone(rest)
+		for i, o := range op.rest {
+			if o, ok := o.(octetsOperator); ok {
+				ops[i] = abnf.Octets(o.key(), n)
+			}
+		}
+		if len(ops) == 1 {
+			return ops[0]
+		}
+		return abnf.Concat(op.restKey, ops[0], ops[1:]...)
+	})
+}
+
+func (op octetsOperator) buildOprt(*ParserGenerator) abnf.Operator {
+	panic(fmt.Errorf("octets element '%s' must follow its count element in the same concatenation", op.key()))
+}
+
 func (op numValOperator) buildOprt(g *ParserGenerator) abnf.Operator {
 	vals := op.byteVals()
 
 	if op.isRange {
-		return abnf.Range(op.key(), vals[0], vals[1])
+		return abnf.Range(g.oprtKey(op.key()), vals[0], vals[1])
 	}
 
 	buf := make([]byte, 0, len(vals))
@@ -2,11 +2,13 @@ package abnf_gen_test
 
 import (
 	"bytes"
+	"os"
 	"testing"
 
 	"github.com/ghettovoice/abnf"
 	"github.com/ghettovoice/abnf/pkg/abnf_core"
 	"github.com/ghettovoice/abnf/pkg/abnf_gen"
+	"github.com/ghettovoice/abnf/pkg/abnf_vm"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
@@ -39,7 +41,7 @@ func TestParserGenerator_Operators(t *testing.T) {
 	ns := abnf.NewNodes()
 	defer ns.Free()
 
-	if err := op([]byte("0"), 0, ns); err != nil {
+	if err := op(nil, []byte("0"), 0, ns); err != nil {
 		t.Fatalf("op([]byte(\"0\"), 0, nil) error = %v, want nil", err)
 	}
 
@@ -71,3 +73,800 @@ func TestParserGenerator_Operators(t *testing.T) {
 		)
 	}
 }
+
+func TestParserGenerator_Prune(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{
+		External: map[string]abnf_gen.ExternalRule{
+			"DIGIT": {
+				Operator: abnf_core.Operators().DIGIT,
+			},
+		},
+		Prune: true,
+	}
+	src := bytes.NewBuffer([]byte(
+		"r1 = \"{\" *(r2 / \",\") \"}\"\n" +
+			"r2 = 1*DIGIT\n",
+	))
+
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := g.Rules()["r1"]([]byte("{1,23}"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"r1\"](in, ns) error = %v, want nil", err)
+	}
+
+	want := &abnf.Node{
+		Key:   "r1",
+		Value: []byte("{1,23}"),
+		Children: abnf.Nodes{
+			{
+				Key:   "r2",
+				Pos:   1,
+				Value: []byte("1"),
+				Children: abnf.Nodes{
+					{Key: "DIGIT", Pos: 1, Value: []byte("1")},
+				},
+			},
+			{
+				Key:   "r2",
+				Pos:   3,
+				Value: []byte("23"),
+				Children: abnf.Nodes{
+					{Key: "DIGIT", Pos: 3, Value: []byte("2")},
+					{Key: "DIGIT", Pos: 4, Value: []byte("3")},
+				},
+			},
+		},
+	}
+	if got := ns.Best(); !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("g.Rules()[\"r1\"](in, ns) = %+v, want %+v\ndiff (-got +want):\n%v",
+			got, want,
+			cmp.Diff(got, want, cmpopts.EquateEmpty()),
+		)
+	}
+
+	if got, want := g.RuleNames(), []string{"DIGIT", "r1", "r2"}; !cmp.Equal(got, want) {
+		t.Fatalf("g.RuleNames() = %v, want %v", got, want)
+	}
+}
+
+func TestParserGenerator_Pragmas(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{}
+	src := bytes.NewBuffer([]byte(
+		"r1 = *\"a\" \"a\" ; @possessive\n" +
+			"r2 = *\"a\" \"a\"\n",
+	))
+
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := g.Rules()["r1"]([]byte("aaa"), ns); err == nil {
+		t.Fatalf("g.Rules()[\"r1\"](in, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+
+	ns.Clear()
+	if err := g.Rules()["r2"]([]byte("aaa"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"r2\"](in, ns) error = %v, want nil", err)
+	}
+	if got := ns.Best().String(); got != "aaa" {
+		t.Fatalf("g.Rules()[\"r2\"](in, ns) = %q, want %q", got, "aaa")
+	}
+}
+
+func TestParserGenerator_Octets(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{
+		External: map[string]abnf_gen.ExternalRule{
+			"CRLF":   {Operator: abnf_core.Operators().CRLF},
+			"DIGIT":  {Operator: abnf_core.Operators().DIGIT},
+			"HEXDIG": {Operator: abnf_core.Operators().HEXDIG},
+		},
+	}
+	src := bytes.NewBuffer([]byte(
+		"literal = \"{\" number \"}\" CRLF <octets number>\n" +
+			"chunk = size CRLF <octets size hex> CRLF\n" +
+			"number = 1*DIGIT\n" +
+			"size = 1*HEXDIG\n",
+	))
+
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := g.Rules()["literal"]([]byte("{3}\r\nabcd"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"literal\"](in, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "{3}\r\nabc"; got != want {
+		t.Fatalf("g.Rules()[\"literal\"](in, ns) = %q, want %q", got, want)
+	}
+
+	ns.Clear()
+	if err := g.Rules()["literal"]([]byte("{3}\r\nab"), ns); err == nil {
+		t.Fatalf("g.Rules()[\"literal\"](in, ns) error = nil, want %v", abnf.ErrNotMatched)
+	}
+
+	ns.Clear()
+	if err := g.Rules()["chunk"]([]byte("A\r\n0123456789\r\n"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"chunk\"](in, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "A\r\n0123456789\r\n"; got != want {
+		t.Fatalf("g.Rules()[\"chunk\"](in, ns) = %q, want %q", got, want)
+	}
+}
+
+func TestParserGenerator_Octets_Invalid(t *testing.T) {
+	for _, src := range []string{
+		"r = len 1*<octets len>\nlen = 1*%x30-39\n",
+		"r = len [<octets len>]\nlen = 1*%x30-39\n",
+		"r = len (\"a\" / <octets len>)\nlen = 1*%x30-39\n",
+		"r = <octets len>\nlen = 1*%x30-39\n",
+	} {
+		g := &abnf_gen.ParserGenerator{}
+		if _, err := g.ReadFrom(bytes.NewBufferString(src)); err == nil {
+			t.Fatalf("g.ReadFrom(%q) error = nil, want error", src)
+		}
+	}
+}
+
+func TestParserGenerator_FoldByteClasses(t *testing.T) {
+	src := []byte(
+		"hexdig = DIGIT / \"A\" / \"B\" / \"C\" / \"D\" / \"E\" / \"F\"\n" +
+			"DIGIT = %x30-39\n" +
+			"alpha = %x41-5A / %x61-7A\n" +
+			"word = 1*(alpha / \"_\")\n" +
+			"keyword = \"if\" / \"else\"\n",
+	)
+
+	g := &abnf_gen.ParserGenerator{}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+	fg := &abnf_gen.ParserGenerator{FoldByteClasses: true}
+	if _, err := fg.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatalf("fg.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns, fns := abnf.NewNodes(), abnf.NewNodes()
+	defer ns.Free()
+	defer fns.Free()
+
+	for _, c := range []struct {
+		rule, in string
+	}{
+		{"hexdig", "7"},
+		{"hexdig", "b"},
+		{"hexdig", "G"},
+		{"alpha", "q"},
+		{"word", "ab_c1"},
+		{"keyword", "else"},
+	} {
+		ns.Clear()
+		fns.Clear()
+		err := g.Rules()[c.rule]([]byte(c.in), ns)
+		ferr := fg.Rules()[c.rule]([]byte(c.in), fns)
+		if (err == nil) != (ferr == nil) {
+			t.Fatalf("%s(%q) error = %v, folded error = %v", c.rule, c.in, err, ferr)
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := fns.Best().String(), ns.Best().String(); got != want {
+			t.Fatalf("%s(%q) folded = %q, want %q", c.rule, c.in, got, want)
+		}
+	}
+
+	ns.Clear()
+	if err := fg.Rules()["hexdig"]([]byte("a"), ns); err != nil {
+		t.Fatalf("fg.Rules()[\"hexdig\"](in, ns) error = %v, want nil", err)
+	}
+	want := &abnf.Nodes{{Key: "hexdig", Value: []byte("a")}}
+	if !cmp.Equal(ns, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("fg.Rules()[\"hexdig\"](in, ns) = %+v, want %+v", ns, want)
+	}
+}
+
+func TestParserGenerator_RangeKey(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{}
+	if _, err := g.ReadFrom(bytes.NewReader([]byte("DIGIT = %x30-39\r\nnum = 1*%x30-39\r\n"))); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	// a rule consisting of a single range is keyed by the rule name, as in the generated code
+	if err := g.Rules()["DIGIT"]([]byte("7"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"DIGIT\"](in, ns) error = %v, want nil", err)
+	}
+	want := &abnf.Nodes{{Key: "DIGIT", Value: []byte("7")}}
+	if !cmp.Equal(ns, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("g.Rules()[\"DIGIT\"](in, ns) = %+v, want %+v", ns, want)
+	}
+
+	// nested ranges keep their own keys
+	ns.Clear()
+	if err := g.Rules()["num"]([]byte("7"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"num\"](in, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().Children[0].Key, "%x30-39"; got != want {
+		t.Fatalf("g.Rules()[\"num\"](in, ns) child key = %q, want %q", got, want)
+	}
+}
+
+func TestParserGenerator_LiteralSets(t *testing.T) {
+	src := []byte(
+		"method = \"GET\" / \"HEAD\" / %s\"POST\" / \"PUT\" / %x50.41.54.43.48\n" +
+			"request = method \" \" 1*%x21-7E\n",
+	)
+
+	g := &abnf_gen.ParserGenerator{}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+	lg := &abnf_gen.ParserGenerator{LiteralSets: true}
+	if _, err := lg.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatalf("lg.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns, lns := abnf.NewNodes(), abnf.NewNodes()
+	defer ns.Free()
+	defer lns.Free()
+
+	for _, in := range []string{"get /", "post /", "POST /", "patch /", "DELETE /"} {
+		ns.Clear()
+		lns.Clear()
+		err := g.Rules()["request"]([]byte(in), ns)
+		lerr := lg.Rules()["request"]([]byte(in), lns)
+		if (err == nil) != (lerr == nil) {
+			t.Fatalf("request(%q) error = %v, literal sets error = %v", in, err, lerr)
+		}
+		if !cmp.Equal(lns, ns, cmpopts.EquateEmpty()) {
+			t.Fatalf("request(%q) = %+v, want %+v\ndiff (-got +want):\n%v",
+				in, lns, ns,
+				cmp.Diff(lns, ns, cmpopts.EquateEmpty()),
+			)
+		}
+	}
+}
+
+func TestParserGenerator_Predict(t *testing.T) {
+	src, err := os.ReadFile("../abnf_def/rules.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	coreSrc, err := os.ReadFile("../abnf_core/rules.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// core rules are parsed too, references to external rules aren't predicted
+	grammar := append(append([]byte{}, src...), coreSrc...)
+
+	g := &abnf_gen.ParserGenerator{}
+	if _, err := g.ReadFrom(bytes.NewReader(grammar)); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+	pg := &abnf_gen.ParserGenerator{Predict: true}
+	if _, err := pg.ReadFrom(bytes.NewReader(grammar)); err != nil {
+		t.Fatalf("pg.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns, pns := abnf.NewNodes(), abnf.NewNodes()
+	defer ns.Free()
+	defer pns.Free()
+
+	for _, in := range [][]byte{src, coreSrc, []byte("r = %x30-39 / <prose> / 2*(\"a\" [b])\n"), []byte("r = ?\n")} {
+		ns.Clear()
+		pns.Clear()
+		err := g.Rules()["rulelist"](in, ns)
+		perr := pg.Rules()["rulelist"](in, pns)
+		if (err == nil) != (perr == nil) {
+			t.Fatalf("rulelist(%q) error = %v, predicted error = %v", in, err, perr)
+		}
+		if err != nil {
+			continue
+		}
+		if pns.Len() != ns.Len() {
+			t.Fatalf("rulelist(%q) returned %d nodes, want %d", in, pns.Len(), ns.Len())
+		}
+		for i := range ns.Len() {
+			got, want := abnf.NewTree(in, (*pns)[i]).Root(), abnf.NewTree(in, (*ns)[i]).Root()
+			if !equalTrees(got, want) {
+				t.Fatalf("rulelist(%q) node %d differs from unpredicted one", in, i)
+			}
+		}
+	}
+}
+
+func equalTrees(a, b abnf.Cursor) bool {
+	if a.Key() != b.Key() || a.Pos() != b.Pos() || a.End() != b.End() {
+		return false
+	}
+	ac, bc := a.FirstChild(), b.FirstChild()
+	for ; ac.Valid() && bc.Valid(); ac, bc = ac.NextSibling(), bc.NextSibling() {
+		if !equalTrees(ac, bc) {
+			return false
+		}
+	}
+	return ac.Valid() == bc.Valid()
+}
+
+func TestParserGenerator_EngineVM(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{
+		External: map[string]abnf_gen.ExternalRule{
+			"DIGITS": {Operator: abnf.Repeat1Inf("DIGITS", abnf_core.Operators().DIGIT)},
+		},
+		Engine: abnf_gen.EngineVM,
+	}
+	src := bytes.NewBuffer([]byte(
+		"r1 = *\"a\" \"a\"\n" +
+			"r2 = *\"a\" \"a\" ; @possessive\n" +
+			"r3 = *\"a\" ; @lazy\n" +
+			"r4 = s1 \"b\" / s1 \"c\"\n" +
+			"r5 = DIGITS \"0\"\n" +
+			"s1 = 1*\"a\"\n",
+	))
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	for _, c := range []struct {
+		rule, in, want string
+		wantErr        bool
+	}{
+		{rule: "r1", in: "aaa", want: "aaa"},
+		{rule: "r2", in: "aaa", wantErr: true},
+		{rule: "r3", in: "aaa", want: ""},
+		{rule: "r4", in: "aacd", want: "aac"},
+		{rule: "r5", in: "1200", want: "1200"},
+	} {
+		ns.Clear()
+		err := g.Rules()[c.rule]([]byte(c.in), ns)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("%s(%q) error = nil, want error", c.rule, c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s(%q) error = %v, want nil", c.rule, c.in, err)
+		}
+		if got := ns.Best().String(); got != c.want {
+			t.Fatalf("%s(%q) = %q, want %q", c.rule, c.in, got, c.want)
+		}
+	}
+
+	ns.Clear()
+	if err := g.Rules()["r4"]([]byte("aab"), ns); err != nil {
+		t.Fatalf("r4(in) error = %v, want nil", err)
+	}
+	want := &abnf.Nodes{
+		{
+			Key:   "r4",
+			Value: []byte("aab"),
+			Children: abnf.Nodes{
+				{Key: "s1", Value: []byte("aa")},
+			},
+		},
+	}
+	if !cmp.Equal(ns, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("r4(in) = %+v, want %+v\ndiff (-got +want):\n%v",
+			ns, want,
+			cmp.Diff(ns, want, cmpopts.EquateEmpty()),
+		)
+	}
+}
+
+// TestParserGenerator_EngineVM_Closure checks that both engines match the same inputs entirely
+// with the same rule-level trees. The VM engine always folds byte classes and keeps only rule nodes.
+func TestParserGenerator_EngineVM_Closure(t *testing.T) {
+	defSrc, err := os.ReadFile("../abnf_def/rules.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	coreSrc, err := os.ReadFile("../abnf_core/rules.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name, grammar, rule string
+		ins                 []string
+	}{
+		{
+			name:    "abnf",
+			grammar: string(defSrc) + string(coreSrc),
+			rule:    "rulelist",
+			ins: []string{
+				string(defSrc),
+				string(coreSrc),
+				"r = %x30-39 / <prose> / 2*(\"a\" [b]) ; comment\n",
+				"R =/ %s\"Ab\" %d13.10 %b1-11\n",
+				"r = ?\n",
+			},
+		},
+		{
+			name:    "literals",
+			grammar: "r = %xCF.82 / %xFF \"k\" / \"ab\" / %s\"Cd\"\n",
+			rule:    "r",
+			ins:     []string{"\u03c2", "\u03c3", "\u03a3", "\xffK", "\xfek", "\xef\xbf\xbdK", "AB", "aB", "Cd", "cd"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			g := &abnf_gen.ParserGenerator{FoldByteClasses: true, Prune: true}
+			vg := &abnf_gen.ParserGenerator{Engine: abnf_gen.EngineVM}
+			for _, g := range []*abnf_gen.ParserGenerator{g, vg} {
+				if _, err := g.ReadFrom(bytes.NewBufferString(c.grammar)); err != nil {
+					t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+				}
+			}
+			ns, vns := abnf.NewNodes(), abnf.NewNodes()
+			defer ns.Free()
+			defer vns.Free()
+
+			for _, in := range c.ins {
+				ns.Clear()
+				vns.Clear()
+				var want, got *abnf.Node
+				if err := g.Rules()[c.rule]([]byte(in), ns); err == nil {
+					for _, n := range ns.All() {
+						if n.Len() == len(in) {
+							want = n
+							break
+						}
+					}
+				}
+				if err := vg.Rules()[c.rule]([]byte(in), vns); err == nil && vns.Best().Len() == len(in) {
+					got = vns.Best()
+				}
+				if (got != nil) != (want != nil) {
+					t.Fatalf("%s(%q) vm matched = %v, closure matched = %v", c.rule, in, got != nil, want != nil)
+				}
+				if got != nil && !equalTrees(abnf.NewTree([]byte(in), got).Root(), abnf.NewTree([]byte(in), want).Root()) {
+					t.Fatalf("%s(%q) vm tree differs from closure one", c.rule, in)
+				}
+			}
+		})
+	}
+
+	g := &abnf_gen.ParserGenerator{}
+	if _, err := g.ReadFrom(bytes.NewBufferString("r = %x100-10FFFF\n")); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+	if _, err := g.Program(); err == nil {
+		t.Fatal("g.Program() error = nil, want error")
+	}
+}
+
+func TestParserGenerator_Program(t *testing.T) {
+	src, err := os.ReadFile("../abnf_def/rules.abnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ext := make(map[string]abnf_gen.ExternalRule)
+	extOps := make(map[string]abnf.Operator)
+	for n, op := range abnf_core.OperatorsMap() {
+		ext[n] = abnf_gen.ExternalRule{Operator: op}
+		extOps[n] = op
+	}
+
+	g := &abnf_gen.ParserGenerator{External: ext}
+	if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	prog, err := g.Program()
+	if err != nil {
+		t.Fatalf("g.Program() error = %v, want nil", err)
+	}
+	data, err := prog.MarshalBinary()
+	if err != nil {
+		t.Fatalf("prog.MarshalBinary() error = %v, want nil", err)
+	}
+	prog, err = abnf_vm.Load(data, extOps)
+	if err != nil {
+		t.Fatalf("abnf_vm.Load(data, ext) error = %v, want nil", err)
+	}
+
+	ns, vns := abnf.NewNodes(), abnf.NewNodes()
+	defer ns.Free()
+	defer vns.Free()
+
+	if err := g.Rules()["rulelist"](src, ns); err != nil {
+		t.Fatalf("rulelist(src) error = %v, want nil", err)
+	}
+	if err := prog.Operator("rulelist")(nil, src, 0, vns); err != nil {
+		t.Fatalf("vm rulelist(src) error = %v, want nil", err)
+	}
+	if got, want := vns.Best().Len(), len(src); got != want {
+		t.Fatalf("vm rulelist(src) matched %d octets, want %d", got, want)
+	}
+
+	// rule-level structure is the same
+	for _, key := range []string{"rule", "rulename", "elements", "comment"} {
+		var got, want []string
+		for _, n := range vns.Best().GetNodes(key) {
+			got = append(got, n.String())
+		}
+		for _, n := range ns.Best().GetNodes(key) {
+			want = append(want, n.String())
+		}
+		if !cmp.Equal(got, want) {
+			t.Fatalf("vm rulelist(src) %q nodes = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestParserGenerator_PEG(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{PEG: true, LiteralSets: true}
+	src := bytes.NewBuffer([]byte(
+		"r1 = \"a\" / \"ab\"\n" +
+			"r2 = *\"a\" \"a\"\n" +
+			"r3 = s1 \"b\" / s1 \"c\"\n" +
+			"r4 = *(\"a\" / \"ab\") [\"b\"]\n" +
+			"s1 = 1*\"a\"\n",
+	))
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	for _, c := range []struct {
+		rule, in, want string
+		wantErr        bool
+	}{
+		{rule: "r1", in: "ab", want: "a"},
+		{rule: "r2", in: "aaa", wantErr: true},
+		{rule: "r3", in: "aac", want: "aac"},
+		{rule: "r4", in: "aabb", want: "aab"},
+	} {
+		ns.Clear()
+		err := abnf.Parse(g.Operators()[c.rule], []byte(c.in), ns, abnf.WithMemo())
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("%s(%q) error = nil, want error", c.rule, c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s(%q) error = %v, want nil", c.rule, c.in, err)
+		}
+		if ns.Len() != 1 {
+			t.Fatalf("%s(%q) returned %d nodes, want 1", c.rule, c.in, ns.Len())
+		}
+		if got := ns.Best().String(); got != c.want {
+			t.Fatalf("%s(%q) = %q, want %q", c.rule, c.in, got, c.want)
+		}
+	}
+}
+
+func TestParserGenerator_PEG_Rules(t *testing.T) {
+	var calls int
+	a := abnf.Literal(`"a"`, []byte("a"))
+	g := &abnf_gen.ParserGenerator{
+		PEG: true,
+		External: map[string]abnf_gen.ExternalRule{
+			"x": {
+				Operator: func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+					calls++
+					return a(ctx, in, pos, ns)
+				},
+			},
+		},
+	}
+	src := bytes.NewBuffer([]byte(
+		"r = s \"b\" / s \"c\"\n" +
+			"s = x\n",
+	))
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	// s is parsed once at position 0, the second alternative takes the memoized match
+	if err := g.Rules()["r"]([]byte("ac"), ns); err != nil {
+		t.Fatalf("g.Rules()[\"r\"](in, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "ac"; got != want {
+		t.Fatalf("g.Rules()[\"r\"](in, ns) = %q, want %q", got, want)
+	}
+	if calls != 1 {
+		t.Fatalf("x invoked %d times, want 1", calls)
+	}
+}
+
+func TestParserGenerator_Searcher(t *testing.T) {
+	digit := abnf.NewByteSet()
+	digit.AddRange('0', '9')
+	g := &abnf_gen.ParserGenerator{
+		External: map[string]abnf_gen.ExternalRule{
+			"DIGIT": {Operator: abnf_core.Operators().DIGIT, First: &digit},
+			"ALPHA": {Operator: abnf_core.Operators().ALPHA},
+		},
+	}
+	src := bytes.NewBuffer([]byte(
+		"port = \":\" 1*DIGIT\n" +
+			"name = ALPHA *(ALPHA / DIGIT)\n" +
+			"host = label *(\".\" label)\n",
+	))
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	if got, ok := g.First("port"); !ok || got != abnf.NewByteSet(':') {
+		t.Fatalf("g.First(\"port\") = %v, %v, want {':'}, true", got, ok)
+	}
+	if _, ok := g.First("name"); ok {
+		t.Fatal("g.First(\"name\") = _, true, want _, false")
+	}
+	// label is undefined, so host can't be predicted
+	if _, ok := g.First("host"); ok {
+		t.Fatal("g.First(\"host\") = _, true, want _, false")
+	}
+	if g.Searcher("unknown") != nil {
+		t.Fatal("g.Searcher(\"unknown\") = not nil, want nil")
+	}
+
+	var got []string
+	for _, n := range g.Searcher("port").FindAll([]byte("a:5060 b: c:80"), -1) {
+		got = append(got, n.String())
+	}
+	if want := []string{":5060", ":80"}; !cmp.Equal(got, want) {
+		t.Fatalf("FindAll(in, -1) = %q, want %q", got, want)
+	}
+}
+
+func TestParserGenerator_LiteralKeys(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{}
+	src := bytes.NewBuffer([]byte(
+		"r = m \"/\" v\n" +
+			"m = \"INVITE\"\n" +
+			"v = %s\"SIP\" / \"x\"\n" +
+			"a = \"Y\" ; @atomic\n",
+	))
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	keys := g.LiteralKeys()
+	if want := []string{`"/"`, `"Y"`, `"x"`, "m"}; !cmp.Equal(keys, want) {
+		t.Fatalf("g.LiteralKeys() = %q, want %q", keys, want)
+	}
+
+	cn := abnf.NewCanonicalizer()
+	cn.FoldLiterals(keys...)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"INVITE/x", "invite/x"},
+		{"invite/X", "invite/x"},
+		{"Invite/SIP", "invite/SIP"},
+	} {
+		ns.Clear()
+		if err := g.Rules()["r"]([]byte(c.in), ns); err != nil {
+			t.Fatalf("r(%q) error = %v, want nil", c.in, err)
+		}
+		if got := string(cn.Canonical(ns.Best())); got != c.want {
+			t.Errorf("cn.Canonical(r(%q)) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParserGenerator_Grammar(t *testing.T) {
+	g := &abnf_gen.ParserGenerator{
+		External: map[string]abnf_gen.ExternalRule{
+			"DIGIT": {Operator: abnf_core.Operators().DIGIT},
+		},
+	}
+	src := bytes.NewBuffer([]byte(
+		"expr = expr op expr / num\n" +
+			"op   = \"+\" / %x2A\n" +
+			"num  = 1*DIGIT / %x2D-2D 1*DIGIT\n",
+	))
+	if _, err := g.ReadFrom(src); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+
+	gr, err := g.Grammar()
+	if err != nil {
+		t.Fatalf("g.Grammar() error = %v, want nil", err)
+	}
+	f, err := gr.Parse("expr", []byte("1+-2*3+4"))
+	if err != nil {
+		t.Fatalf("gr.Parse(\"expr\", in) error = %v, want nil", err)
+	}
+	if got, want := f.Count(), uint64(5); got != want {
+		t.Fatalf("f.Count() = %d, want %d", got, want)
+	}
+	for n := range f.Trees() {
+		if got, want := len(n.GetNodes("num")), 4; got != want {
+			t.Fatalf("len(n.GetNodes(\"num\")) = %d, want %d", got, want)
+		}
+	}
+
+	for _, c := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"1", []string{`"*"`, `"+"`, "DIGIT", "op"}},
+		{"1+-", []string{"DIGIT"}},
+	} {
+		ss, err := gr.Complete("expr", []byte(c.prefix))
+		if err != nil {
+			t.Fatalf("gr.Complete(\"expr\", %q) error = %v, want nil", c.prefix, err)
+		}
+		var got []string
+		for _, s := range ss {
+			got = append(got, s.String())
+		}
+		if !cmp.Equal(got, c.want) {
+			t.Fatalf("gr.Complete(\"expr\", %q) = %q, want %q", c.prefix, got, c.want)
+		}
+	}
+
+	g = &abnf_gen.ParserGenerator{}
+	if _, err := g.ReadFrom(bytes.NewBufferString("r1 = len <octets len>\nlen = 1*%x30-39\n")); err != nil {
+		t.Fatalf("g.ReadFrom(src) error = %v, want nil", err)
+	}
+	if _, err := g.Grammar(); err == nil {
+		t.Fatal("g.Grammar() error = nil, want error")
+	}
+}
+
+func BenchmarkParserGenerator_Engine(b *testing.B) {
+	src, err := os.ReadFile("../abnf_def/rules.abnf")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ext := make(map[string]abnf_gen.ExternalRule)
+	for n, op := range abnf_core.OperatorsMap() {
+		ext[n] = abnf_gen.ExternalRule{Operator: op}
+	}
+
+	for _, e := range []struct {
+		name   string
+		engine abnf_gen.Engine
+	}{
+		{"closure", abnf_gen.EngineClosure},
+		{"vm", abnf_gen.EngineVM},
+	} {
+		b.Run(e.name, func(b *testing.B) {
+			g := &abnf_gen.ParserGenerator{External: ext, Engine: e.engine}
+			if _, err := g.ReadFrom(bytes.NewReader(src)); err != nil {
+				b.Fatal(err)
+			}
+			rule := g.Rules()["rulelist"]
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for b.Loop() {
+				ns := abnf.NewNodes()
+				if err := rule(src, ns); err != nil {
+					b.Fatal(err)
+				}
+				ns.Free()
+			}
+		})
+	}
+}
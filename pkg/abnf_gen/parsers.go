@@ -7,6 +7,7 @@ import (
 	"math"
 	"math/bits"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -50,9 +51,52 @@ func (p *rulesParser) ReadFrom(src io.Reader) (int64, error) {
 }
 
 type rule struct {
-	name   string
-	oprt   operator
-	extend bool
+	name    string
+	oprt    operator
+	extend  bool
+	pragmas pragmas
+}
+
+// pragmas is a set of dialect annotations of a rule.
+//
+// Annotations are written in rule comments as words prefixed with "@",
+// either inline or on comment lines directly preceding the rule:
+//
+//	; @possessive
+//	header-value = *(VCHAR / WSP) ; @atomic
+type pragmas uint
+
+const (
+	// pragmaPossessive makes rule repetitions and options possessive.
+	pragmaPossessive pragmas = 1 << iota
+	// pragmaLazy makes rule repetitions and options non-greedy.
+	pragmaLazy
+	// pragmaAtomic makes the rule an atomic group.
+	pragmaAtomic
+)
+
+var pragmaNames = map[string]pragmas{
+	"possessive": pragmaPossessive,
+	"lazy":       pragmaLazy,
+	"atomic":     pragmaAtomic,
+}
+
+func (p pragmas) has(v pragmas) bool { return p&v != 0 }
+
+var pragmaRegex = regexp.MustCompile(`(?:^|[;\s])@([a-z][a-z0-9-]*)`)
+
+func parsePragmas(n *abnf.Node) (pragmas, error) {
+	var p pragmas
+	for _, cn := range n.GetNodes("comment") {
+		for _, m := range pragmaRegex.FindAllSubmatch(cn.Value, -1) {
+			v, ok := pragmaNames[string(m[1])]
+			if !ok {
+				return 0, fmt.Errorf("unknown annotation '@%s' at position %d", m[1], cn.Pos)
+			}
+			p |= v
+		}
+	}
+	return p, nil
 }
 
 func (r rule) pubName() string {
@@ -131,6 +175,8 @@ type operator interface {
 
 	operatorBuilder
 	statementBuilder
+	programCompiler
+	grammarCompiler
 }
 
 type altOperator struct {
@@ -173,7 +219,35 @@ type charValOperator struct {
 	cs  bool
 }
 
-func (op charValOperator) key() string { return fmt.Sprintf("%q", op.val) }
+// key returns the quoted value, case-sensitive literals are prefixed with "%s" as in the grammar,
+// so keys of case-insensitive literals always start with a double quote.
+func (op charValOperator) key() string {
+	if op.cs {
+		return fmt.Sprintf("%%s%q", op.val)
+	}
+	return fmt.Sprintf("%q", op.val)
+}
+
+// octetsOperator matches exactly N octets where N is bound by the enclosing bindOperator.
+type octetsOperator struct {
+	k    string
+	name string
+	hex  bool
+}
+
+func (op octetsOperator) key() string { return op.k }
+
+// bindOperator binds the match of oprt to the number of octets matched by octets elements of rest.
+type bindOperator struct {
+	k       string
+	oprt    operator
+	name    string
+	hex     bool
+	restKey string
+	rest    []operator
+}
+
+func (op bindOperator) key() string { return op.k }
 
 type numValOperator struct {
 	k       string
@@ -226,7 +300,17 @@ const (
 	hexNum
 )
 
-func parseRules(s []byte) (map[string]rule, error) {
+func parseRules(s []byte) (rules map[string]rule, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if e, ok := v.(error); ok {
+				err = fmt.Errorf("parse rules: %w", e)
+				return
+			}
+			panic(v)
+		}
+	}()
+
 	ns := abnf.NewNodes()
 	defer ns.Free()
 	if err := abnf_def.Rules().Rulelist(s, ns); err != nil {
@@ -236,14 +320,23 @@ func parseRules(s []byte) (map[string]rule, error) {
 	if n.Len() < len(s) {
 		return nil, fmt.Errorf("source isn't fully consumed, best match length %d != source length %d", n.Len(), len(s))
 	}
-	return parseRuleslistNode(n), nil
+	if rules, err = parseRuleslistNode(n); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	return rules, nil
 }
 
-func parseRuleslistNode(n *abnf.Node) map[string]rule {
+func parseRuleslistNode(n *abnf.Node) (map[string]rule, error) {
 	rules := make(map[string]rule)
+	var pending pragmas
 	for _, n := range n.Children {
-		if n, ok := n.GetNode("rule"); ok {
-			newRule := parseRuleNode(n)
+		if rn, ok := n.GetNode("rule"); ok {
+			newRule, err := parseRuleNode(rn)
+			if err != nil {
+				return nil, err
+			}
+			newRule.pragmas |= pending
+			pending = 0
 			if foundRule, ok := rules[newRule.name]; ok && newRule.extend {
 				newRule = mergeRules(newRule.name, foundRule, newRule)
 			}
@@ -254,9 +347,18 @@ func parseRuleslistNode(n *abnf.Node) map[string]rule {
 				}
 			}
 			rules[newRule.name] = newRule
+		} else if n.Contains("comment") {
+			// comment lines directly preceding the rule
+			p, err := parsePragmas(n)
+			if err != nil {
+				return nil, err
+			}
+			pending |= p
+		} else {
+			pending = 0
 		}
 	}
-	return rules
+	return rules, nil
 }
 
 func mergeRules(n string, r1, r2 rule) rule {
@@ -279,17 +381,23 @@ func mergeRules(n string, r1, r2 rule) rule {
 	}
 
 	return rule{
-		name: n,
-		oprt: op,
+		name:    n,
+		oprt:    op,
+		pragmas: r1.pragmas | r2.pragmas,
 	}
 }
 
-func parseRuleNode(n *abnf.Node) rule {
-	return rule{
-		name:   mustGetNode(n, "rulename").String(),
-		oprt:   parseAlternationNode(mustGetNode(n, "alternation")),
-		extend: n.Contains("\"=/\""),
+func parseRuleNode(n *abnf.Node) (rule, error) {
+	p, err := parsePragmas(n)
+	if err != nil {
+		return rule{}, err
 	}
+	return rule{
+		name:    mustGetNode(n, "rulename").String(),
+		oprt:    parseAlternationNode(mustGetNode(n, "alternation")),
+		extend:  n.Contains("\"=/\""),
+		pragmas: p,
+	}, nil
 }
 
 func parseAlternationNode(n *abnf.Node) operator {
@@ -318,10 +426,69 @@ func parseConcatenationNode(n *abnf.Node) operator {
 			ops = append(ops, parseRepetitionNode(n))
 		}
 	}
-	if len(ops) == 1 {
-		return ops[0]
+	return bindConcat(fmtNodeValue(n), ops)
+}
+
+// bindConcat creates a concatenation of ops.
+// If ops contain an octets element, the concatenation is split at its count element
+// into a plain concatenation and a binding of the count element to the rest elements.
+func bindConcat(k string, ops []operator) operator {
+	var (
+		bop   *bindOperator
+		start int
+	)
+	for i, op := range ops {
+		oo, ok := op.(octetsOperator)
+		if !ok {
+			continue
+		}
+
+		if bop != nil {
+			if oo.name != bop.name {
+				panic(fmt.Errorf("multiple counted fields in concatenation '%s' aren't supported, use groups", k))
+			}
+			continue
+		}
+
+		j := slices.IndexFunc(ops[:i], func(op operator) bool {
+			_, ok := op.(ruleNameOperator)
+			return ok && op.key() == oo.name
+		})
+		if j < 0 {
+			panic(fmt.Errorf("count element '%s' of '%s' not found in concatenation '%s'", oo.name, oo.k, k))
+		}
+
+		bop = &bindOperator{
+			k:       joinKeys(ops[j:]),
+			oprt:    ops[j],
+			name:    oo.name,
+			hex:     oo.hex,
+			restKey: joinKeys(ops[j+1:]),
+			rest:    ops[j+1:],
+		}
+		start = j + 1
+	}
+
+	if bop == nil {
+		if len(ops) == 1 {
+			return ops[0]
+		}
+		return concatOperator{k, ops}
 	}
-	return concatOperator{fmtNodeValue(n), ops}
+
+	if start == 1 {
+		bop.k = k
+		return *bop
+	}
+	return concatOperator{k, append(ops[:start-1:start-1], *bop)}
+}
+
+func joinKeys(ops []operator) string {
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.key()
+	}
+	return strings.Join(keys, " ")
 }
 
 func parseRepetitionNode(n *abnf.Node) operator {
@@ -329,11 +496,11 @@ func parseRepetitionNode(n *abnf.Node) operator {
 		return parseElementNode(mustGetNode(n, "element"))
 	}
 	v1, v2 := parseRepeatNode(mustGetNode(n, "repeat"))
-	return repeatOperator{
-		fmtNodeValue(n),
-		parseElementNode(mustGetNode(n, "element")),
-		v1, v2,
+	elem := parseElementNode(mustGetNode(n, "element"))
+	if _, ok := elem.(octetsOperator); ok {
+		panic(fmt.Errorf("octets element '%s' can't be repeated, it must follow its count element in the same concatenation", elem.key()))
 	}
+	return repeatOperator{fmtNodeValue(n), elem, v1, v2}
 }
 
 func parseRepeatNode(n *abnf.Node) (min, max uint) {
@@ -431,8 +598,21 @@ func parseNumValNode(n *abnf.Node) operator {
 	return numValOperator{fmtNodeValue(n), typ, vals, isRange}
 }
 
-func parseProseValNode(_ *abnf.Node) operator {
-	panic("prose-val isn't supported")
+// parseProseValNode parses prose values of the dialect:
+//
+//	<octets name>      exactly N octets where N is the decimal value of the preceding element name
+//	<octets name hex>  exactly N octets where N is the hexadecimal value of the preceding element name
+func parseProseValNode(n *abnf.Node) operator {
+	fields := strings.Fields(strings.Trim(n.String(), "<>"))
+	if len(fields) >= 2 && fields[0] == "octets" &&
+		(len(fields) == 2 || len(fields) == 3 && fields[2] == "hex") {
+		return octetsOperator{
+			k:    fmtNodeValue(n),
+			name: fields[1],
+			hex:  len(fields) == 3,
+		}
+	}
+	panic(fmt.Errorf("prose-val '%s' isn't supported", n.String()))
 }
 
 var spRegex = regexp.MustCompile(`\s+`)
@@ -0,0 +1,205 @@
+package abnf_gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_vm"
+)
+
+// Engine is an execution engine of generated parsers.
+type Engine uint8
+
+const (
+	// EngineClosure generates parsers as nested operator closures that return all matches.
+	EngineClosure Engine = iota
+	// EngineVM compiles parsers into an [abnf_vm.Program] that returns the first match:
+	// alternatives are tried in the declaration order and repetitions are greedy.
+	// For grammars with several matches of the input it may differ from the match preferred by
+	// the parse [abnf.Policy] of [EngineClosure], e.g. a shorter first alternative wins.
+	// Grammars with counted fields or ranges of multi-octet values can't be compiled.
+	EngineVM
+)
+
+type programCompiler interface {
+	compile(c *vmCompiler)
+}
+
+type vmCompiler struct {
+	b       *abnf_vm.Builder
+	rules   map[string]rule
+	ext     map[string]ExternalRule
+	pragmas pragmas
+}
+
+// compileProgram compiles rules into a program builder.
+func compileProgram(rules map[string]rule, ext map[string]ExternalRule) (b *abnf_vm.Builder, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if e, ok := v.(error); ok {
+				err = fmt.Errorf("compile program: %w", e)
+				return
+			}
+			panic(v)
+		}
+	}()
+
+	c := &vmCompiler{
+		b:     abnf_vm.NewBuilder(),
+		rules: rules,
+		ext:   ext,
+	}
+
+	names := make([]string, 0, len(rules))
+	for n := range rules {
+		if _, ok := ext[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		rules[n].compile(c)
+	}
+
+	return c.b, nil
+}
+
+func (r rule) compile(c *vmCompiler) {
+	c.pragmas = r.pragmas
+	c.b.Rule(r.name)
+	if r.pragmas.has(pragmaAtomic) {
+		c.b.Emit(abnf_vm.OpAtomic, 0, 0)
+		r.oprt.compile(c)
+		c.b.Emit(abnf_vm.OpCommit, 0, 0)
+	} else {
+		r.oprt.compile(c)
+	}
+	c.b.Emit(abnf_vm.OpReturn, 0, 0)
+}
+
+func (op altOperator) compile(c *vmCompiler) {
+	if set, ok := foldByteClass(op, c.rules, c.ext); ok {
+		c.b.Emit(abnf_vm.OpByte, c.b.Set(set), 0)
+		return
+	}
+
+	var jumps []uint32
+	for i, o := range op.oprts {
+		if i == len(op.oprts)-1 {
+			o.compile(c)
+			break
+		}
+		split := c.b.Emit(abnf_vm.OpSplit, 0, 0)
+		o.compile(c)
+		jumps = append(jumps, c.b.Emit(abnf_vm.OpJump, 0, 0))
+		c.b.Patch(split, split+1, c.b.PC())
+	}
+	for _, pc := range jumps {
+		c.b.Patch(pc, c.b.PC(), 0)
+	}
+}
+
+func (op concatOperator) compile(c *vmCompiler) {
+	for _, o := range op.oprts {
+		o.compile(c)
+	}
+}
+
+func (op repeatOperator) compile(c *vmCompiler) {
+	compileRepeat(c, op.min, op.max, op.oprt)
+}
+
+func (op optionOperator) compile(c *vmCompiler) {
+	compileRepeat(c, 0, 1, op.oprt)
+}
+
+// compileRepeat compiles min mandatory copies of op followed by optional ones,
+// up to max copies or unlimited if max is 0.
+func compileRepeat(c *vmCompiler, min, max uint, op operator) {
+	possessive := c.pragmas.has(pragmaPossessive)
+	if possessive {
+		c.b.Emit(abnf_vm.OpAtomic, 0, 0)
+	}
+
+	for range min {
+		op.compile(c)
+	}
+
+	// split prefers the next copy, unless the repetition is lazy
+	split := func(pc uint32) {
+		next, exit := pc+1, c.b.PC()
+		if c.pragmas.has(pragmaLazy) {
+			next, exit = exit, next
+		}
+		c.b.Patch(pc, next, exit)
+	}
+
+	if max == 0 {
+		loop := c.b.Emit(abnf_vm.OpSplit, 0, 0)
+		c.b.Emit(abnf_vm.OpMark, 0, 0)
+		op.compile(c)
+		c.b.Emit(abnf_vm.OpCheck, 0, 0)
+		c.b.Emit(abnf_vm.OpJump, loop, 0)
+		split(loop)
+	} else if max > min {
+		splits := make([]uint32, 0, max-min)
+		for range max - min {
+			splits = append(splits, c.b.Emit(abnf_vm.OpSplit, 0, 0))
+			op.compile(c)
+		}
+		for _, pc := range splits {
+			split(pc)
+		}
+	}
+
+	if possessive {
+		c.b.Emit(abnf_vm.OpCommit, 0, 0)
+	}
+}
+
+func (op ruleNameOperator) compile(c *vmCompiler) {
+	if _, ok := c.ext[op.key()]; ok {
+		c.b.Extern(op.key())
+		return
+	}
+	if _, ok := c.rules[op.key()]; !ok {
+		panic(fmt.Errorf("unknown ABNF rule '%s'", op.key()))
+	}
+	c.b.Call(op.key())
+}
+
+func (op charValOperator) compile(c *vmCompiler) {
+	if len(op.val) == 0 {
+		return
+	}
+	code := abnf_vm.OpLiteral
+	if op.cs {
+		code = abnf_vm.OpLiteralCS
+	}
+	c.b.Emit(code, c.b.Literal([]byte(op.val)), 0)
+}
+
+func (op numValOperator) compile(c *vmCompiler) {
+	vals := op.byteVals()
+	if op.isRange {
+		if len(vals[0]) == 1 && len(vals[1]) == 1 {
+			var set abnf.ByteSet
+			set.AddRange(vals[0][0], vals[1][0])
+			c.b.Emit(abnf_vm.OpByte, c.b.Set(set), 0)
+			return
+		}
+		// abnf.Range matches multi-octet values differently from abnf_vm.OpRange
+		panic(fmt.Errorf("range '%s' of multi-octet values isn't supported by the VM engine", op.key()))
+	}
+	c.b.Emit(abnf_vm.OpLiteral, c.b.Literal(bytes.Join(vals, nil)), 0)
+}
+
+func (op bindOperator) compile(*vmCompiler) {
+	panic(fmt.Errorf("counted field '%s' isn't supported by the VM engine", op.key()))
+}
+
+func (op octetsOperator) compile(*vmCompiler) {
+	panic(fmt.Errorf("counted field '%s' isn't supported by the VM engine", op.key()))
+}
@@ -0,0 +1,142 @@
+package abnf_vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// Builder assembles a [Program].
+type Builder struct {
+	prog    Program
+	sets    map[abnf.ByteSet]uint32
+	lits    map[string]uint32
+	rules   map[string]uint32
+	externs map[string]uint32
+	defined map[string]bool
+}
+
+// NewBuilder creates a new program builder.
+func NewBuilder() *Builder {
+	return &Builder{
+		sets:    make(map[abnf.ByteSet]uint32),
+		lits:    make(map[string]uint32),
+		rules:   make(map[string]uint32),
+		externs: make(map[string]uint32),
+		defined: make(map[string]bool),
+	}
+}
+
+// PC returns the address of the next instruction.
+func (b *Builder) PC() uint32 { return uint32(len(b.prog.Code)) }
+
+// Emit appends an instruction and returns its address.
+func (b *Builder) Emit(op Opcode, a, bb uint32) uint32 {
+	b.prog.Code = append(b.prog.Code, Instruction{op, a, bb})
+	return b.PC() - 1
+}
+
+// Patch sets operands of the instruction at pc.
+func (b *Builder) Patch(pc, a, bb uint32) {
+	b.prog.Code[pc].A, b.prog.Code[pc].B = a, bb
+}
+
+// Set returns an index of the byte set, adding it if necessary.
+func (b *Builder) Set(s abnf.ByteSet) uint32 {
+	if i, ok := b.sets[s]; ok {
+		return i
+	}
+	i := uint32(len(b.prog.Sets))
+	b.prog.Sets = append(b.prog.Sets, s)
+	b.sets[s] = i
+	return i
+}
+
+// Literal returns an index of the literal, adding it if necessary.
+func (b *Builder) Literal(v []byte) uint32 {
+	if i, ok := b.lits[string(v)]; ok {
+		return i
+	}
+	i := uint32(len(b.prog.Lits))
+	b.prog.Lits = append(b.prog.Lits, v)
+	b.lits[string(v)] = i
+	return i
+}
+
+func (b *Builder) rule(name string) uint32 {
+	if i, ok := b.rules[name]; ok {
+		return i
+	}
+	i := uint32(len(b.prog.Rules))
+	b.prog.Rules = append(b.prog.Rules, Rule{Name: name})
+	b.rules[name] = i
+	return i
+}
+
+// Rule starts the body of the rule name at the current address.
+// The body must end with [OpReturn].
+func (b *Builder) Rule(name string) {
+	b.prog.Rules[b.rule(name)].Entry = b.PC()
+	b.defined[name] = true
+}
+
+// Call emits a call of the rule name, the rule may be defined later.
+func (b *Builder) Call(name string) uint32 {
+	return b.Emit(OpCall, b.rule(name), 0)
+}
+
+// Extern emits a match of the external operator name, see [Build].
+func (b *Builder) Extern(name string) uint32 {
+	i, ok := b.externs[name]
+	if !ok {
+		i = uint32(len(b.prog.Externs))
+		b.prog.Externs = append(b.prog.Externs, name)
+		b.externs[name] = i
+	}
+	return b.Emit(OpExtern, i, 0)
+}
+
+// Externs returns names of external operators used by the program.
+func (b *Builder) Externs() []string { return b.prog.Externs }
+
+// Build returns the assembled program with external operators bound from ext.
+func (b *Builder) Build(ext map[string]abnf.Operator) (*Program, error) {
+	p, err := b.program()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.bind(ext); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MarshalBinary encodes the assembled program, external operators are bound by [Load].
+func (b *Builder) MarshalBinary() ([]byte, error) {
+	p, err := b.program()
+	if err != nil {
+		return nil, err
+	}
+	return p.MarshalBinary()
+}
+
+func (b *Builder) program() (*Program, error) {
+	var errs []error
+	for _, r := range b.prog.Rules {
+		if !b.defined[r.Name] {
+			errs = append(errs, fmt.Errorf("rule '%s' isn't defined", r.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &Program{
+		Code:    b.prog.Code,
+		Sets:    b.prog.Sets,
+		Lits:    b.prog.Lits,
+		Rules:   b.prog.Rules,
+		Externs: b.prog.Externs,
+	}, nil
+}
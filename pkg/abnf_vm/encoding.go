@@ -0,0 +1,184 @@
+package abnf_vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ghettovoice/abnf"
+)
+
+const (
+	magic   = "ABVM"
+	version = 1
+)
+
+var errCorrupted = errors.New("corrupted program")
+
+// MarshalBinary encodes the program into a compact binary form, see [Load].
+func (p *Program) MarshalBinary() ([]byte, error) {
+	buf := append(make([]byte, 0, 64+len(p.Code)*4), magic...)
+	buf = append(buf, version)
+
+	buf = binary.AppendUvarint(buf, uint64(len(p.Code)))
+	for _, ins := range p.Code {
+		buf = append(buf, byte(ins.Op))
+		buf = binary.AppendUvarint(buf, uint64(ins.A))
+		buf = binary.AppendUvarint(buf, uint64(ins.B))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(p.Sets)))
+	for _, s := range p.Sets {
+		for _, w := range s {
+			buf = binary.LittleEndian.AppendUint64(buf, w)
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(p.Lits)))
+	for _, l := range p.Lits {
+		buf = appendBytes(buf, l)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(p.Rules)))
+	for _, r := range p.Rules {
+		buf = appendBytes(buf, []byte(r.Name))
+		buf = binary.AppendUvarint(buf, uint64(r.Entry))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(p.Externs)))
+	for _, n := range p.Externs {
+		buf = appendBytes(buf, []byte(n))
+	}
+	return buf, nil
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// Load decodes the program encoded by [Program.MarshalBinary]
+// and binds external operators from ext.
+// It fails if the program is malformed, e.g. an OpCheck or OpCommit instruction may run without the matching
+// OpMark or OpAtomic.
+func Load(data []byte, ext map[string]abnf.Operator) (*Program, error) {
+	if len(data) < len(magic)+1 || string(data[:len(magic)]) != magic {
+		return nil, errCorrupted
+	}
+	if v := data[len(magic)]; v != version {
+		return nil, fmt.Errorf("unsupported program version %d", v)
+	}
+
+	d := decoder{data: data[len(magic)+1:]}
+	p := &Program{}
+
+	p.Code = make([]Instruction, d.len())
+	for i := range p.Code {
+		p.Code[i] = Instruction{Opcode(d.byte()), d.uint32(), d.uint32()}
+	}
+
+	p.Sets = make([]abnf.ByteSet, d.len())
+	for i := range p.Sets {
+		for j := range p.Sets[i] {
+			p.Sets[i][j] = d.uint64()
+		}
+	}
+
+	p.Lits = make([][]byte, d.len())
+	for i := range p.Lits {
+		p.Lits[i] = d.bytes()
+	}
+
+	p.Rules = make([]Rule, d.len())
+	for i := range p.Rules {
+		p.Rules[i] = Rule{string(d.bytes()), d.uint32()}
+	}
+
+	p.Externs = make([]string, d.len())
+	for i := range p.Externs {
+		p.Externs[i] = string(d.bytes())
+	}
+
+	if d.err != nil || len(d.data) > 0 {
+		return nil, errCorrupted
+	}
+	if err := p.bind(ext); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MustLoad is like [Load] but panics on error.
+func MustLoad(data []byte, ext map[string]abnf.Operator) *Program {
+	p, err := Load(data, ext)
+	if err != nil {
+		panic(fmt.Errorf("load program: %w", err))
+	}
+	return p
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	v := d.uvarint()
+	if v > 1<<32-1 {
+		d.err = errCorrupted
+	}
+	return uint32(v)
+}
+
+// len reads a length of a list, it is limited by the data size to not allocate too much.
+func (d *decoder) len() int {
+	v := d.uvarint()
+	if v > uint64(len(d.data)) {
+		d.err = errCorrupted
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.data) == 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil || len(d.data) < 8 {
+		d.err = errCorrupted
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.data)
+	d.data = d.data[8:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.len()
+	if d.err != nil {
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
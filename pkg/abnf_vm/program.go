@@ -0,0 +1,242 @@
+// Package abnf_vm implements a bytecode execution engine for ABNF grammars.
+//
+// A grammar is compiled into a [Program], a compact list of instructions
+// executed by a loop-based virtual machine with an explicit backtrack stack.
+// Unlike operators of the closure engine that return all matches,
+// the machine returns the first match: alternatives are tried in the declaration order
+// and repetitions are greedy, the machine backtracks into them only if the rest of the grammar fails.
+//
+// Programs are usually compiled by generators of the abnf_gen package,
+// but they can also be assembled manually with a [Builder].
+package abnf_vm
+
+import (
+	"fmt"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// Opcode is an instruction operation code.
+type Opcode uint8
+
+const (
+	// OpFail fails the current path.
+	OpFail Opcode = iota
+	// OpByte matches a single octet from the set A.
+	OpByte
+	// OpLiteral matches the literal A case-insensitively, as [abnf.Literal] does, see [abnf.EqualFold].
+	OpLiteral
+	// OpLiteralCS matches the literal A case-sensitively.
+	OpLiteralCS
+	// OpRange matches an octet sequence between the literals A and B inclusive:
+	// len(B) octets of the input are compared lexicographically, unlike [abnf.Range].
+	// Generators of the abnf_gen package don't emit it.
+	OpRange
+	// OpSplit continues at A and pushes B to the backtrack stack.
+	OpSplit
+	// OpJump continues at A.
+	OpJump
+	// OpCall calls the rule A.
+	OpCall
+	// OpReturn returns from the current rule.
+	OpReturn
+	// OpExtern matches the external operator A.
+	// All matches of the operator are tried in the order of the parse [abnf.Policy].
+	OpExtern
+	// OpMark saves the current position.
+	OpMark
+	// OpCheck restores the position saved by OpMark and fails if the input wasn't consumed since then.
+	OpCheck
+	// OpAtomic saves the height of the backtrack stack.
+	OpAtomic
+	// OpCommit drops backtrack entries pushed since the matching OpAtomic.
+	OpCommit
+)
+
+var opNames = [...]string{
+	OpFail:      "fail",
+	OpByte:      "byte",
+	OpLiteral:   "literal",
+	OpLiteralCS: "literal_cs",
+	OpRange:     "range",
+	OpSplit:     "split",
+	OpJump:      "jump",
+	OpCall:      "call",
+	OpReturn:    "return",
+	OpExtern:    "extern",
+	OpMark:      "mark",
+	OpCheck:     "check",
+	OpAtomic:    "atomic",
+	OpCommit:    "commit",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("Opcode(%d)", op)
+}
+
+// Instruction is a single program instruction.
+type Instruction struct {
+	Op   Opcode
+	A, B uint32
+}
+
+// Rule is a program entry point.
+type Rule struct {
+	Name  string
+	Entry uint32
+}
+
+// Program is a compiled grammar.
+// It is safe for concurrent use.
+type Program struct {
+	Code    []Instruction
+	Sets    []abnf.ByteSet
+	Lits    [][]byte
+	Rules   []Rule
+	Externs []string
+
+	ruleIdx   map[string]uint32
+	externOps []abnf.Operator
+}
+
+// bind resolves rule names and external operators.
+func (p *Program) bind(ext map[string]abnf.Operator) error {
+	p.ruleIdx = make(map[string]uint32, len(p.Rules))
+	for i, r := range p.Rules {
+		if int(r.Entry) >= len(p.Code) {
+			return fmt.Errorf("rule '%s' entry %d is out of code", r.Name, r.Entry)
+		}
+		p.ruleIdx[r.Name] = uint32(i)
+	}
+
+	p.externOps = make([]abnf.Operator, len(p.Externs))
+	for i, n := range p.Externs {
+		op, ok := ext[n]
+		if !ok || op == nil {
+			return fmt.Errorf("external rule '%s' isn't provided", n)
+		}
+		p.externOps[i] = op
+	}
+
+	for pc, ins := range p.Code {
+		var ok bool
+		switch ins.Op {
+		case OpByte:
+			ok = int(ins.A) < len(p.Sets)
+		case OpLiteral, OpLiteralCS:
+			ok = int(ins.A) < len(p.Lits)
+		case OpRange:
+			ok = int(ins.A) < len(p.Lits) && int(ins.B) < len(p.Lits)
+		case OpSplit:
+			ok = int(ins.A) < len(p.Code) && int(ins.B) < len(p.Code)
+		case OpJump:
+			ok = int(ins.A) < len(p.Code)
+		case OpCall:
+			ok = int(ins.A) < len(p.Rules)
+		case OpExtern:
+			ok = int(ins.A) < len(p.Externs)
+		case OpFail, OpReturn, OpMark, OpCheck, OpAtomic, OpCommit:
+			ok = true
+		}
+		if !ok {
+			return fmt.Errorf("invalid instruction %d: %v %d %d", pc, ins.Op, ins.A, ins.B)
+		}
+	}
+	for _, r := range p.Rules {
+		if err := p.checkMarks(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMarks checks that every path of the rule r closes OpMark with OpCheck and OpAtomic with OpCommit
+// before it returns, so the machine never closes a mark that wasn't opened.
+// Marks that are open at an instruction are the same on every path that reaches it.
+func (p *Program) checkMarks(r Rule) error {
+	type state struct {
+		pc    uint32
+		marks string // opcodes of open marks
+	}
+	var (
+		seen  = make(map[uint32]string)
+		queue = []state{{r.Entry, ""}}
+	)
+	for len(queue) > 0 {
+		s := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if marks, ok := seen[s.pc]; ok {
+			if marks != s.marks {
+				return fmt.Errorf("rule '%s': instruction %d is reached with different open marks", r.Name, s.pc)
+			}
+			continue
+		}
+		seen[s.pc] = s.marks
+
+		ins := p.Code[s.pc]
+		next := []uint32{s.pc + 1}
+		switch ins.Op {
+		case OpFail:
+			continue
+		case OpReturn:
+			if s.marks != "" {
+				return fmt.Errorf("rule '%s': instruction %d returns with open marks", r.Name, s.pc)
+			}
+			continue
+		case OpSplit:
+			next = []uint32{ins.A, ins.B}
+		case OpJump:
+			next = []uint32{ins.A}
+		case OpMark, OpAtomic:
+			s.marks += string(rune(ins.Op))
+		case OpCheck, OpCommit:
+			open := OpMark
+			if ins.Op == OpCommit {
+				open = OpAtomic
+			}
+			if s.marks == "" || Opcode(s.marks[len(s.marks)-1]) != open {
+				return fmt.Errorf("rule '%s': instruction %d: %v without preceding %v", r.Name, s.pc, ins.Op, open)
+			}
+			s.marks = s.marks[:len(s.marks)-1]
+		}
+		for _, pc := range next {
+			if int(pc) >= len(p.Code) {
+				return fmt.Errorf("rule '%s': instruction %d runs out of code", r.Name, s.pc)
+			}
+			queue = append(queue, state{pc, s.marks})
+		}
+	}
+	return nil
+}
+
+// Operator returns an operator that matches the rule name or nil if there is no such rule.
+//
+// Created operator returns a single node of the first match.
+// The node and its descendants are rule nodes and nodes of external operators,
+// nodes of anonymous sub-expressions aren't created.
+func (p *Program) Operator(name string) abnf.Operator {
+	ri, ok := p.ruleIdx[name]
+	if !ok {
+		return nil
+	}
+	return func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		n, ok := p.exec(ctx, ri, in, pos)
+		if !ok {
+			return fmt.Errorf("operator %q failed at position %d: %w", name, pos, abnf.ErrNotMatched)
+		}
+		ns.Append(n)
+		return nil
+	}
+}
+
+// Operators returns a map of all program rules as operators.
+func (p *Program) Operators() map[string]abnf.Operator {
+	oprts := make(map[string]abnf.Operator, len(p.Rules))
+	for _, r := range p.Rules {
+		oprts[r.Name] = p.Operator(r.Name)
+	}
+	return oprts
+}
@@ -0,0 +1,193 @@
+package abnf_vm
+
+import (
+	"bytes"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// frame is a call stack frame.
+// Frames, captures and marks are immutable lists shared between backtrack entries.
+type frame struct {
+	ret  uint32
+	rule uint32
+	next *frame
+}
+
+type captureKind uint8
+
+const (
+	capOpen captureKind = iota
+	capClose
+	capNode
+)
+
+type capture struct {
+	kind captureKind
+	rule uint32
+	pos  uint
+	node *abnf.Node
+	prev *capture
+}
+
+type mark struct {
+	v    uint
+	next *mark
+}
+
+type entry struct {
+	pc    uint32
+	pos   uint
+	calls *frame
+	caps  *capture
+	marks *mark
+}
+
+// exec runs the rule ri on in from pos and returns the matched node, external operators are invoked with ctx.
+func (p *Program) exec(ctx *abnf.Context, ri uint32, in []byte, pos uint) (*abnf.Node, bool) {
+	var (
+		stack []entry
+		pc    = p.Rules[ri].Entry
+		calls = &frame{rule: ri}
+		caps  = &capture{kind: capOpen, rule: ri, pos: pos}
+		marks *mark
+	)
+	for {
+		ins := p.Code[pc]
+		ok := true
+		switch ins.Op {
+		case OpFail:
+			ok = false
+		case OpByte:
+			if ok = pos < uint(len(in)) && p.Sets[ins.A].Has(in[pos]); ok {
+				pos++
+				pc++
+			} else if pos == uint(len(in)) {
+				ctx.NeedMore(1)
+			}
+		case OpLiteral, OpLiteralCS:
+			lit := p.Lits[ins.A]
+			if ok = uint(len(in))-pos >= uint(len(lit)); ok {
+				got := in[pos : pos+uint(len(lit))]
+				if ins.Op == OpLiteralCS {
+					ok = bytes.Equal(got, lit)
+				} else {
+					ok = abnf.EqualFold(got, lit)
+				}
+			} else if rest := in[pos:]; bytes.Equal(rest, lit[:len(rest)]) ||
+				ins.Op == OpLiteral && abnf.EqualFold(rest, lit[:len(rest)]) {
+				ctx.NeedMore(uint(len(lit) - len(rest)))
+			}
+			if ok {
+				pos += uint(len(lit))
+				pc++
+			}
+		case OpRange:
+			low, high := p.Lits[ins.A], p.Lits[ins.B]
+			if ok = uint(len(in))-pos >= uint(len(high)); ok {
+				got := in[pos : pos+uint(len(high))]
+				ok = bytes.Compare(got, low) >= 0 && bytes.Compare(got, high) <= 0
+			} else if rest := in[pos:]; bytes.Compare(rest, low[:min(len(rest), len(low))]) >= 0 &&
+				bytes.Compare(rest, high[:len(rest)]) <= 0 {
+				ctx.NeedMore(uint(len(high) - len(rest)))
+			}
+			if ok {
+				pos += uint(len(high))
+				pc++
+			}
+		case OpSplit:
+			stack = append(stack, entry{ins.B, pos, calls, caps, marks})
+			pc = ins.A
+		case OpJump:
+			pc = ins.A
+		case OpCall:
+			calls = &frame{ret: pc + 1, rule: ins.A, next: calls}
+			caps = &capture{kind: capOpen, rule: ins.A, pos: pos, prev: caps}
+			pc = p.Rules[ins.A].Entry
+		case OpReturn:
+			caps = &capture{kind: capClose, rule: calls.rule, pos: pos, prev: caps}
+			pc, calls = calls.ret, calls.next
+			if calls == nil {
+				return p.buildNode(in, caps), true
+			}
+		case OpExtern:
+			ns := abnf.NewNodes()
+			if ok = p.externOps[ins.A](ctx, in, pos, ns) == nil && ns.Len() > 0; ok {
+				// push less preferred matches first, so they are tried in the policy order
+				for i := ns.Len() - 1; i > 0; i-- {
+					n := (*ns)[i]
+					stack = append(stack, entry{
+						pc:    pc + 1,
+						pos:   pos + uint(n.Len()),
+						calls: calls,
+						caps:  &capture{kind: capNode, node: n, prev: caps},
+						marks: marks,
+					})
+				}
+				n := (*ns)[0]
+				caps = &capture{kind: capNode, node: n, prev: caps}
+				pos += uint(n.Len())
+				pc++
+			}
+			ns.Free()
+		case OpMark:
+			marks = &mark{v: pos, next: marks}
+			pc++
+		case OpCheck:
+			ok = marks.v != pos
+			marks = marks.next
+			pc++
+		case OpAtomic:
+			marks = &mark{v: uint(len(stack)), next: marks}
+			pc++
+		case OpCommit:
+			stack = stack[:marks.v]
+			marks = marks.next
+			pc++
+		}
+
+		if ok {
+			continue
+		}
+		if len(stack) == 0 {
+			return nil, false
+		}
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		pc, pos, calls, caps, marks = e.pc, e.pos, e.calls, e.caps, e.marks
+	}
+}
+
+// buildNode builds a node tree from the capture list.
+func (p *Program) buildNode(in []byte, caps *capture) *abnf.Node {
+	var list []*capture
+	for c := caps; c != nil; c = c.prev {
+		list = append(list, c)
+	}
+
+	var (
+		root  *abnf.Node
+		stack []*abnf.Node
+	)
+	for i := len(list) - 1; i >= 0; i-- {
+		c := list[i]
+		switch c.kind {
+		case capOpen:
+			stack = append(stack, &abnf.Node{Key: p.Rules[c.rule].Name, Pos: c.pos})
+		case capClose:
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			n.Value = in[n.Pos:c.pos]
+			if len(stack) == 0 {
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			}
+		case capNode:
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, c.node)
+		}
+	}
+	return root
+}
@@ -0,0 +1,186 @@
+package abnf_vm_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_vm"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(abnf.RunWithLeakCheck(m))
+}
+
+// buildNumber assembles a program of the grammar:
+//
+//	number = 1*digit [ "." 1*digit ]
+//	digit  = %x30-39
+func buildNumber(t *testing.T) *abnf_vm.Builder {
+	t.Helper()
+
+	var digits abnf.ByteSet
+	digits.AddRange('0', '9')
+
+	b := abnf_vm.NewBuilder()
+	b.Rule("number")
+	b.Call("digit")
+	loop := b.Emit(abnf_vm.OpSplit, 0, 0)
+	b.Call("digit")
+	b.Emit(abnf_vm.OpJump, loop, 0)
+	b.Patch(loop, loop+1, b.PC())
+	opt := b.Emit(abnf_vm.OpSplit, 0, 0)
+	b.Emit(abnf_vm.OpLiteral, b.Literal([]byte(".")), 0)
+	b.Extern("digits")
+	b.Patch(opt, opt+1, b.PC())
+	b.Emit(abnf_vm.OpReturn, 0, 0)
+
+	b.Rule("digit")
+	b.Emit(abnf_vm.OpByte, b.Set(digits), 0)
+	b.Emit(abnf_vm.OpReturn, 0, 0)
+	return b
+}
+
+var extOps = map[string]abnf.Operator{
+	"digits": abnf.Repeat1Inf("digits", abnf.Range("DIGIT", []byte("0"), []byte("9"))),
+}
+
+func TestProgram_Operator(t *testing.T) {
+	prog, err := buildNumber(t).Build(extOps)
+	if err != nil {
+		t.Fatalf("b.Build(ext) error = %v, want nil", err)
+	}
+
+	op := prog.Operator("number")
+	if op == nil {
+		t.Fatal("prog.Operator(\"number\") = nil, want not nil")
+	}
+	if prog.Operator("unknown") != nil {
+		t.Fatal("prog.Operator(\"unknown\") = not nil, want nil")
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := op(nil, []byte("12.50x"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if ns.Len() != 1 {
+		t.Fatalf("op(in, 0, ns) returned %d nodes, want 1", ns.Len())
+	}
+	n := ns.Best()
+	if got, want := n.String(), "12.50"; got != want {
+		t.Fatalf("op(in, 0, ns) = %q, want %q", got, want)
+	}
+	if got, want := len(n.GetNodes("digit")), 2; got != want {
+		t.Fatalf("len(n.GetNodes(\"digit\")) = %d, want %d", got, want)
+	}
+	if dn, ok := n.GetNode("digits"); !ok || dn.String() != "50" {
+		t.Fatalf("n.GetNode(\"digits\") = %v, want \"50\"", dn)
+	}
+
+	ns.Clear()
+	if err := op(nil, []byte(".5"), 0, ns); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Fatalf("op(in, 0, ns) error = %v, want %v", err, abnf.ErrNotMatched)
+	}
+}
+
+func TestProgram_Operator_Partial(t *testing.T) {
+	prog, err := buildNumber(t).Build(extOps)
+	if err != nil {
+		t.Fatalf("b.Build(ext) error = %v, want nil", err)
+	}
+	op := prog.Operator("number")
+
+	for _, c := range []struct {
+		in       string
+		want     abnf.PartialStatus
+		wantNeed uint
+		wantMore bool
+	}{
+		{"", abnf.Incomplete, 1, false},
+		{"1", abnf.Complete, 0, true},
+		{"12.", abnf.Complete, 0, true},
+		{"12.x", abnf.Complete, 0, false},
+		{"x", abnf.Invalid, 0, false},
+	} {
+		res, _ := abnf.ParsePartial(op, []byte(c.in))
+		if res.Status != c.want || res.Need != c.wantNeed || res.More != c.wantMore {
+			t.Errorf("abnf.ParsePartial(op, %q) = %v need %d more %v, want %v need %d more %v",
+				c.in, res.Status, res.Need, res.More, c.want, c.wantNeed, c.wantMore)
+		}
+	}
+}
+
+func TestBuilder_Build(t *testing.T) {
+	b := abnf_vm.NewBuilder()
+	b.Rule("r")
+	b.Call("undefined")
+	b.Emit(abnf_vm.OpReturn, 0, 0)
+	if _, err := b.Build(nil); err == nil {
+		t.Fatal("b.Build(nil) error = nil, want error")
+	}
+
+	if _, err := buildNumber(t).Build(nil); err == nil {
+		t.Fatal("b.Build(nil) error = nil, want error on missing external operator")
+	}
+}
+
+func TestLoad_UnbalancedMarks(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		code []abnf_vm.Instruction
+	}{
+		{"check", []abnf_vm.Instruction{{Op: abnf_vm.OpCheck}, {Op: abnf_vm.OpReturn}}},
+		{"commit", []abnf_vm.Instruction{{Op: abnf_vm.OpCommit}, {Op: abnf_vm.OpReturn}}},
+		{"commit_mark", []abnf_vm.Instruction{{Op: abnf_vm.OpMark}, {Op: abnf_vm.OpCommit}, {Op: abnf_vm.OpReturn}}},
+		{"open", []abnf_vm.Instruction{{Op: abnf_vm.OpAtomic}, {Op: abnf_vm.OpReturn}}},
+		{"split", []abnf_vm.Instruction{
+			{Op: abnf_vm.OpSplit, A: 1, B: 2},
+			{Op: abnf_vm.OpMark},
+			{Op: abnf_vm.OpCheck},
+			{Op: abnf_vm.OpReturn},
+		}},
+		{"out_of_code", []abnf_vm.Instruction{{Op: abnf_vm.OpMark}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := &abnf_vm.Program{Code: c.code, Rules: []abnf_vm.Rule{{Name: "r"}}}
+			data, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatalf("p.MarshalBinary() error = %v, want nil", err)
+			}
+			if _, err := abnf_vm.Load(data, nil); err == nil {
+				t.Fatal("abnf_vm.Load(data, nil) error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	data, err := buildNumber(t).MarshalBinary()
+	if err != nil {
+		t.Fatalf("b.MarshalBinary() error = %v, want nil", err)
+	}
+
+	prog, err := abnf_vm.Load(data, extOps)
+	if err != nil {
+		t.Fatalf("abnf_vm.Load(data, ext) error = %v, want nil", err)
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := prog.Operator("number")(nil, []byte("7.25"), 0, ns); err != nil {
+		t.Fatalf("op(in, 0, ns) error = %v, want nil", err)
+	}
+	if got, want := ns.Best().String(), "7.25"; got != want {
+		t.Fatalf("op(in, 0, ns) = %q, want %q", got, want)
+	}
+
+	for i := range len(data) {
+		if _, err := abnf_vm.Load(data[:i], extOps); err == nil {
+			t.Fatalf("abnf_vm.Load(data[:%d], ext) error = nil, want error", i)
+		}
+	}
+}
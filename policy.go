@@ -0,0 +1,73 @@
+package abnf
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Policy defines a disambiguation policy for ambiguous matches.
+// It compares two candidate nodes and returns a negative number if a is preferred over b,
+// a positive number if b is preferred over a, and 0 if they rank equally.
+// A policy must define a strict weak ordering.
+//
+// Candidates that rank equally keep the order in which they were produced:
+// the declaration order of [Alt] alternatives and the ascending repetition count of [Repeat].
+//
+// The policy of a parse is used to sort results of [Alt] and [Repeat],
+// to pick a single result of [Concat] and by [Nodes.Best], see [WithPolicy].
+type Policy func(a, b *Node) int
+
+// PolicyLongest prefers longer values, then nodes with more children.
+// This is the default policy.
+func PolicyLongest(a, b *Node) int {
+	if c := cmp.Compare(b.Len(), a.Len()); c != 0 {
+		return c
+	}
+	return cmp.Compare(len(b.Children), len(a.Children))
+}
+
+// PolicyFirst keeps candidates in the order they were produced,
+// so the first declared alternative and the fewest repetitions are preferred.
+func PolicyFirst(_, _ *Node) int { return 0 }
+
+// PolicyFewestNodes prefers smaller subtrees, then longer values.
+func PolicyFewestNodes(a, b *Node) int {
+	if c := cmp.Compare(a.size(), b.size()); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.Len(), a.Len())
+}
+
+func (n *Node) size() int {
+	if n == nil {
+		return 0
+	}
+	return n.count()
+}
+
+// SortBy sorts the list according to the policy p.
+// The sort is stable, nodes that rank equally keep their order.
+func (ns *Nodes) SortBy(p Policy) {
+	debugNodesCheck(ns)
+	if ns == nil || len(*ns) < 2 {
+		return
+	}
+	slices.SortStableFunc(*ns, p)
+}
+
+// BestBy returns the most preferred node according to the policy p or nil if the list is empty.
+// If several nodes rank equally, the first one is returned.
+func (ns *Nodes) BestBy(p Policy) *Node {
+	debugNodesCheck(ns)
+	if ns == nil || len(*ns) == 0 {
+		return nil
+	}
+
+	best := (*ns)[0]
+	for _, n := range (*ns)[1:] {
+		if p(n, best) < 0 {
+			best = n
+		}
+	}
+	return best
+}
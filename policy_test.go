@@ -0,0 +1,145 @@
+package abnf_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+)
+
+func TestParse_WithPolicy(t *testing.T) {
+	alt := abnf.Alt(`"a" / "ab" / "a" "b"`,
+		abnf.Literal(`"a"`, []byte("a")),
+		abnf.Literal(`"ab"`, []byte("ab")),
+		abnf.Concat(`"a" "b"`,
+			abnf.Literal(`"a"`, []byte("a")),
+			abnf.Literal(`"b"`, []byte("b")),
+		),
+	)
+
+	cases := []struct {
+		name     string
+		policy   abnf.Policy
+		wantVals []string
+		wantKeys []string
+	}{
+		{"default", nil, []string{"ab", "ab", "a"}, []string{`"ab"`, `"a" "b"`, `"a"`}},
+		{"longest", abnf.PolicyLongest, []string{"ab", "ab", "a"}, []string{`"ab"`, `"a" "b"`, `"a"`}},
+		{"first", abnf.PolicyFirst, []string{"a", "ab", "ab"}, []string{`"a"`, `"ab"`, `"a" "b"`}},
+		{"fewest nodes", abnf.PolicyFewestNodes, []string{"ab", "a", "ab"}, []string{`"ab"`, `"a"`, `"a" "b"`}},
+		{"custom",
+			func(a, b *abnf.Node) int { return len(b.Children[0].Children) - len(a.Children[0].Children) },
+			[]string{"ab", "a", "ab"},
+			[]string{`"a" "b"`, `"a"`, `"ab"`},
+		},
+	}
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ns.Clear()
+
+			var opts []abnf.ParseOption
+			if c.policy != nil {
+				opts = append(opts, abnf.WithPolicy(c.policy))
+			}
+			if err := abnf.Parse(alt, []byte("abc"), ns, opts...); err != nil {
+				t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+			}
+
+			var vals, keys []string
+			for _, n := range ns.All() {
+				vals = append(vals, n.String())
+				keys = append(keys, n.Children[0].Key)
+			}
+			if !cmp.Equal(vals, c.wantVals) || !cmp.Equal(keys, c.wantKeys) {
+				t.Fatalf("abnf.Parse(op, in, ns) = %v %v, want %v %v", vals, keys, c.wantVals, c.wantKeys)
+			}
+		})
+	}
+}
+
+func TestParse_WithPolicy_Concat(t *testing.T) {
+	op := abnf.Concat(`*"a" *"a"`,
+		abnf.Repeat0Inf(`*"a"`, abnf.Literal(`"a"`, []byte("a"))),
+		abnf.Repeat0Inf(`*"a"`, abnf.Literal(`"a"`, []byte("a"))),
+	)
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(op, []byte("aa"), ns, abnf.WithPolicy(abnf.PolicyFirst)); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	if got := ns.Best().String(); got != "" {
+		t.Fatalf("abnf.Parse(op, in, ns) best = %q, want %q", got, "")
+	}
+
+	ns.Clear()
+	if err := abnf.Parse(op, []byte("aa"), ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	if got := ns.Best().String(); got != "aa" {
+		t.Fatalf("abnf.Parse(op, in, ns) best = %q, want %q", got, "aa")
+	}
+}
+
+func TestParse_WithPolicy_SameInput(t *testing.T) {
+	alt := abnf.Alt(`"a" / "ab"`,
+		abnf.Literal(`"a"`, []byte("a")),
+		abnf.Literal(`"ab"`, []byte("ab")),
+	)
+	in := []byte("ab")
+
+	// concurrent parses of the same buffer don't share options
+	var wg sync.WaitGroup
+	for i := range 8 {
+		policy, want := abnf.PolicyLongest, "ab"
+		if i%2 == 0 {
+			policy, want = abnf.PolicyFirst, "a"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ns := abnf.NewNodes()
+			defer ns.Free()
+
+			for range 100 {
+				ns.Clear()
+				if err := abnf.Parse(alt, in, ns, abnf.WithPolicy(policy)); err != nil {
+					t.Errorf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+					return
+				}
+				if got := ns.All()[0].String(); got != want {
+					t.Errorf("abnf.Parse(op, in, ns) first = %q, want %q", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNodes_BestBy(t *testing.T) {
+	ns := abnf.Nodes{
+		{Key: "a", Value: []byte("ab"), Children: abnf.Nodes{{Key: "ab"}}},
+		{Key: "b", Value: []byte("ab"), Children: abnf.Nodes{{Key: "a"}, {Key: "b"}}},
+		{Key: "c", Value: []byte("a")},
+	}
+
+	if got := ns.BestBy(abnf.PolicyLongest).Key; got != "b" {
+		t.Errorf("ns.BestBy(abnf.PolicyLongest).Key = %q, want %q", got, "b")
+	}
+	if got := ns.BestBy(abnf.PolicyFirst).Key; got != "a" {
+		t.Errorf("ns.BestBy(abnf.PolicyFirst).Key = %q, want %q", got, "a")
+	}
+	if got := ns.BestBy(abnf.PolicyFewestNodes).Key; got != "c" {
+		t.Errorf("ns.BestBy(abnf.PolicyFewestNodes).Key = %q, want %q", got, "c")
+	}
+}
@@ -0,0 +1,92 @@
+package abnf
+
+import (
+	"log/slog"
+)
+
+// DefaultPlaceholder is the default placeholder of values masked by [Redactor].
+const DefaultPlaceholder = "***"
+
+// Redactor masks sensitive values of the input, e.g. URI userinfo or credentials in headers,
+// that are matched by the given rules.
+// Matches of the operator are searched in the input, see [Searcher], and values of nodes with masked keys
+// are replaced with the placeholder. Everything else is copied byte-for-byte.
+//
+// Regions of the input outside of matches are copied as is, so sensitive values the operator doesn't match,
+// e.g. malformed ones, aren't masked. Use [Redactor.MaskUnmatched] to mask such regions too.
+//
+// Redactor is safe for concurrent use once configured.
+type Redactor struct {
+	s           *Searcher
+	keys        func(n *Node) bool
+	placeholder []byte
+	unmatched   bool
+}
+
+// NewRedactor returns a redactor that masks values of nodes with the given keys in matches of op.
+// Options apply to every search, see [Parse].
+func NewRedactor(op Operator, keys []string, opts ...ParseOption) *Redactor {
+	return &Redactor{
+		s:           NewSearcher(op, nil, opts...),
+		keys:        KeepKeys(keys...),
+		placeholder: []byte(DefaultPlaceholder),
+	}
+}
+
+// Placeholder sets the placeholder that replaces masked values, [DefaultPlaceholder] by default.
+// It must be called before the redactor is used.
+func (r *Redactor) Placeholder(p string) {
+	r.placeholder = []byte(p)
+}
+
+// MaskUnmatched enables masking of regions of the input outside of matches:
+// each region is replaced with a single placeholder, so only values matched by the operator are output.
+// It must be called before the redactor is used.
+func (r *Redactor) MaskUnmatched() {
+	r.unmatched = true
+}
+
+// Redact returns a copy of in with masked values replaced with the placeholder.
+func (r *Redactor) Redact(in []byte) []byte {
+	if !r.unmatched {
+		return r.s.ReplaceAll(in, r.mask)
+	}
+
+	out := make([]byte, 0, len(in))
+	var last uint
+	for n := range r.s.All(in) {
+		if n.Pos > last {
+			out = append(out, r.placeholder...)
+		}
+		out = append(out, r.mask(n)...)
+		last = n.Pos + uint(n.Len())
+	}
+	if last < uint(len(in)) {
+		out = append(out, r.placeholder...)
+	}
+	return out
+}
+
+func (r *Redactor) mask(n *Node) []byte {
+	return n.Rewrite(func(n *Node) ([]byte, bool) {
+		if r.keys(n) {
+			return r.placeholder, true
+		}
+		return nil, false
+	})
+}
+
+// Value returns a [slog.LogValuer] of the redacted input.
+// The input is redacted only when the value is actually logged, so in must not be modified until then.
+func (r *Redactor) Value(in []byte) slog.LogValuer {
+	return redacted{r, in}
+}
+
+type redacted struct {
+	r  *Redactor
+	in []byte
+}
+
+func (v redacted) LogValue() slog.Value {
+	return slog.StringValue(string(v.r.Redact(v.in)))
+}
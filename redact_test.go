@@ -0,0 +1,71 @@
+package abnf_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/ghettovoice/abnf"
+)
+
+func TestRedactor(t *testing.T) {
+	in := []byte("To: <sip:alice@atlanta.com>, <sip:bob@biloxi.com>")
+
+	r := abnf.NewRedactor(uriOp(), []string{"user"})
+	if got, want := string(r.Redact(in)), "To: <sip:***@atlanta.com>, <sip:***@biloxi.com>"; got != want {
+		t.Fatalf("r.Redact(in) = %q, want %q", got, want)
+	}
+
+	r = abnf.NewRedactor(uriOp(), []string{"user", "host"})
+	r.Placeholder("x")
+	if got, want := string(r.Redact(in)), "To: <sip:x@x>, <sip:x@x>"; got != want {
+		t.Fatalf("r.Redact(in) = %q, want %q", got, want)
+	}
+
+	r = abnf.NewRedactor(uriOp(), []string{"uri"})
+	if got, want := string(r.Redact(in)), "To: <***>, <***>"; got != want {
+		t.Fatalf("r.Redact(in) = %q, want %q", got, want)
+	}
+	if got, want := string(r.Redact([]byte("none"))), "none"; got != want {
+		t.Fatalf("r.Redact(in) = %q, want %q", got, want)
+	}
+}
+
+func TestRedactor_MaskUnmatched(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"sip:alice@atlanta.com", "sip:***@atlanta.com"},
+		{"<sip:alice@atlanta.com>", "***sip:***@atlanta.com***"},
+		{"<sip:alice@atlanta.com>, <sip:bob@biloxi.com>", "***sip:***@atlanta.com***sip:***@biloxi.com***"},
+		{"sip:al1ce@atlanta.com", "***"},
+		{"tel:+1-555-0100;secret=alice", "***"},
+		{"", ""},
+	} {
+		r := abnf.NewRedactor(uriOp(), []string{"user"})
+		r.MaskUnmatched()
+		if got := string(r.Redact([]byte(c.in))); got != c.want {
+			t.Errorf("r.Redact(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRedactor_Value(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	r := abnf.NewRedactor(uriOp(), []string{"user"})
+	log.Info("request", "to", r.Value([]byte("sip:alice@atlanta.com")))
+
+	if got, want := strings.TrimSpace(buf.String()), `level=INFO msg=request to=sip:***@atlanta.com`; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package abnf
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// ErrOverlappingEdits is returned by [Rewriter] when edits overlap each other.
+const ErrOverlappingEdits sentinelError = "overlapping edits"
+
+// ReplaceAll returns a copy of in with all matches of op replaced with the octets returned by repl,
+// see [Searcher.ReplaceAll].
+func ReplaceAll(op Operator, in []byte, repl func(n *Node) []byte, opts ...ParseOption) []byte {
+	return NewSearcher(op, nil, opts...).ReplaceAll(in, repl)
+}
+
+// ReplaceAll returns a copy of in with all successive non-overlapping matches replaced
+// with the octets returned by repl. Octets between matches are copied as is.
+func (s *Searcher) ReplaceAll(in []byte, repl func(n *Node) []byte) []byte {
+	out := make([]byte, 0, len(in))
+	var last uint
+	for n := range s.All(in) {
+		out = append(out, in[last:n.Pos]...)
+		out = append(out, repl(n)...)
+		last = n.Pos + uint(n.Len())
+	}
+	return append(out, in[last:]...)
+}
+
+// Rewrite returns a copy of the node value with selected nodes of the subtree replaced.
+// repl is called for nodes in the depth-first order starting from n itself, if it returns true,
+// the node value is replaced with the returned octets and its descendants aren't visited.
+// Octets outside replaced nodes are copied as is, so the result is byte-exact except for the replaced spans.
+func (n *Node) Rewrite(repl func(n *Node) ([]byte, bool)) []byte {
+	if n == nil {
+		return nil
+	}
+
+	out := make([]byte, 0, len(n.Value))
+	last := n.Pos
+	var walk func(m *Node)
+	walk = func(m *Node) {
+		if m.Pos < last {
+			// malformed tree, node overlaps the replaced one
+			return
+		}
+		if val, ok := repl(m); ok {
+			out = append(out, n.Value[last-n.Pos:m.Pos-n.Pos]...)
+			out = append(out, val...)
+			last = m.Pos + uint(m.Len())
+			return
+		}
+		for _, chn := range m.Children {
+			walk(chn)
+		}
+	}
+	walk(n)
+	return append(out, n.Value[last-n.Pos:]...)
+}
+
+// Rewriter collects edits of nodes parsed from an input and applies them at once,
+// so nodes of the tree can be edited in any order without shifting positions of other nodes.
+// Octets outside edited spans are kept as is.
+//
+// Rewriter is not safe for concurrent use.
+type Rewriter struct {
+	in    []byte
+	edits []Edit
+}
+
+// NewRewriter returns a rewriter of the input in.
+func NewRewriter(in []byte) *Rewriter {
+	return &Rewriter{in: in}
+}
+
+// Replace replaces the node value with val.
+func (r *Rewriter) Replace(n *Node, val []byte) {
+	r.edits = append(r.edits, Edit{Offset: n.Pos, Deleted: uint(n.Len()), Inserted: val})
+}
+
+// Delete deletes the node value.
+func (r *Rewriter) Delete(n *Node) {
+	r.Replace(n, nil)
+}
+
+// InsertBefore inserts val before the node.
+func (r *Rewriter) InsertBefore(n *Node, val []byte) {
+	r.edits = append(r.edits, Edit{Offset: n.Pos, Inserted: val})
+}
+
+// InsertAfter inserts val after the node.
+func (r *Rewriter) InsertAfter(n *Node, val []byte) {
+	r.edits = append(r.edits, Edit{Offset: n.Pos + uint(n.Len()), Inserted: val})
+}
+
+// Edits returns the collected edits ordered by offset.
+// Insertions at the same offset keep the order they were made in and precede the replacement at this offset.
+// Offsets are relative to the original input, so edits must be applied from the last one,
+// or passed one by one to [Reparse] in the reverse order.
+func (r *Rewriter) Edits() []Edit {
+	edits := slices.Clone(r.edits)
+	slices.SortStableFunc(edits, func(a, b Edit) int {
+		if c := cmp.Compare(a.Offset, b.Offset); c != 0 {
+			return c
+		}
+		switch {
+		case a.Deleted == 0 && b.Deleted > 0:
+			return -1
+		case a.Deleted > 0 && b.Deleted == 0:
+			return 1
+		}
+		return 0
+	})
+	return edits
+}
+
+// Bytes returns a new input with all edits applied, the original input is not modified.
+// It returns [ErrOverlappingEdits] if edited spans overlap,
+// e.g. a node and its descendant are both replaced.
+func (r *Rewriter) Bytes() ([]byte, error) {
+	out := make([]byte, 0, len(r.in))
+	var last uint
+	for _, e := range r.Edits() {
+		if e.Offset+e.Deleted > uint(len(r.in)) {
+			return nil, fmt.Errorf("edit [%d:%d] is out of input bounds [0:%d]", e.Offset, e.Offset+e.Deleted, len(r.in))
+		}
+		if e.Offset < last {
+			return nil, fmt.Errorf("edit [%d:%d]: %w", e.Offset, e.Offset+e.Deleted, ErrOverlappingEdits)
+		}
+		out = append(out, r.in[last:e.Offset]...)
+		out = append(out, e.Inserted...)
+		last = e.Offset + e.Deleted
+	}
+	return append(out, r.in[last:]...), nil
+}
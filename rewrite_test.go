@@ -0,0 +1,118 @@
+package abnf_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// uriOp returns the operator of the rule:
+//
+//	uri = "sip:" user "@" host
+//	user = 1*ALPHA
+//	host = 1*(ALPHA / ".")
+func uriOp() abnf.Operator {
+	core := abnf_core.Operators()
+	return abnf.Concat("uri",
+		abnf.Literal(`"sip:"`, []byte("sip:")),
+		abnf.Repeat1Inf("user", core.ALPHA),
+		abnf.Literal(`"@"`, []byte("@")),
+		abnf.Repeat1Inf("host", abnf.Alt(`ALPHA / "."`, core.ALPHA, abnf.Literal(`"."`, []byte(".")))),
+	)
+}
+
+func TestReplaceAll(t *testing.T) {
+	in := []byte("To: <sip:alice@atlanta.com>, <sip:bob@biloxi.com>")
+	got := abnf.ReplaceAll(uriOp(), in, func(n *abnf.Node) []byte {
+		host, _ := n.GetNode("host")
+		return n.Rewrite(func(n *abnf.Node) ([]byte, bool) {
+			if n == host {
+				return []byte("example.org"), true
+			}
+			return nil, false
+		})
+	})
+	if want := "To: <sip:alice@example.org>, <sip:bob@example.org>"; string(got) != want {
+		t.Fatalf("abnf.ReplaceAll(op, in, repl) = %q, want %q", got, want)
+	}
+
+	if got := abnf.ReplaceAll(uriOp(), []byte("none"), nil); string(got) != "none" {
+		t.Fatalf("abnf.ReplaceAll(op, in, repl) = %q, want %q", got, "none")
+	}
+}
+
+func TestNode_Rewrite(t *testing.T) {
+	in := []byte("sip:alice@atlanta.com")
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := abnf.Parse(uriOp(), in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	n := ns.Best()
+
+	var visited []string
+	got := n.Rewrite(func(n *abnf.Node) ([]byte, bool) {
+		visited = append(visited, n.Key)
+		switch n.Key {
+		case "user":
+			return []byte("bob"), true
+		case "host":
+			return []byte("biloxi.com"), true
+		}
+		return nil, false
+	})
+	if want := "sip:bob@biloxi.com"; string(got) != want {
+		t.Fatalf("n.Rewrite(repl) = %q, want %q", got, want)
+	}
+	if want := []string{"uri", `"sip:"`, "user", `"@"`, "host"}; !cmp.Equal(visited, want) {
+		t.Fatalf("visited nodes %q, want %q", visited, want)
+	}
+	if string(in) != "sip:alice@atlanta.com" {
+		t.Fatalf("input modified to %q", in)
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	in := []byte("sip:alice@atlanta.com")
+	ns := abnf.NewNodes()
+	defer ns.Free()
+	if err := abnf.Parse(uriOp(), in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	n := ns.Best()
+	user, _ := n.GetNode("user")
+	host, _ := n.GetNode("host")
+
+	r := abnf.NewRewriter(in)
+	r.Replace(host, []byte("biloxi.com"))
+	r.InsertAfter(host, []byte(";transport=tcp"))
+	r.Replace(user, []byte("bob"))
+	r.InsertBefore(user, []byte("+"))
+	got, err := r.Bytes()
+	if err != nil {
+		t.Fatalf("r.Bytes() error = %v, want nil", err)
+	}
+	if want := "sip:+bob@biloxi.com;transport=tcp"; string(got) != want {
+		t.Fatalf("r.Bytes() = %q, want %q", got, want)
+	}
+
+	edits := r.Edits()
+	out := in
+	for i := len(edits) - 1; i >= 0; i-- {
+		out = edits[i].Apply(out)
+	}
+	if string(out) != string(got) {
+		t.Fatalf("edits applied in reverse order = %q, want %q", out, got)
+	}
+
+	r = abnf.NewRewriter(in)
+	r.Delete(n)
+	r.Replace(host, []byte("biloxi.com"))
+	if _, err := r.Bytes(); !errors.Is(err, abnf.ErrOverlappingEdits) {
+		t.Fatalf("r.Bytes() error = %v, want %v", err, abnf.ErrOverlappingEdits)
+	}
+}
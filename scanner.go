@@ -0,0 +1,217 @@
+package abnf
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// ErrMatchTooLong is returned by [Scanner] when a match doesn't fit into the maximum buffer size.
+	ErrMatchTooLong sentinelError = "match too long"
+	// ErrEmptyMatch is returned by [Scanner] when the operator matches empty input before the end of the stream.
+	ErrEmptyMatch sentinelError = "empty match"
+)
+
+const (
+	// MaxScanSize is the default maximum size of the [Scanner] buffer.
+	MaxScanSize = 64 * 1024 * 1024
+
+	startScanSize = 4096
+)
+
+// Scanner parses a stream of consecutive matches of an operator, e.g. rules of a rulelist
+// or messages of a mail archive, read from [io.Reader] through a sliding buffer.
+//
+// The buffered input is parsed with [ParsePartial]: if it's incomplete, octets are read until the parse
+// may succeed, so the input isn't re-parsed until at least the number of octets it needs is buffered.
+// Until the match is decided, the buffered input is parsed again only once its length doubles,
+// which keeps scanning linear in the stream length regardless of the reader chunk size.
+// If it's invalid, the scan fails right away without reading the rest of the stream.
+// A match is emitted once more input can't extend it and at least the lookahead number of octets follows it,
+// see [Scanner.Lookahead]. Once the match is emitted, its octets are discarded from the buffer.
+//
+// Operators of the scanner must report truncated input, as primitive operators do,
+// otherwise input cut by the buffer looks invalid, see [Context.NeedMore].
+//
+// Scanner is not safe for concurrent use.
+type Scanner struct {
+	r    io.Reader
+	op   Operator
+	opts []ParseOption
+
+	buf        []byte
+	start, end int
+	max        int
+	lookahead  int
+	want       int
+	eof        bool
+
+	off  uint
+	node *Node
+	err  error
+}
+
+// NewScanner returns a scanner that reads matches of op from r.
+// Options apply to each parse of the buffered input, see [Parse].
+func NewScanner(r io.Reader, op Operator, opts ...ParseOption) *Scanner {
+	return &Scanner{r: r, op: op, opts: opts, max: MaxScanSize}
+}
+
+// Buffer sets the initial buffer and the maximum size of the buffer, which limits the size of a match.
+// It must be called before the first call to [Scanner.Scan].
+func (s *Scanner) Buffer(buf []byte, max int) {
+	s.buf = buf[:cap(buf)]
+	s.max = max
+}
+
+// Lookahead sets the number of octets that must follow a match before it is emitted, 0 by default.
+// Operators that decide where the match ends without reporting truncated input, e.g. custom operators
+// that look further ahead, need a larger lookahead. At the end of the stream matches are emitted as is.
+// It must be called before the first call to [Scanner.Scan].
+func (s *Scanner) Lookahead(n int) {
+	s.lookahead = n
+}
+
+// Scan advances the scanner to the next match, which is then available through [Scanner.Node].
+// It returns false when the scan stops, either by reaching the end of the stream or an error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	s.node = nil
+
+	for {
+		if l := s.end - s.start; l > 0 && (l >= s.want || s.eof) {
+			in := s.buf[s.start:s.end]
+			res, err := ParsePartial(s.op, in, s.opts...)
+			switch {
+			case res.Status == Invalid:
+				s.err = fmt.Errorf("scan at offset %d: %w", s.off, err)
+				return false
+			case res.Status == Incomplete && s.eof:
+				s.err = fmt.Errorf("scan at offset %d: %w", s.off, s.parseErr(in))
+				return false
+			case res.Status == Incomplete:
+				s.want = s.grow(l, int(max(res.Need, 1)))
+			case res.Node.Len() == 0 && res.More && !s.eof:
+				// an empty match may become non-empty with more input
+				s.want = s.grow(l, 1)
+			case res.Node.Len() == 0:
+				s.err = fmt.Errorf("scan at offset %d: %w", s.off, ErrEmptyMatch)
+				return false
+			case s.eof || !res.More && l-res.Node.Len() >= s.lookahead:
+				n := res.Node
+				s.node = n.rebase(s.off)
+				s.start += n.Len()
+				s.off += uint(n.Len())
+				s.want = 0
+				return true
+			case res.More:
+				s.want = s.grow(l, max(1, res.Node.Len()+s.lookahead-l))
+			default:
+				// the match can't be extended, only the lookahead is missing
+				s.want = res.Node.Len() + s.lookahead
+			}
+			if s.want > s.max {
+				s.err = fmt.Errorf("scan at offset %d: %w", s.off, ErrMatchTooLong)
+				return false
+			}
+		} else if l == 0 && s.eof {
+			return false
+		}
+
+		if !s.fill() {
+			return false
+		}
+	}
+}
+
+// grow returns the buffered length to parse the input again at, given that l octets are buffered
+// and at least need more octets are required. The length is at least doubled while it fits the buffer limit,
+// so a long match read in small chunks is parsed a logarithmic number of times.
+func (s *Scanner) grow(l, need int) int {
+	if l+need > s.max {
+		return l + need
+	}
+	return min(max(l+need, 2*l), s.max)
+}
+
+// parseErr returns the error of the parse of the truncated input in.
+func (s *Scanner) parseErr(in []byte) error {
+	ns := NewNodes()
+	defer ns.Free()
+
+	if err := Parse(s.op, in, ns, s.opts...); err != nil {
+		return err
+	}
+	return ErrNotMatched
+}
+
+// fill reads more octets into the buffer, it returns false on errors.
+func (s *Scanner) fill() bool {
+	if s.start > 0 && (s.end == len(s.buf) || s.start > len(s.buf)/2) {
+		// matched octets aren't reachable anymore
+		copy(s.buf, s.buf[s.start:s.end])
+		s.end -= s.start
+		s.start = 0
+	}
+	if s.end == len(s.buf) {
+		if len(s.buf) >= s.max {
+			s.err = fmt.Errorf("scan at offset %d: %w", s.off, ErrMatchTooLong)
+			return false
+		}
+		size := max(2*len(s.buf), startScanSize)
+		size = min(size, s.max)
+		buf := make([]byte, size)
+		copy(buf, s.buf[s.start:s.end])
+		s.buf = buf
+	}
+
+	for range 100 {
+		n, err := s.r.Read(s.buf[s.end:])
+		s.end += n
+		if err == io.EOF {
+			s.eof = true
+			return true
+		}
+		if err != nil {
+			s.err = fmt.Errorf("scan at offset %d: %w", s.off, err)
+			return false
+		}
+		if n > 0 {
+			return true
+		}
+	}
+	s.err = fmt.Errorf("scan at offset %d: %w", s.off, io.ErrNoProgress)
+	return false
+}
+
+// Node returns the most recent match with positions relative to the start of the stream.
+// The node doesn't reference the scanner buffer, so it's safe to keep it.
+func (s *Scanner) Node() *Node {
+	return s.node
+}
+
+// Offset returns the number of octets consumed by emitted matches.
+func (s *Scanner) Offset() uint {
+	return s.off
+}
+
+// Err returns the first non-EOF error encountered by the scanner.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// rebase returns a detached copy of the subtree with positions shifted by off.
+func (n *Node) rebase(off uint) *Node {
+	dn := n.Detach()
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		n.Pos += off
+		for _, chn := range n.Children {
+			walk(chn)
+		}
+	}
+	walk(dn)
+	return dn
+}
@@ -0,0 +1,207 @@
+package abnf_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// msgOp returns the operator of the rule:
+//
+//	msg = 1*ALPHA CRLF
+func msgOp() abnf.Operator {
+	return abnf.Concat("msg",
+		abnf.Repeat1Inf("1*ALPHA", abnf_core.Operators().ALPHA),
+		abnf_core.Operators().CRLF,
+	)
+}
+
+func TestScanner(t *testing.T) {
+	s := abnf.NewScanner(iotest.OneByteReader(strings.NewReader("ab\r\ncde\r\nf\r\n")), msgOp())
+
+	type match struct {
+		val string
+		pos uint
+	}
+	var got []match
+	for s.Scan() {
+		n := s.Node()
+		got = append(got, match{n.String(), n.Pos})
+		if chn := n.Children[1]; chn.Pos != n.Pos+uint(n.Len())-2 {
+			t.Fatalf("CRLF position = %d, want %d", chn.Pos, n.Pos+uint(n.Len())-2)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("s.Err() = %v, want nil", err)
+	}
+
+	want := []match{{"ab\r\n", 0}, {"cde\r\n", 4}, {"f\r\n", 9}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d matches %v, want %v", len(got), got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("match %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got, want := s.Offset(), uint(12); got != want {
+		t.Fatalf("s.Offset() = %d, want %d", got, want)
+	}
+}
+
+func TestScanner_Lookahead(t *testing.T) {
+	rep := abnf.Repeat1Inf(`1*"ab"`, abnf.Literal(`"ab"`, []byte("ab")))
+	// opaque doesn't report truncated input, so it can't tell that a match may be extended
+	opaque := func(_ *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		return rep(nil, in, pos, ns)
+	}
+
+	for _, c := range []struct {
+		name      string
+		op        abnf.Operator
+		lookahead int
+		want      []string
+	}{
+		{"reporting", rep, 0, []string{"ababab"}},
+		{"opaque", opaque, 0, []string{"ab", "ab", "ab"}},
+		{"opaque lookahead", opaque, 2, []string{"ababab"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := io.MultiReader(strings.NewReader("ab"), strings.NewReader("ab"), strings.NewReader("ab"))
+			s := abnf.NewScanner(r, c.op)
+			s.Lookahead(c.lookahead)
+
+			var got []string
+			for s.Scan() {
+				got = append(got, s.Node().String())
+			}
+			if err := s.Err(); err != nil {
+				t.Fatalf("s.Err() = %v, want nil", err)
+			}
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("matches mismatch (-got +want):\n%s", cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+// garbageReader endlessly reads the same octet and counts read octets.
+type garbageReader struct {
+	b byte
+	n int
+}
+
+func (r *garbageReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.b
+	}
+	r.n += len(p)
+	return len(p), nil
+}
+
+func TestScanner_Invalid(t *testing.T) {
+	r := &garbageReader{b: '!'}
+	s := abnf.NewScanner(r, msgOp())
+	if s.Scan() {
+		t.Fatalf("s.Scan() = true, want false")
+	}
+	if err := s.Err(); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Fatalf("s.Err() = %v, want %v", err, abnf.ErrNotMatched)
+	}
+	if r.n > 4096 {
+		t.Fatalf("scanner read %d octets of invalid input, want at most one buffer", r.n)
+	}
+}
+
+func TestScanner_Incomplete(t *testing.T) {
+	digits := abnf.Repeat1Inf("1*DIGIT", abnf_core.Operators().DIGIT)
+	// frame = 1*DIGIT CRLF <octets>
+	frame := abnf.Bind("frame", digits, abnf.DecNumber, func(n uint) abnf.Operator {
+		return abnf.Concat("data",
+			abnf.Literal("CRLF", []byte("\r\n")),
+			abnf.Octets("octets", n),
+		)
+	})
+
+	var parses int
+	op := func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		parses++
+		return frame(ctx, in, pos, ns)
+	}
+
+	payload := strings.Repeat("x", 1000)
+	s := abnf.NewScanner(iotest.OneByteReader(strings.NewReader("1000\r\n"+payload)), op)
+	if !s.Scan() {
+		t.Fatalf("s.Scan() = false, want true, error = %v", s.Err())
+	}
+	if got, want := s.Node().String(), "1000\r\n"+payload; got != want {
+		t.Fatalf("s.Node() = %q, want %q", got, want)
+	}
+	// the truncated payload isn't re-parsed until all of it is buffered
+	if parses > 10 {
+		t.Fatalf("frame was parsed %d times, want at most 10", parses)
+	}
+}
+
+func TestScanner_LongMatch(t *testing.T) {
+	msg := msgOp()
+	var parses int
+	op := func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		parses++
+		return msg(ctx, in, pos, ns)
+	}
+
+	word := strings.Repeat("a", 1000)
+	s := abnf.NewScanner(iotest.OneByteReader(strings.NewReader(word+"\r\nb\r\n")), op)
+	for _, want := range []string{word + "\r\n", "b\r\n"} {
+		if !s.Scan() {
+			t.Fatalf("s.Scan() = false, want true, error = %v", s.Err())
+		}
+		if got := s.Node().String(); got != want {
+			t.Fatalf("s.Node() = %q, want %q", got, want)
+		}
+	}
+	if s.Scan() {
+		t.Fatalf("s.Scan() = true, want false")
+	}
+	// the buffered input is parsed again only once its length doubles
+	if parses > 30 {
+		t.Fatalf("msg was parsed %d times, want at most 30", parses)
+	}
+}
+
+func TestScanner_Errors(t *testing.T) {
+	s := abnf.NewScanner(strings.NewReader("ab\r\ncd"), msgOp())
+	if !s.Scan() {
+		t.Fatalf("s.Scan() = false, want true, error = %v", s.Err())
+	}
+	if s.Scan() {
+		t.Fatalf("s.Scan() = true, want false")
+	}
+	if err := s.Err(); !errors.Is(err, abnf.ErrNotMatched) {
+		t.Fatalf("s.Err() = %v, want %v", err, abnf.ErrNotMatched)
+	}
+
+	s = abnf.NewScanner(strings.NewReader("abcdefghij\r\n"), msgOp())
+	s.Buffer(make([]byte, 0, 4), 8)
+	if s.Scan() {
+		t.Fatalf("s.Scan() = true, want false")
+	}
+	if err := s.Err(); !errors.Is(err, abnf.ErrMatchTooLong) {
+		t.Fatalf("s.Err() = %v, want %v", err, abnf.ErrMatchTooLong)
+	}
+
+	s = abnf.NewScanner(strings.NewReader("ab"), abnf.Repeat0Inf(`*"a"`, abnf.Literal(`"a"`, []byte("a"))))
+	for s.Scan() {
+	}
+	if err := s.Err(); !errors.Is(err, abnf.ErrEmptyMatch) {
+		t.Fatalf("s.Err() = %v, want %v", err, abnf.ErrEmptyMatch)
+	}
+}
@@ -0,0 +1,108 @@
+package abnf
+
+import (
+	"iter"
+)
+
+// Searcher finds matches of an operator in a larger input, like [regexp.Regexp] does.
+// Matches are searched from left to right, at every position the match preferred
+// by the parse [Policy] is taken. Empty matches are skipped.
+//
+// Searcher is safe for concurrent use.
+type Searcher struct {
+	op    Operator
+	first *ByteSet
+	opts  []ParseOption
+}
+
+// NewSearcher returns a searcher of matches of op.
+// If first isn't nil, it must be a FIRST set of op, i.e. a set of octets any non-empty match of op starts with,
+// then positions with other octets are skipped without invoking op.
+// Options apply to every search, see [Parse].
+func NewSearcher(op Operator, first *ByteSet, opts ...ParseOption) *Searcher {
+	return &Searcher{op: op, first: first, opts: opts}
+}
+
+// Find returns the leftmost match in in or nil if there is no match.
+func (s *Searcher) Find(in []byte) *Node {
+	for n := range s.All(in) {
+		return n
+	}
+	return nil
+}
+
+// FindIndex returns a two-element slice of integers defining the location of the leftmost match in in
+// or nil if there is no match. The match itself is at in[loc[0]:loc[1]].
+func (s *Searcher) FindIndex(in []byte) (loc []int) {
+	if n := s.Find(in); n != nil {
+		return []int{int(n.Pos), int(n.Pos) + n.Len()}
+	}
+	return nil
+}
+
+// FindAll returns up to n successive non-overlapping matches in in, all matches if n < 0.
+// It returns nil if there is no match.
+func (s *Searcher) FindAll(in []byte, n int) Nodes {
+	if n == 0 {
+		return nil
+	}
+
+	var res Nodes
+	for m := range s.All(in) {
+		res = append(res, m)
+		if len(res) == n {
+			break
+		}
+	}
+	return res
+}
+
+// FindAllIndex returns locations of up to n successive non-overlapping matches in in, all matches if n < 0,
+// see [Searcher.FindIndex]. It returns nil if there is no match.
+func (s *Searcher) FindAllIndex(in []byte, n int) [][]int {
+	var res [][]int
+	for _, m := range s.FindAll(in, n) {
+		res = append(res, []int{int(m.Pos), int(m.Pos) + m.Len()})
+	}
+	return res
+}
+
+// All returns an iterator over successive non-overlapping matches in in.
+func (s *Searcher) All(in []byte) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		ctx := NewContext(s.opts...)
+
+		ns := NewNodes()
+		defer ns.Free()
+
+		policy := ctx.Policy()
+		for pos := 0; pos < len(in); {
+			if s.first != nil && !s.first.Has(in[pos]) {
+				pos++
+				continue
+			}
+
+			ns.Clear()
+			if err := s.op(ctx, in, uint(pos), ns); err != nil || ns.Len() == 0 {
+				pos++
+				continue
+			}
+
+			var n *Node
+			for _, m := range ns.All() {
+				if m.Len() > 0 && (n == nil || policy(m, n) < 0) {
+					n = m
+				}
+			}
+			if n == nil {
+				pos++
+				continue
+			}
+
+			if !yield(n) {
+				return
+			}
+			pos += n.Len()
+		}
+	}
+}
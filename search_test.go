@@ -0,0 +1,74 @@
+package abnf_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/ghettovoice/abnf"
+	"github.com/ghettovoice/abnf/pkg/abnf_core"
+)
+
+// ipv4Op returns the operator of the rule:
+//
+//	ipv4 = dec-octet 3("." dec-octet)
+//	dec-octet = 1*3DIGIT
+func ipv4Op(calls *int) abnf.Operator {
+	octet := abnf.Repeat("dec-octet", 1, 3, abnf_core.Operators().DIGIT)
+	op := abnf.Concat("ipv4",
+		octet,
+		abnf.RepeatN(`3("." dec-octet)`, 3, abnf.Concat(`"." dec-octet`, abnf.Literal(`"."`, []byte(".")), octet)),
+	)
+	return func(ctx *abnf.Context, in []byte, pos uint, ns *abnf.Nodes) error {
+		*calls++
+		return op(ctx, in, pos, ns)
+	}
+}
+
+func TestSearcher(t *testing.T) {
+	in := []byte("from 10.0.0.1 to 192.168.1.20, not 1.2.3 or x.y")
+	digits := abnf.NewByteSet()
+	digits.AddRange('0', '9')
+
+	var calls int
+	s := abnf.NewSearcher(ipv4Op(&calls), nil)
+	fs := abnf.NewSearcher(ipv4Op(&calls), &digits)
+
+	if got, want := s.Find(in).String(), "10.0.0.1"; got != want {
+		t.Errorf("s.Find(in) = %q, want %q", got, want)
+	}
+	if got, want := s.FindIndex(in), []int{5, 13}; !cmp.Equal(got, want) {
+		t.Errorf("s.FindIndex(in) = %v, want %v", got, want)
+	}
+	if got := s.FindIndex([]byte("none")); got != nil {
+		t.Errorf("s.FindIndex(in) = %v, want nil", got)
+	}
+
+	var vals []string
+	for _, n := range s.FindAll(in, -1) {
+		vals = append(vals, n.String())
+	}
+	if want := []string{"10.0.0.1", "192.168.1.20"}; !cmp.Equal(vals, want) {
+		t.Errorf("s.FindAll(in, -1) = %q, want %q", vals, want)
+	}
+	if got, want := s.FindAllIndex(in, 1), [][]int{{5, 13}}; !cmp.Equal(got, want) {
+		t.Errorf("s.FindAllIndex(in, 1) = %v, want %v", got, want)
+	}
+
+	calls = 0
+	for range s.All(in) {
+	}
+	naive := calls
+
+	calls = 0
+	vals = vals[:0]
+	for n := range fs.All(in) {
+		vals = append(vals, n.String())
+	}
+	if want := []string{"10.0.0.1", "192.168.1.20"}; !cmp.Equal(vals, want) {
+		t.Errorf("fs.All(in) = %q, want %q", vals, want)
+	}
+	if calls >= naive/2 {
+		t.Errorf("searcher with FIRST set invoked op %d times, want less than half of %d", calls, naive)
+	}
+}
@@ -0,0 +1,244 @@
+package abnf
+
+import (
+	"fmt"
+	"iter"
+	"math"
+)
+
+// Tree is a compact representation of a parse tree.
+// Instead of linked [Node] structures it stores all nodes in a single arena
+// of parallel arrays: key IDs, start/end offsets and first-child/next-sibling indices.
+// Nodes are stored in the depth-first order, the root node has index 0.
+//
+// Tree is read-only, it is safe to use it from multiple goroutines.
+// Use [Cursor] to traverse the tree and [Tree.Node] to convert it to the classic [Node] tree.
+type Tree struct {
+	in   []byte
+	keys []string
+
+	keyIDs      []uint32
+	starts      []uint32
+	ends        []uint32
+	firstChilds []int32
+	nextSibls   []int32
+}
+
+// NewTree converts the node tree n parsed from in to a compact tree.
+// It's a conversion only: the node tree is built by the parse as usual,
+// the compact tree saves memory and allocations of trees kept after the parse, e.g. instead of [Node.Detach].
+// Use [ParseTree] to also save allocations of the parse itself.
+// It panics if the input is longer than 4 GiB.
+func NewTree(in []byte, n *Node) *Tree {
+	if uint64(len(in)) > math.MaxUint32 {
+		panic(fmt.Errorf("input length %d exceeds compact tree limit", len(in)))
+	}
+
+	t := &Tree{in: in}
+	if n == nil {
+		return t
+	}
+
+	size := n.count()
+	t.keyIDs = make([]uint32, 0, size)
+	t.starts = make([]uint32, 0, size)
+	t.ends = make([]uint32, 0, size)
+	t.firstChilds = make([]int32, 0, size)
+	t.nextSibls = make([]int32, 0, size)
+
+	keyIDs := make(map[string]uint32)
+	t.add(n, keyIDs)
+	return t
+}
+
+// ParseTree parses in with op like [Parse] and returns the best match as a compact tree.
+// Nodes of the parse are allocated from an arena, see [WithArena],
+// which is released as a whole once the parse is converted.
+// It returns error if op failed.
+func ParseTree(op Operator, in []byte, opts ...ParseOption) (*Tree, error) {
+	ns := NewNodes()
+	defer ns.Free()
+
+	if err := Parse(op, in, ns, append(opts, WithArena())...); err != nil {
+		return nil, err
+	}
+	return NewTree(in, ns.BestBy(NewContext(opts...).Policy())), nil
+}
+
+func (n *Node) count() int {
+	c := 1
+	for _, chn := range n.Children {
+		c += chn.count()
+	}
+	return c
+}
+
+func (t *Tree) add(n *Node, keyIDs map[string]uint32) int32 {
+	id, ok := keyIDs[n.Key]
+	if !ok {
+		id = uint32(len(t.keys))
+		keyIDs[n.Key] = id
+		t.keys = append(t.keys, n.Key)
+	}
+
+	i := int32(len(t.keyIDs))
+	t.keyIDs = append(t.keyIDs, id)
+	t.starts = append(t.starts, uint32(n.Pos))
+	t.ends = append(t.ends, uint32(n.Pos)+uint32(len(n.Value)))
+	t.firstChilds = append(t.firstChilds, -1)
+	t.nextSibls = append(t.nextSibls, -1)
+
+	prev := int32(-1)
+	for _, chn := range n.Children {
+		ci := t.add(chn, keyIDs)
+		if prev < 0 {
+			t.firstChilds[i] = ci
+		} else {
+			t.nextSibls[prev] = ci
+		}
+		prev = ci
+	}
+	return i
+}
+
+// Len returns the number of nodes in the tree.
+func (t *Tree) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.keyIDs)
+}
+
+// Input returns the input the tree was built from.
+func (t *Tree) Input() []byte {
+	if t == nil {
+		return nil
+	}
+	return t.in
+}
+
+// Root returns a cursor pointing to the root node.
+// The cursor is invalid if the tree is empty.
+func (t *Tree) Root() Cursor {
+	if t.Len() == 0 {
+		return Cursor{i: -1}
+	}
+	return Cursor{t: t, i: 0}
+}
+
+// Node converts the tree to the classic [Node] tree.
+// Values of the created nodes reference the tree input.
+func (t *Tree) Node() *Node {
+	return t.Root().Node()
+}
+
+// Cursor points to a node of a [Tree].
+// The zero value is an invalid cursor.
+type Cursor struct {
+	t *Tree
+	i int32
+}
+
+// Valid reports whether the cursor points to a node.
+func (c Cursor) Valid() bool { return c.t != nil && c.i >= 0 }
+
+// Index returns the node index in the tree arena or -1 if the cursor is invalid.
+func (c Cursor) Index() int {
+	if !c.Valid() {
+		return -1
+	}
+	return int(c.i)
+}
+
+// Key returns the node key.
+func (c Cursor) Key() string {
+	if !c.Valid() {
+		return ""
+	}
+	return c.t.keys[c.t.keyIDs[c.i]]
+}
+
+// Pos returns the node start position in the input.
+func (c Cursor) Pos() uint {
+	if !c.Valid() {
+		return 0
+	}
+	return uint(c.t.starts[c.i])
+}
+
+// End returns the node end position in the input.
+func (c Cursor) End() uint {
+	if !c.Valid() {
+		return 0
+	}
+	return uint(c.t.ends[c.i])
+}
+
+// Value returns the node value.
+func (c Cursor) Value() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.t.in[c.t.starts[c.i]:c.t.ends[c.i]]
+}
+
+// String returns the node value as a string.
+func (c Cursor) String() string { return string(c.Value()) }
+
+// FirstChild returns a cursor pointing to the first child node.
+// The returned cursor is invalid if the node has no children.
+func (c Cursor) FirstChild() Cursor {
+	if !c.Valid() {
+		return Cursor{i: -1}
+	}
+	return Cursor{t: c.t, i: c.t.firstChilds[c.i]}
+}
+
+// NextSibling returns a cursor pointing to the next sibling node.
+// The returned cursor is invalid if the node is the last child.
+func (c Cursor) NextSibling() Cursor {
+	if !c.Valid() {
+		return Cursor{i: -1}
+	}
+	return Cursor{t: c.t, i: c.t.nextSibls[c.i]}
+}
+
+// Children returns an iterator over child nodes.
+func (c Cursor) Children() iter.Seq[Cursor] {
+	return func(yield func(Cursor) bool) {
+		for chc := c.FirstChild(); chc.Valid(); chc = chc.NextSibling() {
+			if !yield(chc) {
+				return
+			}
+		}
+	}
+}
+
+// Find recursively searches a node with the given key starting from the cursor node.
+func (c Cursor) Find(key string) (Cursor, bool) {
+	if !c.Valid() {
+		return Cursor{i: -1}, false
+	}
+	if c.Key() == key {
+		return c, true
+	}
+	for chc := range c.Children() {
+		if fc, ok := chc.Find(key); ok {
+			return fc, true
+		}
+	}
+	return Cursor{i: -1}, false
+}
+
+// Node converts the subtree starting from the cursor node to the classic [Node] tree.
+func (c Cursor) Node() *Node {
+	if !c.Valid() {
+		return nil
+	}
+
+	n := &Node{Key: c.Key(), Pos: c.Pos(), Value: c.Value()}
+	for chc := range c.Children() {
+		n.Children = append(n.Children, chc.Node())
+	}
+	return n
+}
@@ -0,0 +1,183 @@
+package abnf_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/ghettovoice/abnf"
+)
+
+// abOp returns the operator of the rule:
+//
+//	ab = "a" *"b"
+func abOp() abnf.Operator {
+	return abnf.Concat(`"a" *"b"`,
+		abnf.Literal(`"a"`, []byte("a")),
+		abnf.Repeat0Inf(`*"b"`, abnf.Literal(`"b"`, []byte("b"))),
+	)
+}
+
+func TestNewTree(t *testing.T) {
+	in := []byte("abbc")
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(abOp(), in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	tree := abnf.NewTree(in, ns.Best())
+
+	if got, want := tree.Len(), 5; got != want {
+		t.Errorf("tree.Len() = %d, want %d", got, want)
+	}
+
+	root := tree.Root()
+	if got, want := root.Key(), `"a" *"b"`; got != want {
+		t.Errorf("root.Key() = %q, want %q", got, want)
+	}
+	if got, want := root.String(), "abb"; got != want {
+		t.Errorf("root.String() = %q, want %q", got, want)
+	}
+
+	c, ok := root.Find(`*"b"`)
+	if !ok {
+		t.Fatalf("root.Find(`*\"b\"`) = (_, false), want (_, true)")
+	}
+	if c.Pos() != 1 || c.End() != 3 {
+		t.Errorf("c.Pos(), c.End() = %d, %d, want 1, 3", c.Pos(), c.End())
+	}
+
+	var keys []string
+	for chc := range c.Children() {
+		keys = append(keys, chc.Key())
+	}
+	if want := []string{`"b"`, `"b"`}; !cmp.Equal(keys, want) {
+		t.Errorf("c.Children() keys = %v, want %v", keys, want)
+	}
+	if chc := c.FirstChild().NextSibling().NextSibling(); chc.Valid() {
+		t.Errorf("c.FirstChild().NextSibling().NextSibling().Valid() = true, want false")
+	}
+
+	want := &abnf.Node{
+		Key:   `"a" *"b"`,
+		Value: []byte("abb"),
+		Children: abnf.Nodes{
+			{Key: `"a"`, Value: []byte("a")},
+			{
+				Key:   `*"b"`,
+				Pos:   1,
+				Value: []byte("bb"),
+				Children: abnf.Nodes{
+					{Key: `"b"`, Pos: 1, Value: []byte("b")},
+					{Key: `"b"`, Pos: 2, Value: []byte("b")},
+				},
+			},
+		},
+	}
+	if got := tree.Node(); !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("tree.Node() = %+v, want %+v\ndiff (-got +want):\n%v",
+			got, want,
+			cmp.Diff(got, want, cmpopts.EquateEmpty()),
+		)
+	}
+}
+
+func TestNewTree_Empty(t *testing.T) {
+	tree := abnf.NewTree([]byte("b"), nil)
+	if tree.Len() != 0 || tree.Root().Valid() {
+		t.Fatalf("abnf.NewTree(in, nil) returned non empty tree")
+	}
+}
+
+func BenchmarkNewTree(b *testing.B) {
+	in := []byte("a" + strings.Repeat("b", 1000))
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(abOp(), in, ns); err != nil {
+		b.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	n := ns.Best()
+
+	// both keep the parse tree after the parse, the compact tree allocates a few arrays instead of every node
+	b.Run("Detach", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if dn := n.Detach(); dn == nil {
+				b.Fatal("n.Detach() = nil, want node")
+			}
+		}
+	})
+	b.Run("NewTree", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if tree := abnf.NewTree(in, n); tree.Len() != 1003 {
+				b.Fatalf("tree.Len() = %d, want 1003", tree.Len())
+			}
+		}
+	})
+}
+
+func TestParseTree(t *testing.T) {
+	in := []byte("abbc")
+
+	ns := abnf.NewNodes()
+	defer ns.Free()
+
+	if err := abnf.Parse(abOp(), in, ns); err != nil {
+		t.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+	}
+	want := ns.Best()
+
+	tree, err := abnf.ParseTree(abOp(), in)
+	if err != nil {
+		t.Fatalf("abnf.ParseTree(op, in) error = %v, want nil", err)
+	}
+	if got := tree.Node(); !cmp.Equal(got, want, cmpopts.EquateEmpty()) {
+		t.Fatalf("abnf.ParseTree(op, in).Node() = %+v, want %+v\ndiff (-got +want):\n%v",
+			got, want,
+			cmp.Diff(got, want, cmpopts.EquateEmpty()),
+		)
+	}
+
+	if _, err := abnf.ParseTree(abOp(), []byte("b")); err == nil {
+		t.Fatal("abnf.ParseTree(op, \"b\") error = nil, want error")
+	}
+}
+
+func BenchmarkParseTree(b *testing.B) {
+	in := []byte("a" + strings.Repeat("b", 100))
+	op := abOp()
+
+	// the arena allocates parse nodes in chunks instead of one by one
+	b.Run("Parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			ns := abnf.NewNodes()
+			if err := abnf.Parse(op, in, ns); err != nil {
+				b.Fatalf("abnf.Parse(op, in, ns) error = %v, want nil", err)
+			}
+			if tree := abnf.NewTree(in, ns.Best()); tree.Len() != 103 {
+				b.Fatalf("tree.Len() = %d, want 103", tree.Len())
+			}
+			ns.Free()
+		}
+	})
+	b.Run("ParseTree", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			tree, err := abnf.ParseTree(op, in)
+			if err != nil {
+				b.Fatalf("abnf.ParseTree(op, in) error = %v, want nil", err)
+			}
+			if tree.Len() != 103 {
+				b.Fatalf("tree.Len() = %d, want 103", tree.Len())
+			}
+		}
+	})
+}
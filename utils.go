@@ -31,3 +31,10 @@ func toLower(s []byte) []byte {
 	}
 	return bytes.ToLower(s)
 }
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}